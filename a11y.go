@@ -0,0 +1,442 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ============================================================
+// Accessibility
+// ============================================================
+//
+// Loop exports every image with the alt text "Image has no description".
+// The /a11y page lists each image with the text around it so alt text can
+// be written in the browser and saved into a new copy of the export;
+// loopd a11y reports missing alt text and heading-order problems.
+
+func init() {
+	subcommands["a11y"] = subcommand{
+		usage:   "<tar|dir>... [--json]",
+		summary: "Report images without alt text and heading-order problems",
+		run:     runA11y,
+	}
+}
+
+// AltImage is one image in a page with the text around it
+type AltImage struct {
+	Index   int    `json:"index"` // 1-based position in the page
+	URL     string `json:"url"`
+	Alt     string `json:"alt"`
+	Missing bool   `json:"missing"`
+	Line    int    `json:"line,omitempty"`
+	Heading string `json:"heading,omitempty"` // nearest heading above the image
+	Before  string `json:"before,omitempty"`  // text leading up to the image
+	After   string `json:"after,omitempty"`   // text following it
+}
+
+// A11yReport lists a page's images and heading-order problems
+type A11yReport struct {
+	File     string      `json:"file"`
+	Images   []AltImage  `json:"images"`
+	Missing  int         `json:"missing"`
+	Headings []LintIssue `json:"headings"`
+}
+
+var (
+	reImageSource = regexp.MustCompile(`!\[((?:[^\]\\]|\\.)*)\]\(([^)\s]+)(?:\s+"[^"]*")?\)`)
+	reFilenameAlt = regexp.MustCompile(`(?i)^[\w.-]+\.(png|jpe?g|gif|webp|svg)$`)
+)
+
+// missingAlt reports whether alt text says nothing about the image
+func missingAlt(alt string) bool {
+	alt = strings.TrimSpace(alt)
+	return alt == "" || alt == placeholderAlt || reFilenameAlt.MatchString(alt)
+}
+
+// contextChars caps the before and after text shown for an image
+const contextChars = 240
+
+// collectAltImages lists a page's images in order. Context is the text of
+// the block holding the image, or of the nearest blocks around it when
+// the image stands alone.
+func collectAltImages(doc *Document) []AltImage {
+	type block struct {
+		node    *Node
+		heading string
+	}
+	var blocks []block
+	heading := ""
+	walkNodes(doc.Root, func(n *Node) bool {
+		switch n.Type {
+		case "heading":
+			heading = strings.TrimSpace(nodeText(n))
+			blocks = append(blocks, block{n, heading})
+			return false
+		case "paragraph", "tableCell", "code":
+			blocks = append(blocks, block{n, heading})
+			return false
+		}
+		return true
+	})
+	textOf := func(i int) string {
+		return strings.Join(strings.Fields(textWithoutImages(blocks[i].node)), " ")
+	}
+
+	lines := imageLines(doc.Markdown)
+	seen := make(map[string]int)
+	images := []AltImage{}
+	for i, b := range blocks {
+		walkNodes(b.node, func(n *Node) bool {
+			if n.Type != "image" {
+				return true
+			}
+			img := AltImage{
+				Index:   len(images) + 1,
+				URL:     n.URL,
+				Alt:     n.Alt,
+				Missing: missingAlt(n.Alt),
+				Heading: b.heading,
+			}
+			if l := lines[n.URL]; seen[n.URL] < len(l) {
+				img.Line = l[seen[n.URL]]
+			}
+			seen[n.URL]++
+			if own := textOf(i); own != "" {
+				img.Before = own
+			} else {
+				for j := i - 1; j >= 0 && img.Before == ""; j-- {
+					img.Before = textOf(j)
+				}
+				for j := i + 1; j < len(blocks) && img.After == ""; j++ {
+					if blocks[j].node.Type != "heading" {
+						img.After = textOf(j)
+					}
+				}
+			}
+			img.Before = truncateContext(img.Before, true)
+			img.After = truncateContext(img.After, false)
+			images = append(images, img)
+			return true
+		})
+	}
+	return images
+}
+
+// textWithoutImages is the text of n leaving out image alt text, so an
+// image alone in its paragraph has no context of its own
+func textWithoutImages(n *Node) string {
+	var sb strings.Builder
+	walkNodes(n, func(c *Node) bool {
+		switch c.Type {
+		case "text", "inlineCode", "code":
+			sb.WriteString(c.Value)
+		case "break":
+			sb.WriteString("\n")
+		}
+		return true
+	})
+	return sb.String()
+}
+
+// imageLines maps each image destination in the markdown to the lines it
+// appears on
+func imageLines(src string) map[string][]int {
+	lines := make(map[string][]int)
+	for i, line := range strings.Split(src, "\n") {
+		for _, m := range reImageSource.FindAllStringSubmatch(line, -1) {
+			lines[m[2]] = append(lines[m[2]], i+1)
+		}
+	}
+	return lines
+}
+
+// truncateContext shortens context to its end when it leads up to an
+// image, or to its start when it follows one
+func truncateContext(s string, keepEnd bool) string {
+	r := []rune(s)
+	if len(r) <= contextChars {
+		return s
+	}
+	if keepEnd {
+		return "…" + strings.TrimSpace(string(r[len(r)-contextChars:]))
+	}
+	return strings.TrimSpace(string(r[:contextChars])) + "…"
+}
+
+// newA11yReport audits a page's images and heading order
+func newA11yReport(doc *Document) *A11yReport {
+	report := &A11yReport{File: doc.TarFile, Images: collectAltImages(doc)}
+	for _, img := range report.Images {
+		if img.Missing {
+			report.Missing++
+		}
+	}
+	report.Headings = lintMarkdown(doc.TarFile, doc.Markdown, lintRuleSet{"heading-jump": true}).Issues
+	return report
+}
+
+// applyAltText sets the alt text of images by destination, leaving the
+// rest of the markdown as it is. It returns the number of images changed
+// and the destinations that matched no image, sorted.
+func applyAltText(src string, alts map[string]string) (string, int, []string) {
+	var sb strings.Builder
+	matched := make(map[string]bool)
+	changed, last := 0, 0
+	for _, m := range reImageSource.FindAllStringSubmatchIndex(src, -1) {
+		url := src[m[4]:m[5]]
+		alt, ok := alts[url]
+		if !ok {
+			continue
+		}
+		matched[url] = true
+		sb.WriteString(src[last:m[2]])
+		sb.WriteString(escapeMarkdownText(strings.Join(strings.Fields(alt), " "), false))
+		last = m[3]
+		changed++
+	}
+	sb.WriteString(src[last:])
+	skipped := []string{}
+	for url := range alts {
+		if !matched[url] {
+			skipped = append(skipped, url)
+		}
+	}
+	sort.Strings(skipped)
+	return sb.String(), changed, skipped
+}
+
+// archiveDocument parses the markdown stored in an export's archive rather
+// than the cleaned copy being served, so that report lines and alt-text
+// edits both refer to the file that is rewritten
+func archiveDocument(content *Content) (*Document, error) {
+	data, err := readTarEntry(content.TarPath, "content.md")
+	if err != nil {
+		return nil, err
+	}
+	stored := *content
+	stored.Markdown = string(data)
+	return newDocument(&stored), nil
+}
+
+// altTextName names the copy of an export with edited alt text
+func altTextName(tarFile string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(tarFile, ".tar"), " (alt text)") + " (alt text)"
+}
+
+// writeExportFolder extracts an archive into dir. Entries that would land
+// outside it are skipped.
+func writeExportFolder(archive io.Reader, dir string) error {
+	tr := tar.NewReader(archive)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("tar read: %w", err)
+		}
+		name := filepath.Clean(filepath.FromSlash(hdr.Name))
+		if hdr.Typeflag != tar.TypeReg || name == "." || filepath.IsAbs(name) || strings.HasPrefix(name, "..") {
+			continue
+		}
+		dst := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return fmt.Errorf("read %s: %w", hdr.Name, err)
+		}
+		if err := os.WriteFile(dst, data, 0644); err != nil {
+			return err
+		}
+	}
+}
+
+// handleA11yPage serves the alt-text editor
+func handleA11yPage(w http.ResponseWriter, r *http.Request) {
+	tmplData, err := templates.ReadFile("templates/a11y.html")
+	if err != nil {
+		http.Error(w, "Template not found", 500)
+		return
+	}
+
+	tmpl, err := template.New("a11y").Parse(string(tmplData))
+	if err != nil {
+		http.Error(w, "Template parse error", 500)
+		return
+	}
+
+	contentMu.RLock()
+	content := currentContent
+	contentMu.RUnlock()
+
+	data := struct {
+		HasContent bool
+		TarFile    string
+	}{
+		HasContent: content != nil,
+	}
+	if content != nil {
+		data.TarFile = content.TarFile
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	tmpl.Execute(w, data)
+}
+
+// handleA11y reports the loaded page's images and heading order. POST
+// {"alt": {"<image url>": "<alt text>"}} saves a copy of the export with
+// that alt text: ?to=tar (default) or ?to=folder beside the original, or
+// ?to=download.
+func handleA11y(w http.ResponseWriter, r *http.Request) {
+	contentMu.RLock()
+	content := currentContent
+	contentMu.RUnlock()
+
+	if content == nil {
+		http.Error(w, "No content loaded", 404)
+		return
+	}
+	if r.Method != http.MethodPost {
+		doc, err := archiveDocument(content)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(newA11yReport(doc))
+		return
+	}
+
+	var req struct {
+		Alt map[string]string `json:"alt"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if bodyTooLarge(err) {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Invalid JSON: "+err.Error(), 400)
+		return
+	}
+	changed := 0
+	skipped := []string{}
+	var buf bytes.Buffer
+	err := rewriteTar(content.TarPath, &buf, func(name string, data []byte) []byte {
+		if name != "content.md" {
+			return data
+		}
+		md, n, missed := applyAltText(string(data), req.Alt)
+		changed, skipped = n, missed
+		return []byte(md)
+	})
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	// Every destination comes from the report of this same archive, so one
+	// that matches nothing means the export changed since the page loaded
+	if len(skipped) > 0 {
+		http.Error(w, fmt.Sprintf("No image in %s matches %s; reload the page and try again", content.TarFile, strings.Join(skipped, ", ")), http.StatusConflict)
+		return
+	}
+
+	name := altTextName(content.TarFile)
+	dst := filepath.Join(filepath.Dir(content.TarPath), name)
+	switch to := r.URL.Query().Get("to"); to {
+	case "download":
+		w.Header().Set("Content-Type", "application/x-tar")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.tar"`, name))
+		w.Write(buf.Bytes())
+		return
+	case "folder":
+		if err := writeExportFolder(&buf, dst); err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+	case "", "tar":
+		dst += ".tar"
+		if err := os.WriteFile(dst, buf.Bytes(), 0644); err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+	default:
+		http.Error(w, fmt.Sprintf("Unknown destination %q (choose from tar, folder, download)", to), 400)
+		return
+	}
+	logSuccess(fmt.Sprintf("Alt text: updated %d %s into %s", changed, plural(changed, "image", "images"), filepath.Base(dst)))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"path":    dst,
+		"updated": changed,
+	})
+}
+
+func runA11y(args []string) error {
+	fs := newFlagSet("a11y")
+	asJSON := fs.Bool("json", false, "Print reports as JSON")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) == 0 {
+		fs.Usage()
+		return fmt.Errorf("expected at least one tar file or directory")
+	}
+	paths, err := expandExportArgs(positional)
+	if err != nil {
+		return err
+	}
+
+	reports := []*A11yReport{}
+	problems := 0
+	for _, p := range paths {
+		content, err := readTar(p)
+		if err != nil {
+			return fmt.Errorf("%s: %w", p, err)
+		}
+		report := newA11yReport(newDocument(content))
+		problems += report.Missing + len(report.Headings)
+		reports = append(reports, report)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(reports); err != nil {
+			return err
+		}
+	} else {
+		for _, report := range reports {
+			for _, img := range report.Images {
+				if !img.Missing {
+					continue
+				}
+				where := ""
+				if img.Heading != "" {
+					where = fmt.Sprintf(" (under %q)", img.Heading)
+				}
+				fmt.Printf("%s:%d: missing-alt: %s has no alt text%s\n", report.File, img.Line, img.URL, where)
+			}
+			for _, is := range report.Headings {
+				fmt.Printf("%s:%d: %s: %s\n", report.File, is.Line, is.Rule, is.Message)
+			}
+		}
+	}
+	if problems > 0 {
+		return fmt.Errorf("%d accessibility %s", problems, plural(problems, "problem", "problems"))
+	}
+	return nil
+}
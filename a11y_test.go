@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestCollectAltImagesContext checks that images alone in their paragraph,
+// as Loop exports them, take their context from the blocks around them
+// rather than from their own placeholder alt text
+func TestCollectAltImagesContext(t *testing.T) {
+	data, err := os.ReadFile("contrib/loop_export_1769590237093/content.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	images := collectAltImages(newDocument(&Content{Markdown: string(data)}))
+	if len(images) < 4 {
+		t.Fatalf("found %d images; want at least 4", len(images))
+	}
+	for _, img := range images {
+		if strings.Contains(img.Before, placeholderAlt) || strings.Contains(img.After, placeholderAlt) {
+			t.Errorf("image %d (%s) uses alt text as context: before %q, after %q", img.Index, img.URL, img.Before, img.After)
+		}
+	}
+
+	tests := []struct {
+		url, before, after string
+	}{
+		{"images/image_0.png", "confirm you can log in using SSO", "If everything is working"},
+		{"images/image_2.png", "type in terminal and hit enter", "copy paste the following"},
+		{"images/image_3.png", "type in terminal and hit enter", "copy paste the following"},
+	}
+	for _, tt := range tests {
+		for _, img := range images {
+			if img.URL != tt.url {
+				continue
+			}
+			if !strings.Contains(img.Before, tt.before) {
+				t.Errorf("%s before = %q; want it to contain %q", tt.url, img.Before, tt.before)
+			}
+			if !strings.Contains(img.After, tt.after) {
+				t.Errorf("%s after = %q; want it to contain %q", tt.url, img.After, tt.after)
+			}
+		}
+	}
+}
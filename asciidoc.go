@@ -0,0 +1,296 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ============================================================
+// AsciiDoc Writer
+// ============================================================
+
+func init() {
+	exportFormats["asciidoc"] = exportFormat{
+		ext:      ".adoc",
+		mime:     "text/asciidoc; charset=utf-8",
+		imageDir: "images",
+		render: func(doc *Document, _ exportOptions) ([]byte, error) {
+			return []byte(renderAsciiDoc(doc)), nil
+		},
+	}
+}
+
+// renderAsciiDoc renders a document as AsciiDoc for Asciidoctor and Antora.
+// The page title becomes the document header and its heading is left out.
+func renderAsciiDoc(doc *Document) string {
+	w := &asciidocWriter{title: titleNode(doc), level: 1}
+	body := w.blocks(doc.Root.Children)
+	out := "= " + strings.ReplaceAll(doc.Title, "\n", " ") + "\n"
+	if body != "" {
+		out += "\n" + body + "\n"
+	}
+	return out
+}
+
+type asciidocWriter struct {
+	title *Node // heading used as the document title, skipped in the body
+	level int   // level of the last section, so depth jumps are closed up
+}
+
+func (w *asciidocWriter) blocks(nodes []*Node) string {
+	var parts []string
+	for _, n := range nodes {
+		if s := w.block(n); s != "" {
+			parts = append(parts, s)
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+func (w *asciidocWriter) block(n *Node) string {
+	switch n.Type {
+	case "heading":
+		if n == w.title {
+			return ""
+		}
+		// Sections start at level 1 (==) under the title and stop at 5
+		// (======); Asciidoctor warns when a level is skipped
+		level := min(max(n.Depth, 2), w.level+1, 6)
+		w.level = level
+		return strings.Repeat("=", level) + " " + strings.ReplaceAll(w.inlines(n.Children, false), "\n", " ")
+
+	case "paragraph":
+		if len(n.Children) == 1 && n.Children[0].Type == "image" {
+			img := n.Children[0]
+			return "image::" + img.URL + "[" + asciidocAttr(img.Alt) + "]"
+		}
+		return w.inlines(n.Children, true)
+
+	case "blockquote":
+		body := w.blocks(n.Children)
+		if n.Callout != "" {
+			// AsciiDoc has the same five admonitions as GitHub alerts
+			return "[" + n.Callout + "]\n====\n" + body + "\n===="
+		}
+		return "____\n" + body + "\n____"
+
+	case "list":
+		return w.list(n, 1)
+
+	case "code":
+		fence := "----"
+		for strings.Contains(n.Value, fence) {
+			fence += "-"
+		}
+		attr := "[source]"
+		if n.Lang != "" {
+			attr = "[source," + n.Lang + "]"
+		}
+		return attr + "\n" + fence + "\n" + n.Value + "\n" + fence
+
+	case "table":
+		return w.table(n)
+
+	case "thematicBreak":
+		return "'''"
+
+	case "html":
+		if strings.HasPrefix(strings.TrimSpace(n.Value), "<!--") {
+			return ""
+		}
+		return "++++\n" + n.Value + "\n++++"
+
+	default:
+		return w.inline(n)
+	}
+}
+
+// list writes a list at a nesting depth; AsciiDoc nests by repeating the
+// marker (* ** ***, . .. ...) and attaches extra blocks with "+"
+func (w *asciidocWriter) list(n *Node, depth int) string {
+	marker := strings.Repeat("*", depth)
+	if n.Ordered {
+		marker = strings.Repeat(".", depth)
+	}
+	var items []string
+	for _, li := range n.Children {
+		var sb strings.Builder
+		sb.WriteString(marker + " ")
+		if li.Checked != nil {
+			if *li.Checked {
+				sb.WriteString("[x] ")
+			} else {
+				sb.WriteString("[ ] ")
+			}
+		}
+		for i, c := range li.Children {
+			switch {
+			case c.Type == "list":
+				sb.WriteString("\n" + w.list(c, depth+1))
+			case i == 0 && c.Type == "paragraph":
+				sb.WriteString(w.inlines(c.Children, false))
+			default:
+				sb.WriteString("\n+\n" + w.block(c))
+			}
+		}
+		items = append(items, sb.String())
+	}
+	return strings.Join(items, "\n")
+}
+
+func (w *asciidocWriter) table(n *Node) string {
+	cols := len(n.Align)
+	for _, row := range n.Children {
+		cols = max(cols, len(row.Children))
+	}
+	specs := make([]string, cols)
+	for c := range specs {
+		align := ""
+		if c < len(n.Align) {
+			align = n.Align[c]
+		}
+		switch align {
+		case "left":
+			specs[c] = "<1"
+		case "center":
+			specs[c] = "^1"
+		case "right":
+			specs[c] = ">1"
+		default:
+			specs[c] = "1"
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "[cols=\"%s\",options=\"header\"]\n|===\n", strings.Join(specs, ","))
+	for i, row := range n.Children {
+		for c := 0; c < cols; c++ {
+			text := ""
+			if c < len(row.Children) {
+				text = strings.ReplaceAll(w.inlines(row.Children[c].Children, false), "\n", " ")
+			}
+			sb.WriteString("|" + strings.ReplaceAll(text, "|", `\|`))
+			if c < cols-1 {
+				sb.WriteString(" ")
+			}
+		}
+		sb.WriteString("\n")
+		if i == 0 {
+			sb.WriteString("\n")
+		}
+	}
+	sb.WriteString("|===")
+	return sb.String()
+}
+
+func (w *asciidocWriter) inlines(nodes []*Node, blockStart bool) string {
+	var sb strings.Builder
+	for i, n := range nodes {
+		s := w.inline(n)
+		if n.Type == "text" {
+			s = escapeAsciiDocText(s, blockStart && i == 0)
+		}
+		sb.WriteString(s)
+	}
+	return strings.TrimRight(sb.String(), " \t")
+}
+
+func (w *asciidocWriter) inline(n *Node) string {
+	switch n.Type {
+	case "text":
+		return n.Value
+	case "inlineCode":
+		// Literal monospace: no substitutions inside +...+
+		if !strings.Contains(n.Value, "+") {
+			return "`+" + n.Value + "+`"
+		}
+		return "`pass:[" + strings.ReplaceAll(n.Value, "]", `\]`) + "]`"
+	case "strong":
+		return "**" + w.inlines(n.Children, false) + "**"
+	case "emphasis":
+		return "__" + w.inlines(n.Children, false) + "__"
+	case "delete":
+		return "[.line-through]#" + w.inlines(n.Children, false) + "#"
+	case "break":
+		return " +\n"
+	case "link":
+		if text := nodeText(n); text == n.URL || "mailto:"+text == n.URL {
+			// Bare URLs and addresses are linked automatically
+			return text
+		}
+		text := asciidocAttr(w.inlines(n.Children, false))
+		if reAsciiDocPlainURL.MatchString(n.URL) {
+			return n.URL + "[" + text + "]"
+		}
+		return "link:++" + n.URL + "++[" + text + "]"
+	case "image":
+		return "image:" + n.URL + "[" + asciidocAttr(n.Alt) + "]"
+	case "html":
+		if isBreakTag(n.Value) {
+			return " +\n"
+		}
+		return "+++" + n.Value + "+++"
+	default:
+		return w.inlines(n.Children, false)
+	}
+}
+
+var (
+	// reAsciiDocPlainURL matches URLs that can be written as url[text]
+	reAsciiDocPlainURL = regexp.MustCompile(`^(https?|mailto|ftp|irc):[A-Za-z0-9/._~%&=?:@!$'*+,;#-]+$`)
+	// reAsciiDocLineStart matches line starts AsciiDoc reads as block syntax
+	reAsciiDocLineStart = regexp.MustCompile(`^(=+ |[*.-]+ |\d+\. |//|\[|\.[^\s.]|\|===|-{4,}|={4,}|_{4,}|\+{4,}|'{3,}|:\w+:|(NOTE|TIP|IMPORTANT|WARNING|CAUTION): )`)
+	// reAsciiDocAttrRef matches {name} attribute references
+	reAsciiDocAttrRef = regexp.MustCompile(`\{[\w-]+\}`)
+)
+
+// asciidocAttr escapes text used inside a macro's [...] attribute list
+func asciidocAttr(s string) string {
+	s = strings.ReplaceAll(s, "]", `\]`)
+	// A comma would split the attribute list, so quote the text
+	if strings.ContainsAny(s, ",=\"") {
+		return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+	}
+	return s
+}
+
+// escapeAsciiDocText escapes formatting marks that could pair up, attribute
+// references and cross-reference brackets. A backslash is only consumed when
+// it escapes real markup, so lone marks are left alone.
+func escapeAsciiDocText(s string, blockStart bool) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case '*', '_', '`', '#', '^', '~':
+			// Intraword underscores are common in identifiers and only
+			// matter when doubled
+			if c == '_' && i > 0 && isWordByte(s[i-1]) && i+1 < len(s) && s[i+1] != '_' {
+				break
+			}
+			if strings.IndexByte(s[i+1:], c) >= 0 {
+				sb.WriteByte('\\')
+			}
+		case '{':
+			if reAsciiDocAttrRef.MatchString(s[i:]) && reAsciiDocAttrRef.FindStringIndex(s[i:])[0] == 0 {
+				sb.WriteByte('\\')
+			}
+		case '[', '<':
+			if i+1 < len(s) && s[i+1] == c {
+				sb.WriteByte('\\')
+			}
+		}
+		sb.WriteByte(c)
+	}
+	lines := strings.Split(sb.String(), "\n")
+	for i, l := range lines {
+		if i == 0 && !blockStart {
+			continue
+		}
+		if reAsciiDocLineStart.MatchString(l) {
+			lines[i] = "{empty}" + l
+		}
+	}
+	return strings.Join(lines, "\n")
+}
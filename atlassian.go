@@ -0,0 +1,467 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// ============================================================
+// Confluence and Jira Writers
+// ============================================================
+
+func init() {
+	exportFormats["confluence"] = exportFormat{
+		ext:      ".xhtml",
+		mime:     "application/xhtml+xml; charset=utf-8",
+		imageDir: ".",
+		render: func(doc *Document, _ exportOptions) ([]byte, error) {
+			return []byte(renderConfluence(doc.Root)), nil
+		},
+	}
+	exportFormats["jira"] = exportFormat{
+		ext:      ".txt",
+		mime:     "text/plain; charset=utf-8",
+		imageDir: ".",
+		render: func(doc *Document, _ exportOptions) ([]byte, error) {
+			return []byte(renderJira(doc.Root)), nil
+		},
+	}
+}
+
+// atlassianMacros maps GitHub alert types to Confluence and Jira panel
+// macros by colour: blue info, green tip, yellow note, red warning
+var atlassianMacros = map[string]string{
+	"NOTE":      "info",
+	"TIP":       "tip",
+	"IMPORTANT": "note",
+	"WARNING":   "note",
+	"CAUTION":   "warning",
+}
+
+// atlassianMacro returns the panel macro for a callout type
+func atlassianMacro(kind string) string {
+	if m, ok := atlassianMacros[kind]; ok {
+		return m
+	}
+	return "info"
+}
+
+// attachmentName returns the attachment file name for an export image
+// reference, or "" for external images
+func attachmentName(url string) string {
+	if name, ok := strings.CutPrefix(url, "images/"); ok {
+		return path.Base(name)
+	}
+	return ""
+}
+
+// ============================================================
+// Confluence Storage Format
+// ============================================================
+
+// renderConfluence renders a document tree as Confluence storage format,
+// the XHTML dialect used by the Confluence REST API and page source editor.
+// Images refer to page attachments with the export's image file names.
+func renderConfluence(root *Node) string {
+	w := &confluenceWriter{}
+	w.blocks(root.Children)
+	return w.sb.String()
+}
+
+type confluenceWriter struct {
+	sb strings.Builder
+}
+
+func (w *confluenceWriter) blocks(nodes []*Node) {
+	for _, n := range nodes {
+		w.block(n)
+	}
+}
+
+func (w *confluenceWriter) block(n *Node) {
+	switch n.Type {
+	case "heading":
+		fmt.Fprintf(&w.sb, "<h%d>", n.Depth)
+		w.inlines(n.Children)
+		fmt.Fprintf(&w.sb, "</h%d>\n", n.Depth)
+
+	case "paragraph":
+		w.sb.WriteString("<p>")
+		w.inlines(n.Children)
+		w.sb.WriteString("</p>\n")
+
+	case "blockquote":
+		if n.Callout != "" {
+			fmt.Fprintf(&w.sb, `<ac:structured-macro ac:name="%s">`+"\n", atlassianMacro(n.Callout))
+			w.sb.WriteString("<ac:rich-text-body>\n")
+			w.blocks(n.Children)
+			w.sb.WriteString("</ac:rich-text-body>\n</ac:structured-macro>\n")
+			return
+		}
+		w.sb.WriteString("<blockquote>\n")
+		w.blocks(n.Children)
+		w.sb.WriteString("</blockquote>\n")
+
+	case "list":
+		if isTaskList(n) {
+			w.taskList(n)
+			return
+		}
+		tag := "ul"
+		if n.Ordered {
+			tag = "ol"
+		}
+		w.sb.WriteString("<" + tag)
+		if n.Ordered && n.Start > 1 {
+			fmt.Fprintf(&w.sb, ` start="%d"`, n.Start)
+		}
+		w.sb.WriteString(">\n")
+		for _, li := range n.Children {
+			w.sb.WriteString("<li>")
+			w.itemBody(li, !n.Spread)
+			w.sb.WriteString("</li>\n")
+		}
+		w.sb.WriteString("</" + tag + ">\n")
+
+	case "code":
+		w.sb.WriteString(`<ac:structured-macro ac:name="code">` + "\n")
+		if n.Lang != "" {
+			fmt.Fprintf(&w.sb, `<ac:parameter ac:name="language">%s</ac:parameter>`+"\n", html.EscapeString(n.Lang))
+		}
+		// "]]>" cannot appear inside CDATA, so split it across two sections
+		body := strings.ReplaceAll(n.Value, "]]>", "]]]]><![CDATA[>")
+		w.sb.WriteString("<ac:plain-text-body><![CDATA[" + body + "]]></ac:plain-text-body>\n")
+		w.sb.WriteString("</ac:structured-macro>\n")
+
+	case "table":
+		w.sb.WriteString("<table>\n<tbody>\n")
+		for i, row := range n.Children {
+			tag := "td"
+			if i == 0 {
+				tag = "th"
+			}
+			w.sb.WriteString("<tr>\n")
+			for c, cell := range row.Children {
+				w.sb.WriteString("<" + tag)
+				if c < len(n.Align) && n.Align[c] != "" {
+					fmt.Fprintf(&w.sb, ` style="text-align: %s;"`, n.Align[c])
+				}
+				w.sb.WriteString(">")
+				w.inlines(cell.Children)
+				w.sb.WriteString("</" + tag + ">\n")
+			}
+			w.sb.WriteString("</tr>\n")
+		}
+		w.sb.WriteString("</tbody>\n</table>\n")
+
+	case "thematicBreak":
+		w.sb.WriteString("<hr />\n")
+
+	case "html":
+		// Raw HTML is rarely well-formed XML; keep it visible as text
+		if !strings.HasPrefix(strings.TrimSpace(n.Value), "<!--") {
+			w.sb.WriteString("<p>" + html.EscapeString(n.Value) + "</p>\n")
+		}
+
+	default:
+		w.sb.WriteString("<p>")
+		w.inline(n)
+		w.sb.WriteString("</p>\n")
+	}
+}
+
+// itemBody writes a list item's children, unwrapping paragraphs in tight lists
+func (w *confluenceWriter) itemBody(li *Node, tight bool) {
+	for _, c := range li.Children {
+		if tight && c.Type == "paragraph" {
+			w.inlines(c.Children)
+			continue
+		}
+		w.block(c)
+	}
+}
+
+func (w *confluenceWriter) taskList(n *Node) {
+	w.sb.WriteString("<ac:task-list>\n")
+	for _, li := range n.Children {
+		status := "incomplete"
+		if li.Checked != nil && *li.Checked {
+			status = "complete"
+		}
+		w.sb.WriteString("<ac:task>\n<ac:task-status>" + status + "</ac:task-status>\n<ac:task-body>")
+		w.itemBody(li, true)
+		w.sb.WriteString("</ac:task-body>\n</ac:task>\n")
+	}
+	w.sb.WriteString("</ac:task-list>\n")
+}
+
+func (w *confluenceWriter) inlines(nodes []*Node) {
+	for _, n := range nodes {
+		w.inline(n)
+	}
+}
+
+func (w *confluenceWriter) inline(n *Node) {
+	switch n.Type {
+	case "text":
+		w.sb.WriteString(html.EscapeString(n.Value))
+	case "inlineCode":
+		w.sb.WriteString("<code>" + html.EscapeString(n.Value) + "</code>")
+	case "strong":
+		w.sb.WriteString("<strong>")
+		w.inlines(n.Children)
+		w.sb.WriteString("</strong>")
+	case "emphasis":
+		w.sb.WriteString("<em>")
+		w.inlines(n.Children)
+		w.sb.WriteString("</em>")
+	case "delete":
+		w.sb.WriteString(`<span style="text-decoration: line-through;">`)
+		w.inlines(n.Children)
+		w.sb.WriteString("</span>")
+	case "break":
+		w.sb.WriteString("<br />")
+	case "link":
+		fmt.Fprintf(&w.sb, `<a href="%s">`, html.EscapeString(n.URL))
+		w.inlines(n.Children)
+		w.sb.WriteString("</a>")
+	case "image":
+		w.sb.WriteString("<ac:image")
+		if n.Alt != "" {
+			fmt.Fprintf(&w.sb, ` ac:alt="%s"`, html.EscapeString(n.Alt))
+		}
+		if n.Title != "" {
+			fmt.Fprintf(&w.sb, ` ac:title="%s"`, html.EscapeString(n.Title))
+		}
+		w.sb.WriteString(">")
+		if name := attachmentName(n.URL); name != "" {
+			fmt.Fprintf(&w.sb, `<ri:attachment ri:filename="%s" />`, html.EscapeString(name))
+		} else {
+			fmt.Fprintf(&w.sb, `<ri:url ri:value="%s" />`, html.EscapeString(n.URL))
+		}
+		w.sb.WriteString("</ac:image>")
+	case "html":
+		if isBreakTag(n.Value) {
+			w.sb.WriteString("<br />")
+		} else {
+			w.sb.WriteString(html.EscapeString(n.Value))
+		}
+	default:
+		w.inlines(n.Children)
+	}
+}
+
+// isBreakTag reports whether inline HTML is a <br> in any spelling
+func isBreakTag(s string) bool {
+	s = strings.ToLower(strings.ReplaceAll(s, " ", ""))
+	return s == "<br>" || s == "<br/>"
+}
+
+// ============================================================
+// Jira Wiki Markup
+// ============================================================
+
+// renderJira renders a document tree as Jira wiki markup, as accepted by
+// Jira Server/Data Center and the legacy editor
+func renderJira(root *Node) string {
+	w := &jiraWriter{}
+	out := w.blocks(root.Children)
+	if out == "" {
+		return ""
+	}
+	return out + "\n"
+}
+
+type jiraWriter struct{}
+
+func (w *jiraWriter) blocks(nodes []*Node) string {
+	var parts []string
+	for _, n := range nodes {
+		if s := w.block(n); s != "" {
+			parts = append(parts, s)
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+func (w *jiraWriter) block(n *Node) string {
+	switch n.Type {
+	case "heading":
+		return fmt.Sprintf("h%d. %s", n.Depth, strings.ReplaceAll(w.inlines(n.Children, true), "\n", " "))
+
+	case "paragraph":
+		return w.inlines(n.Children, true)
+
+	case "blockquote":
+		body := w.blocks(n.Children)
+		if n.Callout != "" {
+			macro := atlassianMacro(n.Callout)
+			return fmt.Sprintf("{%s:title=%s}\n%s\n{%s}", macro, calloutTitle(n.Callout), body, macro)
+		}
+		return "{quote}\n" + body + "\n{quote}"
+
+	case "list":
+		return w.list(n, "")
+
+	case "code":
+		open := "{code}"
+		if n.Lang != "" {
+			open = "{code:" + n.Lang + "}"
+		}
+		return open + "\n" + n.Value + "\n{code}"
+
+	case "table":
+		var lines []string
+		for i, row := range n.Children {
+			sep := "|"
+			if i == 0 {
+				sep = "||"
+			}
+			var sb strings.Builder
+			sb.WriteString(sep)
+			for _, cell := range row.Children {
+				text := strings.ReplaceAll(w.inlines(cell.Children, false), "\n", " ")
+				if text == "" {
+					text = " "
+				}
+				sb.WriteString(text + sep)
+			}
+			lines = append(lines, sb.String())
+		}
+		return strings.Join(lines, "\n")
+
+	case "thematicBreak":
+		return "----"
+
+	case "html":
+		if strings.HasPrefix(strings.TrimSpace(n.Value), "<!--") {
+			return ""
+		}
+		return "{noformat}\n" + n.Value + "\n{noformat}"
+
+	default:
+		return w.inline(n)
+	}
+}
+
+// list writes a list; prefix holds the markers of enclosing lists since
+// Jira nests by repeating them (* ** #*)
+func (w *jiraWriter) list(n *Node, prefix string) string {
+	marker := "*"
+	if n.Ordered {
+		marker = "#"
+	}
+	prefix += marker
+	var lines []string
+	for _, li := range n.Children {
+		var text []string
+		var nested []string
+		for _, c := range li.Children {
+			switch c.Type {
+			case "list":
+				nested = append(nested, w.list(c, prefix))
+			case "paragraph":
+				text = append(text, w.inlines(c.Children, false))
+			default:
+				// Block content inside an item has to stay on the item line
+				text = append(text, w.block(c))
+			}
+		}
+		item := strings.Join(text, " \\\\ ")
+		if li.Checked != nil {
+			box := "(-) "
+			if *li.Checked {
+				box = "(/) "
+			}
+			item = box + item
+		}
+		lines = append(lines, prefix+" "+item)
+		lines = append(lines, nested...)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (w *jiraWriter) inlines(nodes []*Node, blockStart bool) string {
+	var sb strings.Builder
+	for i, n := range nodes {
+		s := w.inline(n)
+		if n.Type == "text" {
+			s = escapeJiraText(s, blockStart && i == 0)
+		}
+		sb.WriteString(s)
+	}
+	return strings.TrimRight(sb.String(), " \t")
+}
+
+func (w *jiraWriter) inline(n *Node) string {
+	switch n.Type {
+	case "text":
+		return n.Value
+	case "inlineCode":
+		return "{{" + strings.NewReplacer("{", `\{`, "}", `\}`).Replace(n.Value) + "}}"
+	case "strong":
+		return "*" + w.inlines(n.Children, false) + "*"
+	case "emphasis":
+		return "_" + w.inlines(n.Children, false) + "_"
+	case "delete":
+		return "-" + w.inlines(n.Children, false) + "-"
+	case "break":
+		return "\\\\\n"
+	case "link":
+		text := w.inlines(n.Children, false)
+		if text == "" || nodeText(n) == n.URL {
+			return "[" + n.URL + "]"
+		}
+		return "[" + text + "|" + n.URL + "]"
+	case "image":
+		ref := n.URL
+		if name := attachmentName(n.URL); name != "" {
+			ref = name
+		}
+		if n.Alt != "" {
+			return "!" + ref + "|alt=" + strings.NewReplacer("|", " ", ",", " ", "!", "").Replace(n.Alt) + "!"
+		}
+		return "!" + ref + "!"
+	case "html":
+		if isBreakTag(n.Value) {
+			return "\\\\\n"
+		}
+		return escapeJiraText(n.Value, false)
+	default:
+		return w.inlines(n.Children, false)
+	}
+}
+
+// reJiraBlockStart matches line starts Jira reads as headings, quotes or lists
+var reJiraBlockStart = regexp.MustCompile(`^(h[1-6]\.|bq\.|#|-+\s)`)
+
+// escapeJiraText backslash-escapes characters Jira reads as markup
+func escapeJiraText(s string, blockStart bool) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case '*', '_', '{', '}', '[', ']', '|', '!', '^', '~':
+			sb.WriteByte('\\')
+		case '-', '+':
+			// Only a sign hugging a word can open strikethrough or underline
+			if i+1 < len(s) && s[i+1] != ' ' && (i == 0 || s[i-1] == ' ') {
+				sb.WriteByte('\\')
+			}
+		}
+		sb.WriteByte(c)
+	}
+	lines := strings.Split(sb.String(), "\n")
+	for i, l := range lines {
+		if i == 0 && !blockStart {
+			continue
+		}
+		if reJiraBlockStart.MatchString(l) {
+			lines[i] = `\` + l
+		}
+	}
+	return strings.Join(lines, "\n")
+}
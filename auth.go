@@ -0,0 +1,152 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// ============================================================
+// Access Control
+// ============================================================
+//
+// Any page open in the browser can send requests to localhost. Every
+// route needs the session token, which the TUI and banner print as part
+// of the preview URL, and cross-origin callers must also be on the CORS
+// allowlist. Opening a page with ?token= sets a cookie so the page's own
+// requests carry it.
+
+// AccessConfig configures the session token and CORS allowlist
+type AccessConfig struct {
+	Token   string   `json:"token,omitempty"`   // fixed token instead of a new one each session
+	Origins []string `json:"origins,omitempty"` // origins allowed to call the API, "null" for plugin iframes
+}
+
+// defaultOrigins lets the Figma plugin, whose iframe has a null origin,
+// call the API
+var defaultOrigins = []string{"null"}
+
+const (
+	tokenCookie = "loopd_token"
+	tokenHeader = "X-Loopd-Token"
+)
+
+// sessionToken guards the routes for this run of the server
+var sessionToken string
+
+// initSessionToken uses the configured token or makes a random one
+func initSessionToken(cfg AccessConfig) string {
+	if cfg.Token != "" {
+		sessionToken = cfg.Token
+		return sessionToken
+	}
+	b := make([]byte, 16)
+	rand.Read(b)
+	sessionToken = hex.EncodeToString(b)
+	return sessionToken
+}
+
+// withToken adds the session token to a URL
+func withToken(raw string) string {
+	if sessionToken == "" {
+		return raw
+	}
+	sep := "?"
+	if strings.Contains(raw, "?") {
+		sep = "&"
+	}
+	return raw + sep + "token=" + url.QueryEscape(sessionToken)
+}
+
+// requestToken finds the token in the Authorization or X-Loopd-Token
+// header, the token query parameter, or the session cookie
+func requestToken(r *http.Request) (token string, fromQuery bool) {
+	if t, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(t), false
+	}
+	if t := r.Header.Get(tokenHeader); t != "" {
+		return t, false
+	}
+	if t := r.URL.Query().Get("token"); t != "" {
+		return t, true
+	}
+	if c, err := r.Cookie(tokenCookie); err == nil {
+		return c.Value, false
+	}
+	return "", false
+}
+
+// authorized checks the request's token, remembering a valid ?token= in
+// a cookie for the page's later requests
+func authorized(w http.ResponseWriter, r *http.Request) bool {
+	if sessionToken == "" {
+		return true
+	}
+	token, fromQuery := requestToken(r)
+	if subtle.ConstantTimeCompare([]byte(token), []byte(sessionToken)) != 1 {
+		return false
+	}
+	if fromQuery {
+		http.SetCookie(w, &http.Cookie{
+			Name:     tokenCookie,
+			Value:    token,
+			Path:     "/",
+			HttpOnly: true,
+			SameSite: http.SameSiteStrictMode,
+		})
+	}
+	return true
+}
+
+// requireToken answers 401 unless the request carries the session token
+func requireToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(w, r) {
+			writeUnauthorized(w, r)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// allowedOrigin reports whether a cross-origin caller may use the API.
+// Requests from the server's own pages are always allowed.
+func allowedOrigin(r *http.Request, origin string) bool {
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && u.Host == r.Host {
+		return true
+	}
+	origins := globalConfig.Access.Origins
+	if origins == nil {
+		origins = defaultOrigins
+	}
+	return slices.Contains(origins, "*") || slices.Contains(origins, origin)
+}
+
+// writeUnauthorized explains how to get in: browsers get a page, API
+// clients a plain error
+func writeUnauthorized(w http.ResponseWriter, r *http.Request) {
+	if !strings.Contains(r.Header.Get("Accept"), "text/html") {
+		http.Error(w, "Missing or invalid token", http.StatusUnauthorized)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusUnauthorized)
+	w.Write([]byte(`<!DOCTYPE html>
+<html><head><title>loopd</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', sans-serif; max-width: 560px; margin: 80px auto; padding: 20px; color: #1f2937; }
+h1 { font-size: 20px; }
+p { line-height: 1.5; color: #4b5563; }
+code { background: #f3f4f6; padding: 2px 6px; border-radius: 4px; }
+</style></head><body>
+<h1>This loopd session needs its token</h1>
+<p>Open the preview link shown in the loopd terminal, which ends in <code>?token=…</code>. The browser remembers the token for the rest of the session.</p>
+</body></html>`))
+}
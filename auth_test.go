@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestToken(t *testing.T) {
+	tests := []struct {
+		name          string
+		target        string
+		header        map[string]string
+		cookie        string
+		want          string
+		wantFromQuery bool
+	}{
+		{name: "none", target: "/"},
+		{name: "bearer", target: "/", header: map[string]string{"Authorization": "Bearer abc "}, want: "abc"},
+		{name: "header", target: "/", header: map[string]string{tokenHeader: "abc"}, want: "abc"},
+		{name: "query", target: "/?token=abc", want: "abc", wantFromQuery: true},
+		{name: "cookie", target: "/", cookie: "abc", want: "abc"},
+		{name: "bearer beats query", target: "/?token=q", header: map[string]string{"Authorization": "Bearer h"}, want: "h"},
+		{name: "query beats cookie", target: "/?token=q", cookie: "c", want: "q", wantFromQuery: true},
+		{name: "basic auth is not a token", target: "/", header: map[string]string{"Authorization": "Basic abc"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", tt.target, nil)
+			for k, v := range tt.header {
+				r.Header.Set(k, v)
+			}
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: tokenCookie, Value: tt.cookie})
+			}
+			got, fromQuery := requestToken(r)
+			if got != tt.want || fromQuery != tt.wantFromQuery {
+				t.Errorf("requestToken() = %q, %v; want %q, %v", got, fromQuery, tt.want, tt.wantFromQuery)
+			}
+		})
+	}
+}
+
+func TestAllowedOrigin(t *testing.T) {
+	saved := globalConfig.Access.Origins
+	defer func() { globalConfig.Access.Origins = saved }()
+
+	tests := []struct {
+		name    string
+		origins []string
+		origin  string
+		want    bool
+	}{
+		{name: "no origin", origin: "", want: true},
+		{name: "same host", origin: "http://localhost:3000", want: true},
+		{name: "same host other scheme", origin: "https://localhost:3000", want: true},
+		{name: "other port", origin: "http://localhost:4000", want: false},
+		{name: "figma plugin by default", origin: "null", want: true},
+		{name: "other site by default", origin: "https://evil.example", want: false},
+		{name: "configured site", origins: []string{"https://example.com"}, origin: "https://example.com", want: true},
+		{name: "configured list replaces default", origins: []string{"https://example.com"}, origin: "null", want: false},
+		{name: "wildcard", origins: []string{"*"}, origin: "https://evil.example", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			globalConfig.Access.Origins = tt.origins
+			r := httptest.NewRequest("GET", "http://localhost:3000/content", nil)
+			if got := allowedOrigin(r, tt.origin); got != tt.want {
+				t.Errorf("allowedOrigin(%q) = %v, want %v", tt.origin, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+// ============================================================
+// HTTP Caching
+// ============================================================
+//
+// Templates and the Figma plugin fetch the same page again and again,
+// and /content inlines every image, so one response can be megabytes.
+// Each load is versioned by a hash of its archive. Content routes build
+// their bodies once per load, keep gzip and brotli copies beside them,
+// and send an ETag so a client that already has the current version gets
+// a 304 instead of the body.
+
+// minCompressSize is the smallest body worth compressing
+const minCompressSize = 1024
+
+// representation is a response body built once per load
+type representation struct {
+	body   []byte
+	header http.Header // Content-Type and headers such as X-Redactions
+	etag   string
+
+	mu      sync.Mutex
+	encoded map[string][]byte // body by content coding
+}
+
+// representations caches the bodies built for the loaded export
+var representations = struct {
+	sync.Mutex
+	content *Content
+	entries map[string]*representation
+}{}
+
+// dropRepresentations frees the bodies built for the previous load
+func dropRepresentations() {
+	representations.Lock()
+	representations.content, representations.entries = nil, nil
+	representations.Unlock()
+}
+
+// cachedRepresentation returns the body named key for content, calling
+// build the first time it is asked for after content was loaded. build
+// sets Content-Type and any other headers on h. Content that is no longer
+// current is built but not cached.
+func cachedRepresentation(content *Content, key string, build func(h http.Header) ([]byte, error)) (*representation, error) {
+	representations.Lock()
+	if rep, ok := representations.entries[key]; ok && representations.content == content {
+		representations.Unlock()
+		return rep, nil
+	}
+	representations.Unlock()
+
+	rep := &representation{header: http.Header{}, etag: contentETag(content, key)}
+	body, err := build(rep.header)
+	if err != nil {
+		return nil, err
+	}
+	rep.body = body
+
+	contentMu.RLock()
+	current := content == currentContent
+	contentMu.RUnlock()
+	if !current {
+		return rep, nil
+	}
+	representations.Lock()
+	defer representations.Unlock()
+	if representations.content != content {
+		representations.content, representations.entries = content, make(map[string]*representation)
+	}
+	// a concurrent request may have built it first
+	if existing, ok := representations.entries[key]; ok {
+		return existing, nil
+	}
+	representations.entries[key] = rep
+	return rep, nil
+}
+
+// contentETag identifies one representation of a load. It is weak
+// because the bytes differ between content codings.
+func contentETag(content *Content, key string) string {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return fmt.Sprintf(`W/"%s-%08x"`, content.Version, h.Sum32())
+}
+
+// encode returns the body in the given content coding, compressing it on
+// first use
+func (rep *representation) encode(coding string) []byte {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+	if data, ok := rep.encoded[coding]; ok {
+		return data
+	}
+	var buf bytes.Buffer
+	switch coding {
+	case "br":
+		bw := brotli.NewWriterLevel(&buf, brotli.DefaultCompression)
+		bw.Write(rep.body)
+		bw.Close()
+	case "gzip":
+		gw := gzip.NewWriter(&buf)
+		gw.Write(rep.body)
+		gw.Close()
+	default:
+		return rep.body
+	}
+	if rep.encoded == nil {
+		rep.encoded = make(map[string][]byte)
+	}
+	rep.encoded[coding] = buf.Bytes()
+	return buf.Bytes()
+}
+
+// serveRepresentation writes rep, compressed when the client accepts it,
+// or 304 Not Modified when If-None-Match names its ETag
+func serveRepresentation(w http.ResponseWriter, r *http.Request, rep *representation) {
+	h := w.Header()
+	for k, v := range rep.header {
+		h[k] = v
+	}
+	h.Set("ETag", rep.etag)
+	h.Set("Cache-Control", "no-cache")
+	h.Add("Vary", "Accept-Encoding")
+
+	body := rep.body
+	if len(body) >= minCompressSize && compressible(h.Get("Content-Type")) {
+		if coding := negotiateEncoding(r.Header.Get("Accept-Encoding")); coding != "" {
+			body = rep.encode(coding)
+			h.Set("Content-Encoding", coding)
+		}
+	}
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(body))
+}
+
+// compressible reports whether a content type is text-like; images and
+// archives are already compressed
+func compressible(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.TrimSpace(strings.ToLower(mediaType))
+	switch {
+	case strings.HasPrefix(mediaType, "text/"):
+		return true
+	case strings.HasSuffix(mediaType, "json"), strings.HasSuffix(mediaType, "xml"), strings.HasSuffix(mediaType, "javascript"):
+		return true
+	}
+	return mediaType == "image/svg+xml"
+}
+
+// negotiateEncoding picks br or gzip from an Accept-Encoding header,
+// preferring br when both are equally acceptable
+func negotiateEncoding(accept string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(accept, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "br" && name != "gzip" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		if q > bestQ || (q == bestQ && q > 0 && name == "br") {
+			best, bestQ = name, q
+		}
+	}
+	return best
+}
+
+// imageReplacer rewrites images/<name> references to the URL from target,
+// longest names first so a name that prefixes another cannot shadow it
+func imageReplacer(images map[string]string, target func(name, dataURL string) string) *strings.Replacer {
+	names := make([]string, 0, len(images))
+	for name := range images {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if len(names[i]) != len(names[j]) {
+			return len(names[i]) > len(names[j])
+		}
+		return names[i] < names[j]
+	})
+	pairs := make([]string, 0, 2*len(names))
+	for _, name := range names {
+		pairs = append(pairs, "images/"+name, target(name, images[name]))
+	}
+	return strings.NewReplacer(pairs...)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// ============================================================
+// Subcommands
+// ============================================================
+
+// subcommand is a one-shot CLI mode such as `loopd site`
+type subcommand struct {
+	usage   string // argument synopsis shown in help
+	summary string
+	run     func(args []string) error
+}
+
+// subcommands registered by name, populated in init functions
+var subcommands = map[string]subcommand{}
+
+// runSubcommand runs os.Args[1] if it names a subcommand. It reports
+// whether a subcommand was found.
+func runSubcommand() bool {
+	if len(os.Args) < 2 {
+		return false
+	}
+	cmd, ok := subcommands[os.Args[1]]
+	if !ok {
+		return false
+	}
+	err := cmd.run(os.Args[2:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0) // usage was printed for -h
+	}
+	if err != nil {
+		errorStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#EF4444")).Bold(true)
+		fmt.Fprintln(os.Stderr, errorStyle.Render(fmt.Sprintf("Error: %v", err)))
+		os.Exit(1)
+	}
+	return true
+}
+
+// subcommandHelp lists registered subcommands for the usage text
+func subcommandHelp() string {
+	names := make([]string, 0, len(subcommands))
+	for name := range subcommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var lines []string
+	for _, name := range names {
+		cmd := subcommands[name]
+		lines = append(lines, fmt.Sprintf("    %-32s %s", name+" "+cmd.usage, cmd.summary))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// newFlagSet creates a flag set for a subcommand with a usage line
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(appName+" "+name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE:\n    %s %s %s\n\nOPTIONS:\n", appName, name, subcommands[name].usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// helpRequested prints the usage of a subcommand that takes a command
+// word, such as `loopd daemon start`, when its first argument asks for
+// help instead
+func helpRequested(name string, args []string) bool {
+	if len(args) == 0 || (args[0] != "-h" && args[0] != "-help" && args[0] != "--help") {
+		return false
+	}
+	fmt.Fprintf(os.Stderr, "USAGE:\n    %s %s %s\n", appName, name, subcommands[name].usage)
+	return true
+}
+
+// parseArgs parses flags that may appear before or after positional
+// arguments and returns the positionals
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// expandHome expands a leading ~ to the user's home directory
+func expandHome(path string) string {
+	if strings.HasPrefix(path, "~") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[1:])
+		}
+	}
+	return path
+}
@@ -0,0 +1,812 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// ============================================================
+// Conversion for Static Site Generators
+// ============================================================
+
+func init() {
+	subcommands["convert"] = subcommand{
+		usage:   "<tar|dir>... --out <dir>",
+		summary: "Convert exports to markdown or another format",
+		run:     runConvert,
+	}
+}
+
+// ConvertConfig holds defaults for `loopd convert`
+type ConvertConfig struct {
+	Target      string            `json:"target,omitempty"`       // plain, hugo, jekyll, docusaurus, mkdocs
+	Fields      []string          `json:"fields,omitempty"`       // front matter fields to emit
+	Tags        []string          `json:"tags,omitempty"`         // added to every page
+	Author      string            `json:"author,omitempty"`       // used when no author line is detected
+	FrontMatter map[string]string `json:"front_matter,omitempty"` // extra fields copied verbatim
+	LinkRules   []LinkRule        `json:"link_rules,omitempty"`   // URL rewrites applied to every link
+}
+
+// frontMatterFields are the generated fields, in output order
+var frontMatterFields = []string{"title", "date", "author", "tags"}
+
+// convertTarget describes where a generator expects pages and images
+type convertTarget struct {
+	// page returns the markdown file and image directory for a page,
+	// relative to the output directory
+	page func(p *convertPage) (file, imageDir string)
+	// imageURL returns the reference written into the markdown for an image
+	imageURL func(p *convertPage, name string) string
+	// frontMatter arranges the generated fields for the generator
+	frontMatter func(p *convertPage, fields []string) []yamlField
+
+	// Optional hooks; nil keeps the GitHub-flavored markdown defaults
+
+	// embed formats an image reference
+	embed func(url, alt string) string
+	// pageLink formats a link to another page converted in the same run
+	pageLink func(target *convertPage, text string) string
+	// callout formats a callout from its rendered body
+	callout func(n *Node, body string) string
+	// writeFrontMatter formats the front matter block
+	writeFrontMatter func(sb *strings.Builder, fields []yamlField)
+}
+
+// convertPage is one export being converted
+type convertPage struct {
+	*Document
+	Slug   string
+	Name   string // title made safe for use as a file name
+	Date   time.Time
+	Author string
+	Tags   []string
+}
+
+// convertOptions are the settings shared by every page in a run
+type convertOptions struct {
+	Fields      []string
+	Extra       map[string]string
+	FrontMatter bool
+	Pages       *pageIndex
+}
+
+var convertTargets = map[string]convertTarget{
+	"plain": {
+		page: func(p *convertPage) (string, string) {
+			return filepath.Join(p.Slug, "content.md"), filepath.Join(p.Slug, "images")
+		},
+		imageURL: func(p *convertPage, name string) string {
+			return "images/" + name
+		},
+		frontMatter: standardFrontMatter,
+	},
+	// Hugo page bundles keep images beside index.md
+	"hugo": {
+		page: func(p *convertPage) (string, string) {
+			dir := filepath.Join("content", "posts", p.Slug)
+			return filepath.Join(dir, "index.md"), dir
+		},
+		imageURL: func(p *convertPage, name string) string {
+			return name
+		},
+		frontMatter: standardFrontMatter,
+	},
+	"jekyll": {
+		page: func(p *convertPage) (string, string) {
+			return filepath.Join("_posts", p.Date.Format("2006-01-02")+"-"+p.Slug+".md"),
+				filepath.Join("assets", "images", p.Slug)
+		},
+		imageURL: func(p *convertPage, name string) string {
+			// No spaces, so the destination needs no angle brackets
+			return "{{'/assets/images/" + p.Slug + "/" + name + "'|relative_url}}"
+		},
+		frontMatter: standardFrontMatter,
+	},
+	// Docusaurus docs take the author and date under last_update
+	"docusaurus": {
+		page: func(p *convertPage) (string, string) {
+			dir := filepath.Join("docs", p.Slug)
+			return filepath.Join(dir, "index.md"), filepath.Join(dir, "images")
+		},
+		imageURL: func(p *convertPage, name string) string {
+			return "./images/" + name
+		},
+		frontMatter: func(p *convertPage, fields []string) []yamlField {
+			var out, update []yamlField
+			for _, f := range standardFrontMatter(p, fields) {
+				switch f.Key {
+				case "date", "author":
+					update = append(update, f)
+				default:
+					out = append(out, f)
+				}
+			}
+			if len(update) > 0 {
+				out = append(out, yamlField{Key: "last_update", Value: update})
+			}
+			return out
+		},
+	},
+	"mkdocs": {
+		page: func(p *convertPage) (string, string) {
+			return filepath.Join("docs", p.Slug+".md"), filepath.Join("docs", "images", p.Slug)
+		},
+		imageURL: func(p *convertPage, name string) string {
+			return "images/" + p.Slug + "/" + name
+		},
+		frontMatter: standardFrontMatter,
+	},
+}
+
+// convertTargetNames lists the targets for help and errors
+func convertTargetNames() []string {
+	names := make([]string, 0, len(convertTargets))
+	for name := range convertTargets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// standardFrontMatter emits the selected fields under their usual names
+func standardFrontMatter(p *convertPage, fields []string) []yamlField {
+	var out []yamlField
+	for _, name := range fields {
+		switch name {
+		case "title":
+			out = append(out, yamlField{Key: "title", Value: p.Title})
+		case "date":
+			if !p.Date.IsZero() {
+				out = append(out, yamlField{Key: "date", Value: p.Date})
+			}
+		case "author":
+			if p.Author != "" {
+				out = append(out, yamlField{Key: "author", Value: p.Author})
+			}
+		case "tags":
+			if len(p.Tags) > 0 {
+				out = append(out, yamlField{Key: "tags", Value: p.Tags})
+			}
+		}
+	}
+	return out
+}
+
+// stringList collects a repeatable flag
+type stringList []string
+
+func (s *stringList) String() string { return strings.Join(*s, ", ") }
+
+func (s *stringList) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+func runConvert(args []string) error {
+	full := loadConfig()
+	cfg := full.Convert
+	if cfg.Target == "" {
+		cfg.Target = "plain"
+	}
+	if len(cfg.Fields) == 0 {
+		cfg.Fields = frontMatterFields
+	}
+
+	fs := newFlagSet("convert")
+	out := fs.String("out", "converted", "Output directory")
+	target := fs.String("target", cfg.Target, "Output layout: "+strings.Join(convertTargetNames(), ", "))
+	tags := fs.String("tags", "", "Comma-separated tags added to every page")
+	author := fs.String("author", cfg.Author, "Author used when none is detected in the first paragraph")
+	fields := fs.String("fields", strings.Join(cfg.Fields, ","), "Front matter fields to emit ("+strings.Join(frontMatterFields, ",")+")")
+	noFrontMatter := fs.Bool("no-front-matter", false, "Write markdown without front matter")
+	format := fs.String("format", "markdown", "Output format: "+strings.Join(exportFormatNames(), ", "))
+	toc := fs.Bool("toc", false, "Add a table of contents (pdf)")
+	rawLinks := fs.Bool("raw-links", false, "Keep SafeLinks wrappers and skip the configured link rules")
+	noCleanup := fs.Bool("no-cleanup", full.Lint.NoCleanup, "Keep Loop export artifacts instead of running the cleanup stage")
+	var extra stringList
+	fs.Var(&extra, "set", "Extra front matter field as key=value (repeatable)")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) == 0 {
+		fs.Usage()
+		return fmt.Errorf("expected at least one tar file or directory")
+	}
+
+	var exp exportFormat
+	if *format != "markdown" {
+		var ok bool
+		if exp, ok = exportFormats[*format]; !ok {
+			return fmt.Errorf("unknown format %q (choose from %s)", *format, strings.Join(exportFormatNames(), ", "))
+		}
+		if isFlagSetIn(fs, "target") {
+			return fmt.Errorf("--target only applies to markdown output")
+		}
+	}
+	tgt, ok := convertTargets[*target]
+	if !ok {
+		return fmt.Errorf("unknown target %q (choose from %s)", *target, strings.Join(convertTargetNames(), ", "))
+	}
+	selected := splitList(*fields)
+	for _, f := range selected {
+		if !slices.Contains(frontMatterFields, f) {
+			return fmt.Errorf("unknown front matter field %q (choose from %s)", f, strings.Join(frontMatterFields, ", "))
+		}
+	}
+	extraFields := make(map[string]string)
+	for k, v := range cfg.FrontMatter {
+		extraFields[k] = v
+	}
+	for _, kv := range extra {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || strings.TrimSpace(k) == "" {
+			return fmt.Errorf("--set expects key=value, got %q", kv)
+		}
+		extraFields[strings.TrimSpace(k)] = v
+	}
+	allTags := append(slices.Clone(cfg.Tags), splitList(*tags)...)
+	links, err := newLinkRewriter(cfg.LinkRules)
+	if err != nil {
+		return err
+	}
+	cleanupRules, err := newLintRuleSet(full.Lint.Disable)
+	if err != nil {
+		return err
+	}
+
+	paths, err := expandExportArgs(positional)
+	if err != nil {
+		return err
+	}
+
+	// Read everything first so links between pages can be resolved
+	slugs := newSlugger()
+	names := make(map[string]int)
+	var pages []*convertPage
+	for _, p := range paths {
+		content, err := readTar(p)
+		if err != nil {
+			return fmt.Errorf("%s: %w", filepath.Base(p), err)
+		}
+		doc := newDocument(content)
+		if !*noCleanup {
+			cleanupTree(doc.Root, cleanupRules)
+		}
+		if !*rawLinks {
+			processLinks(doc.Root, links)
+		}
+		pages = append(pages, newConvertPage(doc, slugs, names, *author, allTags))
+	}
+
+	outDir := expandHome(*out)
+	opts := convertOptions{
+		Fields:      selected,
+		Extra:       extraFields,
+		FrontMatter: !*noFrontMatter,
+		Pages:       newPageIndex(pages),
+	}
+	var written []string
+	for _, page := range pages {
+		var file string
+		var err error
+		if exp.render != nil {
+			file, err = writeExportedPage(outDir, exp, page, exportOptions{TOC: *toc})
+		} else {
+			file, err = writeConvertedPage(outDir, tgt, page, opts)
+		}
+		if err != nil {
+			return err
+		}
+		written = append(written, file)
+	}
+
+	kind := *target
+	if exp.render != nil {
+		kind = *format
+	}
+	successStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#10B981")).Bold(true)
+	pathStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#FBBF24"))
+	fmt.Println(successStyle.Render(fmt.Sprintf("✓ Converted %d %s (%s)", len(written), plural(len(written), "export", "exports"), kind)))
+	for _, file := range written {
+		fmt.Printf("  %s\n", pathStyle.Render(file))
+	}
+	return nil
+}
+
+// isFlagSetIn reports whether a flag was given on the command line
+func isFlagSetIn(fs *flag.FlagSet, name string) bool {
+	found := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			found = true
+		}
+	})
+	return found
+}
+
+// splitList splits a comma-separated flag value, dropping empty items
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// expandExportArgs resolves tar files and directories of tar files
+func expandExportArgs(args []string) ([]string, error) {
+	var paths []string
+	for _, arg := range args {
+		arg = expandHome(arg)
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			paths = append(paths, arg)
+			continue
+		}
+		found, err := listExports(arg)
+		if err != nil {
+			return nil, fmt.Errorf("list exports: %w", err)
+		}
+		if len(found) == 0 {
+			return nil, fmt.Errorf("no .tar exports found in %s", arg)
+		}
+		paths = append(paths, found...)
+	}
+	return paths, nil
+}
+
+// newConvertPage gathers the metadata for one export
+func newConvertPage(doc *Document, slugs *slugger, names map[string]int, defaultAuthor string, tags []string) *convertPage {
+	slug := slugs.slug(doc.Title)
+	if slug == "" {
+		slug = slugs.slug("page")
+	}
+	name := safeFileName(doc.Title)
+	if name == "" {
+		name = "Untitled"
+	}
+	if n := names[strings.ToLower(name)]; n > 0 {
+		names[strings.ToLower(name)]++
+		name = fmt.Sprintf("%s %d", name, n+1)
+	} else {
+		names[strings.ToLower(name)] = 1
+	}
+	author := detectAuthor(doc.Root)
+	if author == "" {
+		author = defaultAuthor
+	}
+	return &convertPage{
+		Document: doc,
+		Slug:     slug,
+		Name:     name,
+		Date:     exportDate(doc.TarPath),
+		Author:   author,
+		Tags:     tags,
+	}
+}
+
+// writeConvertedPage writes a page and its images using the target layout
+// and returns the markdown path
+func writeConvertedPage(outDir string, tgt convertTarget, p *convertPage, opts convertOptions) (string, error) {
+	file, imageDir := tgt.page(p)
+	file = filepath.Join(outDir, file)
+
+	mdOpts := markdownOptions{
+		Image: func(n *Node) (string, bool) {
+			name, ok := strings.CutPrefix(n.URL, "images/")
+			if !ok {
+				return "", false
+			}
+			ref := tgt.imageURL(p, path.Base(name))
+			if tgt.embed != nil {
+				return tgt.embed(ref, n.Alt), true
+			}
+			return "![" + escapeMarkdownText(n.Alt, false) + "](" + markdownDestination(ref, n.Title) + ")", true
+		},
+		Callout: tgt.callout,
+	}
+	if tgt.pageLink != nil && opts.Pages != nil {
+		mdOpts.Link = func(n *Node) (string, bool) {
+			target := opts.Pages.find(n.URL, nodeText(n))
+			if target == nil || target == p {
+				return "", false
+			}
+			return tgt.pageLink(target, nodeText(n)), true
+		}
+	}
+	body := renderMarkdown(p.Root, mdOpts)
+
+	var sb strings.Builder
+	if opts.FrontMatter {
+		fm := tgt.frontMatter(p, opts.Fields)
+		keys := make([]string, 0, len(opts.Extra))
+		for k := range opts.Extra {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fm = append(fm, yamlField{Key: k, Value: yamlValue(opts.Extra[k])})
+		}
+		if tgt.writeFrontMatter != nil {
+			tgt.writeFrontMatter(&sb, fm)
+		} else {
+			sb.WriteString("---\n")
+			writeYAML(&sb, fm, "")
+			sb.WriteString("---\n\n")
+		}
+	}
+	sb.WriteString(body)
+
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return "", fmt.Errorf("create %s: %w", filepath.Dir(file), err)
+	}
+	if err := os.WriteFile(file, []byte(sb.String()), 0644); err != nil {
+		return "", fmt.Errorf("write %s: %w", file, err)
+	}
+	if err := writeImages(filepath.Join(outDir, imageDir), p.Images); err != nil {
+		return "", err
+	}
+	return file, nil
+}
+
+// writeExportedPage renders a page in another format to <slug>/<slug><ext>
+// and writes its images where the format refers to them
+func writeExportedPage(outDir string, exp exportFormat, p *convertPage, opts exportOptions) (string, error) {
+	dir := filepath.Join(outDir, p.Slug)
+	file := filepath.Join(dir, p.Slug+exp.ext)
+	data, err := exp.render(p.Document, opts)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", p.TarFile, err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("create %s: %w", dir, err)
+	}
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		return "", fmt.Errorf("write %s: %w", file, err)
+	}
+	if exp.imageDir != "" {
+		if err := writeImages(filepath.Join(dir, exp.imageDir), p.Images); err != nil {
+			return "", err
+		}
+	}
+	return file, nil
+}
+
+// pageIndex finds converted pages by source URL or title
+type pageIndex struct {
+	byURL   map[string]*convertPage
+	byTitle map[string]*convertPage
+}
+
+func newPageIndex(pages []*convertPage) *pageIndex {
+	idx := &pageIndex{
+		byURL:   make(map[string]*convertPage),
+		byTitle: make(map[string]*convertPage),
+	}
+	for _, p := range pages {
+		if key := pageURLKey(p.SourceURL); key != "" {
+			idx.byURL[key] = p
+		}
+		title := strings.ToLower(p.Title)
+		if _, dup := idx.byTitle[title]; !dup {
+			idx.byTitle[title] = p
+		}
+	}
+	return idx
+}
+
+// find returns the page a link points at. Exports record their source URL
+// in metadata.json; older exports fall back to Loop links whose text is a
+// page title, which is how Loop renders page links.
+func (idx *pageIndex) find(rawURL, text string) *convertPage {
+	if p := idx.byURL[pageURLKey(rawURL)]; p != nil {
+		return p
+	}
+	if !isLoopURL(rawURL) {
+		return nil
+	}
+	return idx.byTitle[strings.ToLower(strings.TrimSpace(text))]
+}
+
+// pageURLKey reduces a URL to host and path, which identify a Loop page
+func pageURLKey(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	return strings.ToLower(u.Host) + strings.TrimSuffix(u.Path, "/")
+}
+
+// isLoopURL reports whether a URL points at Loop or a SharePoint-hosted page
+func isLoopURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	return strings.HasPrefix(host, "loop.") || strings.HasSuffix(host, ".sharepoint.com")
+}
+
+// reUnsafeFileChars matches characters not allowed in file names on
+// Windows, macOS or Linux, plus those with meaning inside wiki links
+var reUnsafeFileChars = regexp.MustCompile(`[<>:"/\\|?*#^\[\]\x00-\x1f]`)
+
+// safeFileName makes a page title usable as a file name
+func safeFileName(title string) string {
+	name := reUnsafeFileChars.ReplaceAllString(title, "-")
+	name = strings.Join(strings.Fields(name), " ")
+	return strings.Trim(name, ". ")
+}
+
+// ============================================================
+// Export Metadata
+// ============================================================
+
+var (
+	// reExportStamp matches the "2026-01-28 at 1.39 PM" stamp in download names
+	reExportStamp = regexp.MustCompile(`(\d{4}-\d{2}-\d{2}) at (\d{1,2}\.\d{2})\s*([AP]M)`)
+	// reExportMillis matches the loop_export_<ms> names of unpacked exports
+	reExportMillis = regexp.MustCompile(`loop_export_(\d{13})`)
+)
+
+// exportDate reads the export time from the tar filename, falling back to
+// the file's modification time
+func exportDate(tarPath string) time.Time {
+	name := filepath.Base(tarPath)
+	if m := reExportStamp.FindStringSubmatch(name); m != nil {
+		if t, err := time.ParseInLocation("2006-01-02 3.04 PM", m[1]+" "+m[2]+" "+m[3], time.Local); err == nil {
+			return t
+		}
+	}
+	if m := reExportMillis.FindStringSubmatch(name); m != nil {
+		if ms, err := strconv.ParseInt(m[1], 10, 64); err == nil {
+			return time.UnixMilli(ms)
+		}
+	}
+	if info, err := os.Stat(tarPath); err == nil {
+		return info.ModTime()
+	}
+	return time.Time{}
+}
+
+// detectAuthor finds a byline such as "Jane Doe - Team - Jan 16, 2026" in
+// the first paragraph before any heading
+func detectAuthor(root *Node) string {
+	for _, n := range root.Children {
+		if n.Type == "heading" {
+			return ""
+		}
+		if n.Type != "paragraph" {
+			continue
+		}
+		line := strings.TrimSpace(nodeText(n))
+		if strings.Contains(line, "\n") {
+			return ""
+		}
+		name, _, _ := strings.Cut(line, " - ")
+		name = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(name), "By "))
+		if looksLikeName(name) {
+			return name
+		}
+		return ""
+	}
+	return ""
+}
+
+// looksLikeName reports whether s is two to four capitalized words
+func looksLikeName(s string) bool {
+	words := strings.Fields(s)
+	if len(words) < 2 || len(words) > 4 {
+		return false
+	}
+	for _, w := range words {
+		r := []rune(w)
+		if !unicode.IsUpper(r[0]) {
+			return false
+		}
+		for _, c := range r {
+			if !unicode.IsLetter(c) && c != '.' && c != '-' && c != '\'' {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// ============================================================
+// YAML Front Matter
+// ============================================================
+
+// yamlField is one front matter entry. Value is a string, yamlRaw,
+// time.Time, []string or nested []yamlField.
+type yamlField struct {
+	Key   string
+	Value interface{}
+}
+
+// yamlRaw is a scalar written without quoting
+type yamlRaw string
+
+// reYAMLNumber matches numbers that YAML 1.1 and 1.2 parsers both read
+// as decimal: no leading zeros (octal in 1.1), exponents, inf or nan
+var reYAMLNumber = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?$`)
+
+// yamlValue keeps booleans and plain decimal numbers from --set unquoted.
+// Everything else stays a string, which writeYAML double-quotes, so
+// values like yes, null, ~ or 2026-01-28 are not read as other types.
+func yamlValue(s string) interface{} {
+	if s == "true" || s == "false" || reYAMLNumber.MatchString(s) {
+		return yamlRaw(s)
+	}
+	return s
+}
+
+// writeYAML writes fields as block YAML, quoting strings as JSON (a YAML
+// subset) so titles with colons or quotes stay valid
+func writeYAML(sb *strings.Builder, fields []yamlField, indent string) {
+	for _, f := range fields {
+		switch v := f.Value.(type) {
+		case []yamlField:
+			fmt.Fprintf(sb, "%s%s:\n", indent, f.Key)
+			writeYAML(sb, v, indent+"  ")
+		case time.Time:
+			fmt.Fprintf(sb, "%s%s: %s\n", indent, f.Key, v.Format(time.RFC3339))
+		case yamlRaw:
+			fmt.Fprintf(sb, "%s%s: %s\n", indent, f.Key, v)
+		default:
+			data, _ := json.Marshal(v)
+			fmt.Fprintf(sb, "%s%s: %s\n", indent, f.Key, data)
+		}
+	}
+}
+
+// ============================================================
+// Output Formats
+// ============================================================
+
+// exportFormat renders a document to a markup other than markdown
+type exportFormat struct {
+	ext      string
+	mime     string
+	imageDir string // where images go, relative to the page; "" skips them
+	render   func(doc *Document, opts exportOptions) ([]byte, error)
+	// book binds several exports into one file; nil if the format is one
+	// page per file
+	book func(title string, docs []*Document) ([]byte, error)
+}
+
+// exportOptions are settings that only some formats use
+type exportOptions struct {
+	TOC bool // add a table of contents
+}
+
+// exportFormats are served by `loopd convert --format` and /api/export/<name>,
+// registered in init functions
+var exportFormats = map[string]exportFormat{}
+
+// exportFormatNames lists markdown and the registered formats
+func exportFormatNames() []string {
+	names := []string{"markdown"}
+	for name := range exportFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names[1:])
+	return names
+}
+
+// handleExport renders the loaded export in the format named by the path,
+// e.g. /api/export/confluence. Add ?download=1 to save it as a file and
+// ?toc=1 for a table of contents where the format has one.
+// Formats that bind books take ?file= (repeatable) to pick exports from
+// the library instead, and ?title= to name the book.
+func handleExport(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/api/export/")
+	format, ok := exportFormats[name]
+	if !ok {
+		http.Error(w, "Unknown export format", 404)
+		return
+	}
+
+	if files := r.URL.Query()["file"]; len(files) > 0 {
+		handleExportBook(w, r, format, files)
+		return
+	}
+
+	contentMu.RLock()
+	content := currentContent
+	contentMu.RUnlock()
+
+	if content == nil {
+		http.Error(w, "No content loaded", 404)
+		return
+	}
+
+	opts := exportOptions{TOC: r.URL.Query().Get("toc") != ""}
+	key := "export/" + name
+	if opts.TOC {
+		key += "?toc"
+	}
+	rep, err := cachedRepresentation(content, key, func(h http.Header) ([]byte, error) {
+		h.Set("Content-Type", format.mime)
+		return format.render(newDocument(content), opts)
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Export failed: %v", err), 500)
+		return
+	}
+
+	if r.URL.Query().Get("download") != "" {
+		filename := exportTitle(content.TarFile) + format.ext
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	}
+	serveRepresentation(w, r, rep)
+}
+
+// handleExportBook binds exports from the library into one file
+func handleExportBook(w http.ResponseWriter, r *http.Request, format exportFormat, files []string) {
+	if format.book == nil {
+		http.Error(w, "Format does not support multiple exports", 400)
+		return
+	}
+	for _, f := range files {
+		if _, err := libraryPath(f); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+	}
+	contents, err := readLibraryExports(files)
+	if err != nil {
+		http.Error(w, err.Error(), 404)
+		return
+	}
+	docs := make([]*Document, len(contents))
+	for i, c := range contents {
+		docs[i] = newDocument(c)
+	}
+
+	title := r.URL.Query().Get("title")
+	data, err := format.book(title, docs)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Export failed: %v", err), 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", format.mime)
+	if r.URL.Query().Get("download") != "" {
+		if title == "" {
+			title = bookTitle(docs)
+		}
+		filename := safeFileName(title) + format.ext
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	}
+	w.Write(data)
+}
+
+// bookTitle names a book after its only page, or generically
+func bookTitle(docs []*Document) string {
+	if len(docs) == 1 {
+		return docs[0].Title
+	}
+	return "Loop Pages"
+}
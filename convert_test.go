@@ -0,0 +1,65 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestYAMLValue(t *testing.T) {
+	tests := []struct {
+		in   string
+		want interface{}
+	}{
+		{"true", yamlRaw("true")},
+		{"false", yamlRaw("false")},
+		{"42", yamlRaw("42")},
+		{"-3", yamlRaw("-3")},
+		{"1.0", yamlRaw("1.0")},
+		{"0", yamlRaw("0")},
+		{"yes", "yes"},
+		{"no", "no"},
+		{"on", "on"},
+		{"True", "True"},
+		{"t", "t"},
+		{"null", "null"},
+		{"~", "~"},
+		{"", ""},
+		{"007", "007"},
+		{"1e5", "1e5"},
+		{"inf", "inf"},
+		{"NaN", "NaN"},
+		{"0x10", "0x10"},
+		{"2026-01-28", "2026-01-28"},
+		{"Release notes", "Release notes"},
+	}
+	for _, tt := range tests {
+		if got := yamlValue(tt.in); got != tt.want {
+			t.Errorf("yamlValue(%q) = %#v; want %#v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestWriteYAMLQuotesStrings(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  string
+	}{
+		{"yes", `title: "yes"`},
+		{"no", `title: "no"`},
+		{"null", `title: "null"`},
+		{"~", `title: "~"`},
+		{"1.0", `title: "1.0"`},
+		{"2026-01-28", `title: "2026-01-28"`},
+		{"", `title: ""`},
+		{`Say "hi": C:\temp`, `title: "Say \"hi\": C:\\temp"`},
+		{yamlValue("3"), `title: 3`},
+		{yamlValue("false"), `title: false`},
+	}
+	for _, tt := range tests {
+		var sb strings.Builder
+		writeYAML(&sb, []yamlField{{Key: "title", Value: tt.value}}, "")
+		if got := strings.TrimSuffix(sb.String(), "\n"); got != tt.want {
+			t.Errorf("writeYAML(%#v) = %s; want %s", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,583 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// ============================================================
+// Background Daemon
+// ============================================================
+//
+// `loopd daemon start` runs the server headless in the background. The
+// daemon writes its PID to loopd.pid and serves a small HTTP API on the
+// run/loopd.sock Unix domain socket in the config directory: status, load,
+// reload, cd, shutdown, and an event stream of the log. `loopd --attach`
+// runs the TUI against that API instead of starting its own server and
+// watcher, and quitting the TUI leaves the daemon running.
+
+func init() {
+	subcommands["daemon"] = subcommand{
+		usage:   "start|stop|status [server options]",
+		summary: "Run the preview server in the background",
+		run:     runDaemon,
+	}
+}
+
+// daemonPath returns a file in the config directory used by the daemon
+func daemonPath(name string) string {
+	return filepath.Join(getConfigDir(), name)
+}
+
+var (
+	daemonSocket = daemonPath(filepath.Join("run", "loopd.sock"))
+	daemonPID    = daemonPath("loopd.pid")
+	daemonLog    = daemonPath("daemon.log")
+)
+
+// DaemonStatus describes a running daemon
+type DaemonStatus struct {
+	PID      int           `json:"pid"`
+	Version  string        `json:"version"`
+	Started  time.Time     `json:"started"`
+	URL      string        `json:"url"`
+	Token    string        `json:"token"`
+	Network  []string      `json:"network,omitempty"`
+	Bound    string        `json:"bound"`
+	WatchDir string        `json:"watch_dir"`
+	Loaded   *LoadedExport `json:"loaded,omitempty"`
+}
+
+// LoadedExport summarizes the export being served
+type LoadedExport struct {
+	File     string    `json:"file"`
+	Path     string    `json:"path"`
+	Bytes    int       `json:"bytes"`
+	Images   int       `json:"images"`
+	LoadedAt time.Time `json:"loaded_at"`
+}
+
+// loadedExport summarizes content, or returns nil if nothing is loaded
+func loadedExport(content *Content) *LoadedExport {
+	if content == nil {
+		return nil
+	}
+	return &LoadedExport{
+		File:     content.TarFile,
+		Path:     content.TarPath,
+		Bytes:    len(content.Markdown),
+		Images:   len(content.Images),
+		LoadedAt: content.LoadedAt,
+	}
+}
+
+// ------------------------------------------------------------
+// Control server (runs inside the daemon)
+// ------------------------------------------------------------
+
+// controlServer serves the daemon API
+type controlServer struct {
+	status DaemonStatus // fixed fields; watch dir and loaded export are filled per request
+}
+
+// startControl opens the control socket and PID file for a daemon serving
+// url. Both are removed on shutdown.
+func startControl(url string, network []string, bound string) error {
+	if st, err := newDaemonClient().status(); err == nil {
+		return fmt.Errorf("a loopd daemon is already running (pid %d)", st.PID)
+	}
+	os.Remove(daemonSocket) // left behind by a daemon that was killed
+	if err := os.MkdirAll(filepath.Dir(daemonSocket), 0700); err != nil {
+		return err
+	}
+	listener, err := listenControl(daemonSocket)
+	if err != nil {
+		return fmt.Errorf("control socket: %w", err)
+	}
+	if err := os.WriteFile(daemonPID, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644); err != nil {
+		listener.Close()
+		return fmt.Errorf("write PID file: %w", err)
+	}
+
+	cs := &controlServer{
+		status: DaemonStatus{
+			PID:     os.Getpid(),
+			Version: version,
+			Started: time.Now(),
+			URL:     url,
+			Token:   sessionToken,
+			Network: network,
+			Bound:   bound,
+		},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", cs.handleStatus)
+	mux.HandleFunc("POST /load", cs.handleLoad)
+	mux.HandleFunc("POST /reload", cs.handleReload)
+	mux.HandleFunc("POST /cd", cs.handleCd)
+	mux.HandleFunc("POST /shutdown", cs.handleShutdown)
+	mux.HandleFunc("GET /events", cs.handleEvents)
+
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+
+	app.onShutdown(func() {
+		server.Close()
+		os.Remove(daemonSocket)
+		os.Remove(daemonPID)
+	})
+	return nil
+}
+
+// currentStatus fills in the parts of the status that change
+func (cs *controlServer) currentStatus() DaemonStatus {
+	st := cs.status
+	st.WatchDir = getLibraryDir()
+	contentMu.RLock()
+	st.Loaded = loadedExport(currentContent)
+	contentMu.RUnlock()
+	return st
+}
+
+// controlRequest is the body of load and cd requests
+type controlRequest struct {
+	Path string `json:"path"`
+}
+
+// controlResult reports the outcome of a control request
+type controlResult struct {
+	Message string `json:"message"`
+}
+
+func writeControlResult(w http.ResponseWriter, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(controlResult{Message: message})
+}
+
+func (cs *controlServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cs.currentStatus())
+}
+
+func (cs *controlServer) handleLoad(w http.ResponseWriter, r *http.Request) {
+	var req controlRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Path == "" {
+		http.Error(w, "Body must be {\"path\": \"...\"}", 400)
+		return
+	}
+	path, err := filepath.Abs(expandHome(req.Path))
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	if _, err := os.Stat(path); err != nil {
+		http.Error(w, fmt.Sprintf("File not found: %s", path), 404)
+		return
+	}
+	if err := loadTar(path); err != nil {
+		http.Error(w, err.Error(), 422)
+		return
+	}
+	writeControlResult(w, "Loaded: "+filepath.Base(path))
+}
+
+func (cs *controlServer) handleReload(w http.ResponseWriter, r *http.Request) {
+	contentMu.RLock()
+	content := currentContent
+	contentMu.RUnlock()
+
+	if content == nil {
+		http.Error(w, "No content to reload", 404)
+		return
+	}
+	if err := loadTar(content.TarPath); err != nil {
+		http.Error(w, err.Error(), 422)
+		return
+	}
+	writeControlResult(w, "Reloaded: "+content.TarFile)
+}
+
+func (cs *controlServer) handleCd(w http.ResponseWriter, r *http.Request) {
+	var req controlRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Path == "" {
+		http.Error(w, "Body must be {\"path\": \"...\"}", 400)
+		return
+	}
+	dir, err := filepath.Abs(expandHome(req.Path))
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		http.Error(w, fmt.Sprintf("Not a directory: %s", dir), 404)
+		return
+	}
+	setLibraryDir(dir)
+	app.watch(dir)
+	logSuccess(fmt.Sprintf("Watch directory changed to: %s", dir))
+	writeControlResult(w, "Watching: "+dir)
+}
+
+func (cs *controlServer) handleShutdown(w http.ResponseWriter, r *http.Request) {
+	writeControlResult(w, "Shutting down")
+	slog.Info("Shutdown requested over the control socket")
+	go app.cancel()
+}
+
+// handleEvents streams log messages as JSON lines until the client goes
+// away or the daemon stops
+func (cs *controlServer) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", 500)
+		return
+	}
+	q := subscribeLogs()
+	defer unsubscribeLogs(q)
+	metrics.subscribers.Add(1)
+	defer metrics.subscribers.Add(-1)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-r.Context().Done():
+		case <-app.Done():
+		}
+		close(done)
+	}()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	flusher.Flush()
+	enc := json.NewEncoder(w)
+	for {
+		msg, ok := q.next(done)
+		if !ok {
+			return
+		}
+		enc.Encode(controlEvent{Text: msg.text, Style: msg.style})
+		flusher.Flush()
+	}
+}
+
+// controlEvent is one log message on the event stream
+type controlEvent struct {
+	Text  string `json:"text"`
+	Style string `json:"style"`
+}
+
+// ------------------------------------------------------------
+// Control client
+// ------------------------------------------------------------
+
+// daemonClient talks to a running daemon over its control socket
+type daemonClient struct {
+	http *http.Client
+}
+
+func newDaemonClient() *daemonClient {
+	return &daemonClient{http: &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", daemonSocket)
+			},
+		},
+	}}
+}
+
+// call sends a control request and decodes the JSON response into out
+func (c *daemonClient) call(method, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = strings.NewReader(string(data))
+	}
+	// Status answers at once; loads can take a while
+	timeout := 2 * time.Second
+	if method != "GET" {
+		timeout = time.Minute
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, "http://loopd"+path, reader)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(resp.Body)
+		return errors.New(strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (c *daemonClient) status() (*DaemonStatus, error) {
+	var st DaemonStatus
+	if err := c.call("GET", "/status", nil, &st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// do runs a command that returns a message, such as load or cd
+func (c *daemonClient) do(command, path string) (string, error) {
+	var body any
+	if path != "" {
+		body = controlRequest{Path: path}
+	}
+	var res controlResult
+	err := c.call("POST", "/"+command, body, &res)
+	return res.Message, err
+}
+
+// follow copies the daemon's event stream to ch until ctx ends or the
+// daemon stops
+func (c *daemonClient) follow(ctx context.Context, q *logQueue) {
+	req, err := http.NewRequestWithContext(ctx, "GET", "http://loopd/events", nil)
+	if err != nil {
+		return
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		q.push(logMsg{text: fmt.Sprintf("Event stream: %v", err), style: "error"})
+		return
+	}
+	defer resp.Body.Close()
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var ev controlEvent
+		if json.Unmarshal(scanner.Bytes(), &ev) == nil {
+			q.push(logMsg{text: ev.Text, style: ev.Style})
+		}
+	}
+	if ctx.Err() == nil {
+		q.push(logMsg{text: "Daemon stopped", style: "warn"})
+	}
+}
+
+// ------------------------------------------------------------
+// TUI attachment
+// ------------------------------------------------------------
+
+// daemonStatusMsg carries a status poll result to the TUI
+type daemonStatusMsg struct {
+	status *DaemonStatus
+}
+
+// statusCmd polls the daemon for the TUI's status bar
+func (c *daemonClient) statusCmd() tea.Cmd {
+	return func() tea.Msg {
+		st, _ := c.status()
+		return daemonStatusMsg{status: st}
+	}
+}
+
+// commandCmd runs a daemon command, logging only failures; the daemon's
+// own log reports success
+func (c *daemonClient) commandCmd(command, path string) tea.Cmd {
+	return func() tea.Msg {
+		if _, err := c.do(command, path); err != nil {
+			return logMsg{text: err.Error(), style: "error"}
+		}
+		return nil
+	}
+}
+
+// runAttached runs the TUI against a running daemon
+func runAttached() error {
+	client := newDaemonClient()
+	st, err := client.status()
+	if err != nil {
+		return fmt.Errorf("no loopd daemon is running; start one with: %s daemon start", appName)
+	}
+	sessionToken = st.Token
+	setLibraryDir(st.WatchDir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// The daemon already writes the log file; the TUI only shows what
+	// it follows from the daemon
+	logCfg := globalConfig.Log
+	logCfg.File = ""
+	closeLog, err := setupLogging(logCfg, false)
+	if err != nil {
+		return err
+	}
+	defer closeLog()
+	events := subscribeLogs()
+	go client.follow(ctx, events)
+
+	m := initialModel(st.URL, st.Network, st.Bound, st.WatchDir, events)
+	m.daemon = client
+	m.remote = st
+	m.addLog(fmt.Sprintf("Attached to loopd daemon (pid %d); /quit leaves it running", st.PID), "info")
+	_, err = tea.NewProgram(m, tea.WithAltScreen()).Run()
+	return err
+}
+
+// ------------------------------------------------------------
+// loopd daemon start|stop|status
+// ------------------------------------------------------------
+
+func runDaemon(args []string) error {
+	if helpRequested("daemon", args) {
+		return flag.ErrHelp
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("usage: %s daemon %s", appName, subcommands["daemon"].usage)
+	}
+	switch args[0] {
+	case "start":
+		return daemonStart(args[1:])
+	case "stop":
+		return daemonStop()
+	case "status":
+		return daemonStatus()
+	default:
+		return fmt.Errorf("unknown daemon command %q (want start, stop or status)", args[0])
+	}
+}
+
+// daemonStart launches `loopd --daemon` detached, passing server options
+// through, and waits for its control socket to answer
+func daemonStart(args []string) error {
+	client := newDaemonClient()
+	if st, err := client.status(); err == nil {
+		return fmt.Errorf("already running (pid %d) at %s", st.PID, st.URL)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(daemonLog), 0700); err != nil {
+		return err
+	}
+	logFile, err := os.OpenFile(daemonLog, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("open daemon log: %w", err)
+	}
+	defer logFile.Close()
+
+	cmd := exec.Command(exe, append([]string{"--daemon"}, args...)...)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	cmd.SysProcAttr = detachAttr()
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("start daemon: %w", err)
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	deadline := time.After(10 * time.Second)
+	for {
+		select {
+		case <-exited:
+			return fmt.Errorf("daemon exited during startup; see %s", daemonLog)
+		case <-deadline:
+			return fmt.Errorf("daemon did not answer within 10s; see %s", daemonLog)
+		case <-time.After(100 * time.Millisecond):
+		}
+		st, err := client.status()
+		if err != nil {
+			continue
+		}
+		successStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#10B981")).Bold(true)
+		pathStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#FBBF24"))
+		fmt.Println(successStyle.Render(fmt.Sprintf("✓ loopd daemon started (pid %d)", st.PID)))
+		printDaemonStatus(st)
+		fmt.Printf("  Log:      %s\n", pathStyle.Render(daemonLog))
+		return nil
+	}
+}
+
+// daemonStop asks the daemon to shut down, falling back to signalling the
+// PID in loopd.pid when the socket does not answer
+func daemonStop() error {
+	client := newDaemonClient()
+	successStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#10B981")).Bold(true)
+
+	pid := 0
+	if st, err := client.status(); err == nil {
+		pid = st.PID
+		if _, err := client.do("shutdown", ""); err != nil {
+			return fmt.Errorf("shutdown: %w", err)
+		}
+	} else {
+		data, err := os.ReadFile(daemonPID)
+		if err != nil {
+			return errors.New("loopd daemon is not running")
+		}
+		pid, _ = strconv.Atoi(strings.TrimSpace(string(data)))
+		if pid == 0 || !processAlive(pid) {
+			os.Remove(daemonPID)
+			os.Remove(daemonSocket)
+			return errors.New("loopd daemon is not running (removed stale PID file)")
+		}
+		if err := terminateProcess(pid); err != nil {
+			return fmt.Errorf("stop pid %d: %w", pid, err)
+		}
+	}
+
+	deadline := time.Now().Add(shutdownTimeout + 2*time.Second)
+	for processAlive(pid) {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("pid %d is still running", pid)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	fmt.Println(successStyle.Render(fmt.Sprintf("✓ loopd daemon stopped (pid %d)", pid)))
+	return nil
+}
+
+// daemonStatus prints the running daemon's status
+func daemonStatus() error {
+	st, err := newDaemonClient().status()
+	if err != nil {
+		return errors.New("loopd daemon is not running")
+	}
+	successStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#10B981")).Bold(true)
+	fmt.Println(successStyle.Render(fmt.Sprintf("● loopd daemon running (pid %d, v%s, up %s)",
+		st.PID, st.Version, time.Since(st.Started).Round(time.Second))))
+	printDaemonStatus(st)
+	return nil
+}
+
+// printDaemonStatus prints a daemon's addresses and loaded export
+func printDaemonStatus(st *DaemonStatus) {
+	pathStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#FBBF24"))
+	fmt.Printf("  Preview:  %s\n", pathStyle.Render(st.URL+"?token="+st.Token))
+	for _, u := range st.Network {
+		fmt.Printf("  Network:  %s\n", pathStyle.Render(u+"?token="+st.Token))
+	}
+	fmt.Printf("  Watching: %s\n", pathStyle.Render(st.WatchDir))
+	if st.Loaded != nil {
+		fmt.Printf("  Loaded:   %s (%s, %d images, %s)\n", pathStyle.Render(st.Loaded.File),
+			formatSize(st.Loaded.Bytes), st.Loaded.Images, st.Loaded.LoadedAt.Format("15:04:05"))
+	}
+}
@@ -0,0 +1,53 @@
+//go:build !windows
+
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// detachAttr starts the daemon in its own session so it outlives the
+// terminal that started it
+func detachAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setsid: true}
+}
+
+// processAlive reports whether pid is a running process
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return p.Signal(syscall.Signal(0)) == nil
+}
+
+// terminateProcess asks pid to shut down gracefully
+func terminateProcess(pid int) error {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return p.Signal(syscall.SIGTERM)
+}
+
+// listenControl opens the control socket inside a directory only its
+// owner can enter, so no other user can reach the daemon between the
+// socket's creation and its chmod. The process umask is left alone since
+// other goroutines create files at the same time.
+func listenControl(path string) (net.Listener, error) {
+	if err := os.Chmod(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
@@ -0,0 +1,51 @@
+//go:build windows
+
+package main
+
+import (
+	"net"
+	"os"
+	"syscall"
+)
+
+const (
+	createNewProcessGroup = 0x00000200
+	detachedProcess       = 0x00000008
+)
+
+// detachAttr starts the daemon without a console so it outlives the
+// terminal that started it
+func detachAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{
+		CreationFlags: createNewProcessGroup | detachedProcess,
+		HideWindow:    true,
+	}
+}
+
+// processAlive reports whether pid is a running process
+func processAlive(pid int) bool {
+	const stillActive = 259
+	h, err := syscall.OpenProcess(syscall.PROCESS_QUERY_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return false
+	}
+	defer syscall.CloseHandle(h)
+	var code uint32
+	return syscall.GetExitCodeProcess(h, &code) == nil && code == stillActive
+}
+
+// terminateProcess stops pid. Windows has no SIGTERM, so this is only
+// used when the control socket does not answer.
+func terminateProcess(pid int) error {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return p.Kill()
+}
+
+// listenControl opens the control socket, which Windows creates with the
+// owner's default ACL
+func listenControl(path string) (net.Listener, error) {
+	return net.Listen("unix", path)
+}
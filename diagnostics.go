@@ -0,0 +1,263 @@
+package main
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ============================================================
+// Exporter Diagnostics
+// ============================================================
+//
+// loopd.js records every data-automation-type in the Loop DOM, with counts
+// and sample elements, in automation-types.json. Comparing those with the
+// components the exporter knows how to convert shows which parts of Loop
+// pages are being dropped.
+
+// AutomationType is one data-automation-type value seen in a Loop page
+type AutomationType struct {
+	Count   int                `json:"count"`
+	Samples []AutomationSample `json:"samples,omitempty"`
+}
+
+// AutomationSample is an element loopd.js saw with an automation type
+type AutomationSample struct {
+	Tag       string `json:"tag"`
+	ClassName string `json:"className"`
+	Text      string `json:"text"`
+}
+
+// componentStatus says what the exporter does with known components:
+// "converted" into markdown or "ignored" as editor chrome. Anything else
+// is unhandled.
+var componentStatus = map[string]string{
+	"Title":                         "converted",
+	"RichText":                      "converted",
+	"Tablero":                       "converted",
+	"user-data-table":               "converted",
+	"BlockContextMenuButton":        "ignored",
+	"column-grabber-table":          "ignored",
+	"table-cell-presence-indicator": "ignored",
+	"table-column-resize-element":   "ignored",
+}
+
+// classifyComponent mirrors loopd.js, which also converts any automation
+// type naming a heading or code
+func classifyComponent(name string) string {
+	if status, ok := componentStatus[name]; ok {
+		return status
+	}
+	lower := strings.ToLower(name)
+	if strings.Contains(lower, "heading") || strings.Contains(lower, "code") {
+		return "converted"
+	}
+	return "unhandled"
+}
+
+// ComponentStat is a component's totals across exports
+type ComponentStat struct {
+	Name    string           `json:"name"`
+	Status  string           `json:"status"` // converted, ignored or unhandled
+	Count   int              `json:"count"`
+	Exports []string         `json:"exports"`
+	Sample  AutomationSample `json:"sample"` // the first sample with text, if any
+}
+
+// DiagnosticsReport aggregates automation types across exports
+type DiagnosticsReport struct {
+	Exports    int             `json:"exports"`    // exports with automation-types.json
+	Unhandled  int             `json:"unhandled"`  // distinct unhandled components
+	Components []ComponentStat `json:"components"` // unhandled first, then by count
+}
+
+// newDiagnosticsReport merges the automation types of several exports,
+// keyed by file name
+func newDiagnosticsReport(exports map[string]map[string]AutomationType) *DiagnosticsReport {
+	stats := make(map[string]*ComponentStat)
+	files := make([]string, 0, len(exports))
+	for file := range exports {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	report := &DiagnosticsReport{Components: []ComponentStat{}}
+	for _, file := range files {
+		types := exports[file]
+		if len(types) == 0 {
+			continue
+		}
+		report.Exports++
+		for name, t := range types {
+			s, ok := stats[name]
+			if !ok {
+				s = &ComponentStat{Name: name, Status: classifyComponent(name), Exports: []string{}}
+				stats[name] = s
+			}
+			s.Count += t.Count
+			s.Exports = append(s.Exports, file)
+			for _, sample := range t.Samples {
+				if s.Sample.Tag == "" || (s.Sample.Text == "" && strings.TrimSpace(sample.Text) != "") {
+					s.Sample = sample
+				}
+			}
+		}
+	}
+	for _, s := range stats {
+		s.Sample.Text = truncateContext(strings.Join(strings.Fields(s.Sample.Text), " "), false)
+		if s.Status == "unhandled" {
+			report.Unhandled++
+		}
+		report.Components = append(report.Components, *s)
+	}
+	sort.Slice(report.Components, func(i, j int) bool {
+		a, b := report.Components[i], report.Components[j]
+		if (a.Status == "unhandled") != (b.Status == "unhandled") {
+			return a.Status == "unhandled"
+		}
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Name < b.Name
+	})
+	return report
+}
+
+// unhandledNames lists a report's unhandled components, most frequent first
+func (r *DiagnosticsReport) unhandledNames() []string {
+	var names []string
+	for _, c := range r.Components {
+		if c.Status == "unhandled" {
+			names = append(names, fmt.Sprintf("%s (%d)", c.Name, c.Count))
+		}
+	}
+	return names
+}
+
+// automationCache keeps each library export's automation types until the
+// file changes
+var (
+	automationCache   = make(map[string]cachedAutomationTypes)
+	automationCacheMu sync.Mutex
+)
+
+type cachedAutomationTypes struct {
+	modTime time.Time
+	types   map[string]AutomationType
+}
+
+// readAutomationTypes reads only automation-types.json from an export
+func readAutomationTypes(path string) (map[string]AutomationType, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	automationCacheMu.Lock()
+	cached, ok := automationCache[path]
+	automationCacheMu.Unlock()
+	if ok && cached.modTime.Equal(info.ModTime()) {
+		return cached.types, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open tar: %w", err)
+	}
+	defer f.Close()
+	var types map[string]AutomationType
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("tar read: %w", err)
+		}
+		if hdr.Name != "automation-types.json" {
+			continue
+		}
+		if err := json.NewDecoder(tr).Decode(&types); err != nil {
+			return nil, fmt.Errorf("parse automation-types.json: %w", err)
+		}
+		break
+	}
+
+	automationCacheMu.Lock()
+	automationCache[path] = cachedAutomationTypes{info.ModTime(), types}
+	automationCacheMu.Unlock()
+	return types, nil
+}
+
+// libraryDiagnostics aggregates the automation types of every export in
+// the watch directory and the loaded page
+func libraryDiagnostics() (*DiagnosticsReport, error) {
+	paths, err := listExports(getLibraryDir())
+	if err != nil {
+		return nil, err
+	}
+	exports := make(map[string]map[string]AutomationType)
+	for _, p := range paths {
+		types, err := readAutomationTypes(p)
+		if err != nil {
+			continue // not every .tar in the folder is an export
+		}
+		exports[filepath.Base(p)] = types
+	}
+	contentMu.RLock()
+	if c := currentContent; c != nil && c.AutomationTypes != nil {
+		exports[c.TarFile] = c.AutomationTypes
+	}
+	contentMu.RUnlock()
+	return newDiagnosticsReport(exports), nil
+}
+
+// logDiagnostics notes a freshly loaded page's unhandled components in the
+// TUI log
+func logDiagnostics(content *Content) {
+	if content.AutomationTypes == nil {
+		return
+	}
+	report := newDiagnosticsReport(map[string]map[string]AutomationType{content.TarFile: content.AutomationTypes})
+	if report.Unhandled == 0 {
+		return
+	}
+	slog.Warn(fmt.Sprintf("Diagnostics: %d unhandled Loop %s: %s (see /api/diagnostics)",
+		report.Unhandled, plural(report.Unhandled, "component", "components"), strings.Join(report.unhandledNames(), ", ")),
+		"file", content.TarFile, "unhandled", report.Unhandled)
+}
+
+// handleDiagnostics reports automation types across the library, or for
+// the loaded page alone with ?loaded=1
+func handleDiagnostics(w http.ResponseWriter, r *http.Request) {
+	var report *DiagnosticsReport
+	if r.URL.Query().Get("loaded") != "" {
+		contentMu.RLock()
+		content := currentContent
+		contentMu.RUnlock()
+
+		if content == nil {
+			http.Error(w, "No content loaded", 404)
+			return
+		}
+		report = newDiagnosticsReport(map[string]map[string]AutomationType{content.TarFile: content.AutomationTypes})
+	} else {
+		var err error
+		if report, err = libraryDiagnostics(); err != nil {
+			http.Error(w, fmt.Sprintf("List exports: %v", err), 500)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
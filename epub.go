@@ -0,0 +1,524 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"hash/crc32"
+	"html"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// ============================================================
+// EPUB Writer
+// ============================================================
+
+func init() {
+	exportFormats["epub"] = exportFormat{
+		ext:  ".epub",
+		mime: "application/epub+zip",
+		// Images are embedded in the book
+		render: func(doc *Document, _ exportOptions) ([]byte, error) {
+			return newEPUBBook("", []*Document{doc}).bytes()
+		},
+		book: func(title string, docs []*Document) ([]byte, error) {
+			return newEPUBBook(title, docs).bytes()
+		},
+	}
+	subcommands["epub"] = subcommand{
+		usage:   "<tar|dir>... --out <book.epub>",
+		summary: "Bind exports into an EPUB book",
+		run:     runEPUB,
+	}
+}
+
+func runEPUB(args []string) error {
+	fs := newFlagSet("epub")
+	out := fs.String("out", "", "Output file (default: the book title)")
+	title := fs.String("title", "", "Book title (default: the page title, or \"Loop Pages\" for several pages)")
+	author := fs.String("author", "", "Author (default: bylines detected in the pages)")
+	lang := fs.String("lang", "en", "Book language as a BCP 47 tag")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) == 0 {
+		fs.Usage()
+		return fmt.Errorf("expected at least one tar file or directory")
+	}
+
+	paths, err := expandExportArgs(positional)
+	if err != nil {
+		return err
+	}
+	var docs []*Document
+	for _, p := range paths {
+		content, err := readTar(p)
+		if err != nil {
+			return fmt.Errorf("%s: %w", filepath.Base(p), err)
+		}
+		docs = append(docs, newDocument(content))
+	}
+
+	book := newEPUBBook(*title, docs)
+	book.Language = *lang
+	if *author != "" {
+		book.Authors = []string{*author}
+	}
+	data, err := book.bytes()
+	if err != nil {
+		return err
+	}
+
+	file := expandHome(*out)
+	if file == "" {
+		file = safeFileName(book.Title) + ".epub"
+	}
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		return fmt.Errorf("write %s: %w", file, err)
+	}
+
+	successStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#10B981")).Bold(true)
+	pathStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#FBBF24"))
+	noun := "page"
+	if len(docs) != 1 {
+		noun = "pages"
+	}
+	fmt.Printf("%s %s\n", successStyle.Render(fmt.Sprintf("✓ Bound %d %s into", len(docs), noun)), pathStyle.Render(file))
+	return nil
+}
+
+// epubBook is an EPUB 3 publication with one chapter per export
+type epubBook struct {
+	Title    string
+	Language string
+	Authors  []string
+	Pages    []*convertPage
+}
+
+// newEPUBBook collects exports into a book. An empty title falls back to
+// bookTitle; authors come from the bylines detected in each page.
+func newEPUBBook(title string, docs []*Document) *epubBook {
+	if title == "" {
+		title = bookTitle(docs)
+	}
+	b := &epubBook{Title: title, Language: "en"}
+	slugs := newSlugger()
+	names := make(map[string]int)
+	for _, doc := range docs {
+		p := newConvertPage(doc, slugs, names, "", nil)
+		b.Pages = append(b.Pages, p)
+		if p.Author != "" && !containsFold(b.Authors, p.Author) {
+			b.Authors = append(b.Authors, p.Author)
+		}
+	}
+	return b
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// epubItem is a manifest entry
+type epubItem struct {
+	id, href, mediaType, properties string
+}
+
+// bytes writes the book as an EPUB container
+func (b *epubBook) bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	modified := time.Now().UTC().Truncate(time.Second)
+
+	// The mimetype must come first, uncompressed and without a data
+	// descriptor, so readers can sniff the file type
+	mimetype := []byte("application/epub+zip")
+	w, err := zw.CreateRaw(&zip.FileHeader{
+		Name:               "mimetype",
+		Method:             zip.Store,
+		CRC32:              crc32.ChecksumIEEE(mimetype),
+		CompressedSize64:   uint64(len(mimetype)),
+		UncompressedSize64: uint64(len(mimetype)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(mimetype); err != nil {
+		return nil, err
+	}
+
+	add := func(name string, data []byte) error {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
+
+	if err := add("META-INF/container.xml", []byte(epubContainer)); err != nil {
+		return nil, err
+	}
+
+	items := []epubItem{
+		{"nav", "nav.xhtml", "application/xhtml+xml", "nav"},
+		{"style", "style.css", "text/css", ""},
+		{"cover-image", "cover.svg", "image/svg+xml", "cover-image"},
+		{"cover", "cover.xhtml", "application/xhtml+xml", ""},
+	}
+	spine := []string{"cover"}
+	files := map[string][]byte{
+		"style.css":   []byte(epubStyle),
+		"cover.svg":   []byte(b.coverSVG()),
+		"cover.xhtml": []byte(b.coverPage()),
+		"nav.xhtml":   []byte(b.navDocument()),
+	}
+	order := []string{"nav.xhtml", "style.css", "cover.svg", "cover.xhtml"}
+
+	idx := newPageIndex(b.Pages)
+	for i, p := range b.Pages {
+		id := fmt.Sprintf("page-%d", i+1)
+		href := p.Slug + ".xhtml"
+		items = append(items, epubItem{id, href, "application/xhtml+xml", ""})
+		spine = append(spine, id)
+		files[href] = []byte(b.chapter(p, idx))
+		order = append(order, href)
+
+		names := make([]string, 0, len(p.Images))
+		for name := range p.Images {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for j, name := range names {
+			mimeType, data, err := decodeDataURL(p.Images[name])
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s: %w", p.TarFile, name, err)
+			}
+			ref := epubImageRef(p, name)
+			items = append(items, epubItem{fmt.Sprintf("%s-img-%d", id, j+1), ref, mimeType, ""})
+			files[ref] = data
+			order = append(order, ref)
+		}
+	}
+
+	if err := add("OEBPS/content.opf", []byte(b.packageDocument(items, spine, modified))); err != nil {
+		return nil, err
+	}
+	for _, ref := range order {
+		// Manifest hrefs are URLs; zip entries use the plain name
+		name, err := url.PathUnescape(ref)
+		if err != nil {
+			name = ref
+		}
+		if err := add("OEBPS/"+name, files[ref]); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// epubImageRef is the href of a page's image, relative to the package
+func epubImageRef(p *convertPage, name string) string {
+	return "images/" + p.Slug + "/" + url.PathEscape(path.Base(name))
+}
+
+const epubContainer = `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`
+
+// packageDocument writes content.opf
+func (b *epubBook) packageDocument(items []epubItem, spine []string, modified time.Time) string {
+	var sb strings.Builder
+	sb.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	fmt.Fprintf(&sb, `<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="book-id" xml:lang="%s">`+"\n", html.EscapeString(b.Language))
+	sb.WriteString(`  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">` + "\n")
+	fmt.Fprintf(&sb, "    <dc:identifier id=\"book-id\">%s</dc:identifier>\n", b.identifier())
+	fmt.Fprintf(&sb, "    <dc:title>%s</dc:title>\n", html.EscapeString(b.Title))
+	fmt.Fprintf(&sb, "    <dc:language>%s</dc:language>\n", html.EscapeString(b.Language))
+	for _, a := range b.Authors {
+		fmt.Fprintf(&sb, "    <dc:creator>%s</dc:creator>\n", html.EscapeString(a))
+	}
+	if date := b.date(); !date.IsZero() {
+		fmt.Fprintf(&sb, "    <dc:date>%s</dc:date>\n", date.Format("2006-01-02"))
+	}
+	if len(b.Pages) == 1 && b.Pages[0].SourceURL != "" {
+		fmt.Fprintf(&sb, "    <dc:source>%s</dc:source>\n", html.EscapeString(b.Pages[0].SourceURL))
+	}
+	fmt.Fprintf(&sb, "    <meta property=\"dcterms:modified\">%s</meta>\n", modified.Format("2006-01-02T15:04:05Z"))
+	// EPUB 2 readers find the cover through this
+	sb.WriteString(`    <meta name="cover" content="cover-image"/>` + "\n")
+	sb.WriteString("  </metadata>\n  <manifest>\n")
+	for _, it := range items {
+		fmt.Fprintf(&sb, `    <item id="%s" href="%s" media-type="%s"`, it.id, html.EscapeString(it.href), it.mediaType)
+		if it.properties != "" {
+			fmt.Fprintf(&sb, ` properties="%s"`, it.properties)
+		}
+		sb.WriteString("/>\n")
+	}
+	sb.WriteString("  </manifest>\n  <spine>\n")
+	for _, id := range spine {
+		fmt.Fprintf(&sb, "    <itemref idref=\"%s\"/>\n", id)
+	}
+	sb.WriteString("  </spine>\n</package>\n")
+	return sb.String()
+}
+
+// identifier derives a stable URN from the book's contents, so binding the
+// same exports again yields the same book for readers that track progress
+func (b *epubBook) identifier() string {
+	h := sha1.New()
+	h.Write([]byte(b.Title))
+	for _, p := range b.Pages {
+		h.Write([]byte{0})
+		h.Write([]byte(p.Markdown))
+	}
+	sum := h.Sum(nil)
+	sum[6] = sum[6]&0x0f | 0x50 // version 5
+	sum[8] = sum[8]&0x3f | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+// date is the newest export date in the book
+func (b *epubBook) date() time.Time {
+	var newest time.Time
+	for _, p := range b.Pages {
+		if p.Date.After(newest) {
+			newest = p.Date
+		}
+	}
+	return newest
+}
+
+// xhtmlPage wraps a body in an XHTML content document
+func (b *epubBook) xhtmlPage(title, bodyAttrs, body string) string {
+	lang := html.EscapeString(b.Language)
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="` + lang + `" lang="` + lang + `">
+<head>
+<title>` + html.EscapeString(title) + `</title>
+<link rel="stylesheet" type="text/css" href="style.css"/>
+</head>
+<body` + bodyAttrs + `>
+` + body + `</body>
+</html>
+`
+}
+
+// chapter renders one page. Images point into the book and links to other
+// pages in the book become chapter links.
+func (b *epubBook) chapter(p *convertPage, idx *pageIndex) string {
+	opts := htmlOptions{
+		EscapeHTML: true,
+		ImageURL: func(ref string) string {
+			name, ok := strings.CutPrefix(ref, "images/")
+			if !ok {
+				return ref
+			}
+			if _, found := p.Images[name]; !found {
+				return ref
+			}
+			return epubImageRef(p, name)
+		},
+		LinkURL: func(ref string) string {
+			if target := idx.find(ref, ""); target != nil {
+				return target.Slug + ".xhtml"
+			}
+			return ref
+		},
+	}
+	var body strings.Builder
+	body.WriteString("<section epub:type=\"chapter\">\n")
+	if titleNode(p.Document) == nil {
+		// The title came from the file name, so the page has no heading
+		fmt.Fprintf(&body, "<h1>%s</h1>\n", html.EscapeString(p.Title))
+	}
+	body.WriteString(renderHTML(p.Root, opts))
+	body.WriteString("</section>\n")
+	return b.xhtmlPage(p.Title, "", body.String())
+}
+
+// coverPage shows the cover image with the title as its text alternative
+func (b *epubBook) coverPage() string {
+	body := fmt.Sprintf("<section epub:type=\"cover\" class=\"cover\">\n<img src=\"cover.svg\" alt=\"%s\"/>\n</section>\n",
+		html.EscapeString(b.Title))
+	return b.xhtmlPage(b.Title, ` epub:type="cover"`, body)
+}
+
+// coverSVG draws a plain typographic cover with the title, authors and date
+func (b *epubBook) coverSVG() string {
+	const width, height = 600, 800
+	lines := wrapWords(b.Title, 18)
+	if len(lines) > 6 {
+		lines = lines[:6]
+		lines[5] += "…"
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<?xml version="1.0" encoding="UTF-8"?>
+<svg xmlns="http://www.w3.org/2000/svg" version="1.1" width="%d" height="%d" viewBox="0 0 %d %d">
+<rect width="%d" height="%d" fill="#1F2937"/>
+<rect x="40" y="40" width="%d" height="%d" fill="none" stroke="#7C3AED" stroke-width="4"/>
+`, width, height, width, height, width, height, width-80, height-80)
+	y := 300 - (len(lines)-1)*30
+	for _, l := range lines {
+		fmt.Fprintf(&sb, `<text x="%d" y="%d" font-family="Georgia, serif" font-size="48" font-weight="bold" fill="#F9FAFB" text-anchor="middle">%s</text>`+"\n",
+			width/2, y, html.EscapeString(l))
+		y += 60
+	}
+	var byline []string
+	if len(b.Authors) > 0 {
+		byline = append(byline, strings.Join(b.Authors, ", "))
+	}
+	if date := b.date(); !date.IsZero() {
+		byline = append(byline, date.Format("January 2, 2006"))
+	}
+	y = max(y+40, 560)
+	for _, l := range byline {
+		fmt.Fprintf(&sb, `<text x="%d" y="%d" font-family="Helvetica, Arial, sans-serif" font-size="24" fill="#D1D5DB" text-anchor="middle">%s</text>`+"\n",
+			width/2, y, html.EscapeString(l))
+		y += 36
+	}
+	sb.WriteString("</svg>\n")
+	return sb.String()
+}
+
+// wrapWords breaks text into lines of about width characters
+func wrapWords(text string, width int) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(text) {
+		if line != "" && len([]rune(line))+1+len([]rune(word)) > width {
+			lines = append(lines, line)
+			line = word
+			continue
+		}
+		if line != "" {
+			line += " "
+		}
+		line += word
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// navEntry is a table of contents entry
+type navEntry struct {
+	text, href string
+	children   []*navEntry
+}
+
+// navDocument writes the table of contents: one entry per page with its
+// heading outline nested below. The heading used as the page title is
+// already the page entry, so it is left out.
+func (b *epubBook) navDocument() string {
+	var entries []*navEntry
+	for _, p := range b.Pages {
+		href := p.Slug + ".xhtml"
+		var headings []Heading
+		skipped := titleNode(p.Document) == nil
+		for _, h := range p.Headings {
+			if !skipped && h.Text == p.Title {
+				skipped = true
+				continue
+			}
+			headings = append(headings, h)
+		}
+		entries = append(entries, &navEntry{text: p.Title, href: href, children: navTree(headings, href)})
+	}
+
+	var body strings.Builder
+	body.WriteString("<nav epub:type=\"toc\" id=\"toc\">\n<h1>Contents</h1>\n")
+	writeNavList(&body, entries)
+	body.WriteString("</nav>\n")
+	body.WriteString("<nav epub:type=\"landmarks\" hidden=\"hidden\">\n<ol>\n")
+	body.WriteString("<li><a epub:type=\"cover\" href=\"cover.xhtml\">Cover</a></li>\n")
+	if len(b.Pages) > 0 {
+		fmt.Fprintf(&body, "<li><a epub:type=\"bodymatter\" href=\"%s.xhtml\">Start</a></li>\n", html.EscapeString(b.Pages[0].Slug))
+	}
+	body.WriteString("</ol>\n</nav>\n")
+	return b.xhtmlPage("Contents", "", body.String())
+}
+
+// navTree nests a flat heading outline by depth. Skipped levels attach to
+// the nearest shallower heading.
+func navTree(headings []Heading, href string) []*navEntry {
+	type open struct {
+		depth int
+		entry *navEntry
+	}
+	var roots []*navEntry
+	var stack []open
+	for _, h := range headings {
+		e := &navEntry{text: h.Text, href: href + "#" + h.Slug}
+		for len(stack) > 0 && stack[len(stack)-1].depth >= h.Depth {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) == 0 {
+			roots = append(roots, e)
+		} else {
+			parent := stack[len(stack)-1].entry
+			parent.children = append(parent.children, e)
+		}
+		stack = append(stack, open{h.Depth, e})
+	}
+	return roots
+}
+
+func writeNavList(sb *strings.Builder, entries []*navEntry) {
+	sb.WriteString("<ol>\n")
+	for _, e := range entries {
+		text := e.text
+		if text == "" {
+			text = "Untitled"
+		}
+		fmt.Fprintf(sb, "<li><a href=\"%s\">%s</a>", html.EscapeString(e.href), html.EscapeString(text))
+		if len(e.children) > 0 {
+			sb.WriteString("\n")
+			writeNavList(sb, e.children)
+		}
+		sb.WriteString("</li>\n")
+	}
+	sb.WriteString("</ol>\n")
+}
+
+const epubStyle = `body { font-family: Georgia, serif; line-height: 1.5; }
+h1, h2, h3, h4, h5, h6 { font-family: Helvetica, Arial, sans-serif; line-height: 1.2; }
+img { max-width: 100%; }
+pre { white-space: pre-wrap; font-size: 0.85em; background: #F3F4F6; padding: 0.5em; }
+code { font-family: Menlo, Consolas, monospace; }
+table { border-collapse: collapse; margin: 1em 0; }
+th, td { border: 1px solid #D1D5DB; padding: 0.25em 0.5em; }
+blockquote { margin-left: 1em; padding-left: 1em; border-left: 3px solid #D1D5DB; color: #4B5563; }
+.markdown-alert { border-left: 4px solid #3B82F6; padding: 0.25em 1em; margin: 1em 0; }
+.markdown-alert-title { font-weight: bold; margin: 0.25em 0; }
+.markdown-alert-tip { border-color: #10B981; }
+.markdown-alert-important { border-color: #7C3AED; }
+.markdown-alert-warning { border-color: #F59E0B; }
+.markdown-alert-caution { border-color: #EF4444; }
+.task-list-item { list-style: none; }
+.cover { text-align: center; margin: 0; padding: 0; }
+.cover img { height: 100%; max-height: 100vh; }
+`
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ============================================================
+// Export Archives
+// ============================================================
+
+// Document is a parsed Loop export ready for conversion
+type Document struct {
+	*Content
+	Root     *Node
+	Title    string
+	Headings []Heading
+}
+
+// newDocument parses the markdown of a loaded export
+func newDocument(content *Content) *Document {
+	root := parseMarkdown(content.Markdown)
+	return &Document{
+		Content:  content,
+		Root:     root,
+		Title:    documentTitle(root, content.TarFile),
+		Headings: outline(root),
+	}
+}
+
+// readTar reads a Loop export archive into memory
+func readTar(path string) (*Content, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open tar: %w", err)
+	}
+	defer f.Close()
+
+	content := &Content{
+		Images:   make(map[string]string),
+		LoadedAt: time.Now(),
+		TarFile:  filepath.Base(path),
+		TarPath:  path,
+	}
+
+	hash := sha256.New()
+	archive := io.TeeReader(f, hash)
+	tr := tar.NewReader(archive)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("tar read: %w", err)
+		}
+
+		if header.Typeflag == tar.TypeDir {
+			continue
+		}
+
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", header.Name, err)
+		}
+
+		name := header.Name
+		if name == "content.md" {
+			content.Markdown = string(data)
+		} else if name == "metadata.json" {
+			var meta struct {
+				URL string `json:"url"`
+			}
+			if json.Unmarshal(data, &meta) == nil {
+				content.SourceURL = meta.URL
+			}
+		} else if name == "automation-types.json" {
+			json.Unmarshal(data, &content.AutomationTypes)
+		} else if strings.HasPrefix(name, "images/") {
+			imgName := strings.TrimPrefix(name, "images/")
+			mimeType := getMimeType(imgName)
+			b64 := base64.StdEncoding.EncodeToString(data)
+			content.Images[imgName] = fmt.Sprintf("data:%s;base64,%s", mimeType, b64)
+		}
+	}
+
+	// hash the end-of-archive padding the tar reader leaves unread
+	if _, err := io.Copy(io.Discard, archive); err != nil {
+		return nil, fmt.Errorf("tar read: %w", err)
+	}
+	content.Version = hex.EncodeToString(hash.Sum(nil)[:8])
+	return content, nil
+}
+
+// readTarEntry reads one file from an export archive as it is stored,
+// before any load-time cleanup
+func readTarEntry(path, name string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open tar: %w", err)
+	}
+	defer f.Close()
+
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%s not found in %s", name, filepath.Base(path))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("tar read: %w", err)
+		}
+		if hdr.Typeflag == tar.TypeReg && hdr.Name == name {
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				return nil, fmt.Errorf("read %s: %w", name, err)
+			}
+			return data, nil
+		}
+	}
+}
+
+// rewriteTar copies an export archive, passing every file outside
+// images/ through edit. Images and directories are copied unchanged.
+func rewriteTar(src string, w io.Writer, edit func(name string, data []byte) []byte) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("open tar: %w", err)
+	}
+	defer f.Close()
+
+	tr := tar.NewReader(f)
+	tw := tar.NewWriter(w)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("tar read: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg || strings.HasPrefix(hdr.Name, "images/") {
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			if _, err := io.Copy(tw, tr); err != nil {
+				return err
+			}
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return fmt.Errorf("read %s: %w", hdr.Name, err)
+		}
+		data = edit(hdr.Name, data)
+		hdr.Size = int64(len(data))
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// decodeDataURL splits a base64 data URL into its MIME type and bytes
+func decodeDataURL(dataURL string) (string, []byte, error) {
+	// Parse data URL: data:image/png;base64,xxxx
+	parts := strings.SplitN(dataURL, ",", 2)
+	if len(parts) != 2 {
+		return "", nil, fmt.Errorf("invalid data URL")
+	}
+
+	// Extract MIME type from data:image/png;base64
+	mimeType := "image/png"
+	if strings.HasPrefix(parts[0], "data:") {
+		meta := strings.TrimPrefix(parts[0], "data:")
+		meta = strings.TrimSuffix(meta, ";base64")
+		if meta != "" {
+			mimeType = meta
+		}
+	}
+
+	data, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", nil, fmt.Errorf("decode image: %w", err)
+	}
+	return mimeType, data, nil
+}
+
+// listExports returns the .tar archives in dir, sorted by name
+func listExports(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".tar") {
+			continue
+		}
+		paths = append(paths, filepath.Join(dir, entry.Name()))
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// reExportSuffix matches the " - 2026-01-28 at 1.39 PM" suffix loopd.js
+// appends to download names
+var reExportSuffix = regexp.MustCompile(`\s+-\s+\d{4}-\d{2}-\d{2} at \d{1,2}\.\d{2}\s*[AP]M$`)
+
+// exportTitle derives a page title from an export's tar filename
+func exportTitle(tarFile string) string {
+	name := strings.TrimSuffix(tarFile, filepath.Ext(tarFile))
+	name = reExportSuffix.ReplaceAllString(name, "")
+	return strings.TrimSpace(name)
+}
+
+// documentTitle returns the first heading's text, falling back to the tar name
+func documentTitle(root *Node, tarFile string) string {
+	for _, n := range root.Children {
+		if n.Type == "heading" {
+			if t := strings.TrimSpace(nodeText(n)); t != "" {
+				return t
+			}
+		}
+	}
+	return exportTitle(tarFile)
+}
+
+// titleNode returns the heading that documentTitle took the title from, so
+// formats with a separate title can leave it out of the body
+func titleNode(doc *Document) *Node {
+	for _, n := range doc.Root.Children {
+		if n.Type == "heading" && strings.TrimSpace(nodeText(n)) == doc.Title {
+			return n
+		}
+	}
+	return nil
+}
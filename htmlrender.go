@@ -0,0 +1,279 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"strings"
+)
+
+// ============================================================
+// HTML Renderer
+// ============================================================
+
+// htmlOptions controls how a document is rendered to HTML
+type htmlOptions struct {
+	// ImageURL maps an image reference (e.g. images/image_0.png) to the src
+	// written into the page. Nil leaves references unchanged.
+	ImageURL func(url string) string
+	// LinkURL maps link destinations. Nil leaves links unchanged.
+	LinkURL func(url string) string
+	// EscapeHTML writes raw HTML as text, for strict XHTML consumers such
+	// as EPUB readers. Comments are dropped and <br> is kept.
+	EscapeHTML bool
+}
+
+// renderHTML renders a document tree as an XHTML-compatible fragment.
+// Headings carry the same ids as outline() produces.
+func renderHTML(root *Node, opts htmlOptions) string {
+	r := &htmlRenderer{opts: opts, slugs: newSlugger()}
+	r.blocks(root.Children, false)
+	return r.sb.String()
+}
+
+type htmlRenderer struct {
+	sb    strings.Builder
+	opts  htmlOptions
+	slugs *slugger
+}
+
+// calloutTitles maps GitHub alert types to their display titles
+var calloutTitles = map[string]string{
+	"NOTE":      "Note",
+	"TIP":       "Tip",
+	"IMPORTANT": "Important",
+	"WARNING":   "Warning",
+	"CAUTION":   "Caution",
+}
+
+// calloutTitle returns the display title for an alert type
+func calloutTitle(kind string) string {
+	if t, ok := calloutTitles[kind]; ok {
+		return t
+	}
+	if kind == "" {
+		return ""
+	}
+	return kind[:1] + strings.ToLower(kind[1:])
+}
+
+func (r *htmlRenderer) blocks(nodes []*Node, tight bool) {
+	for _, n := range nodes {
+		r.block(n, tight)
+	}
+}
+
+func (r *htmlRenderer) block(n *Node, tight bool) {
+	switch n.Type {
+	case "heading":
+		text := strings.TrimSpace(nodeText(n))
+		fmt.Fprintf(&r.sb, `<h%d id="%s">`, n.Depth, html.EscapeString(r.slugs.slug(text)))
+		r.inlines(n.Children)
+		fmt.Fprintf(&r.sb, "</h%d>\n", n.Depth)
+
+	case "paragraph":
+		if tight {
+			r.inlines(n.Children)
+			r.sb.WriteString("\n")
+			return
+		}
+		r.sb.WriteString("<p>")
+		r.inlines(n.Children)
+		r.sb.WriteString("</p>\n")
+
+	case "blockquote":
+		if n.Callout != "" {
+			kind := strings.ToLower(n.Callout)
+			fmt.Fprintf(&r.sb, `<div class="markdown-alert markdown-alert-%s">`+"\n", html.EscapeString(kind))
+			fmt.Fprintf(&r.sb, `<p class="markdown-alert-title">%s</p>`+"\n", html.EscapeString(calloutTitle(n.Callout)))
+			r.blocks(n.Children, false)
+			r.sb.WriteString("</div>\n")
+			return
+		}
+		r.sb.WriteString("<blockquote>\n")
+		r.blocks(n.Children, false)
+		r.sb.WriteString("</blockquote>\n")
+
+	case "list":
+		tag := "ul"
+		if n.Ordered {
+			tag = "ol"
+		}
+		r.sb.WriteString("<" + tag)
+		if n.Ordered && n.Start > 1 {
+			fmt.Fprintf(&r.sb, ` start="%d"`, n.Start)
+		}
+		if isTaskList(n) {
+			r.sb.WriteString(` class="contains-task-list"`)
+		}
+		r.sb.WriteString(">\n")
+		for _, li := range n.Children {
+			r.listItem(li, !n.Spread)
+		}
+		r.sb.WriteString("</" + tag + ">\n")
+
+	case "code":
+		r.sb.WriteString("<pre><code")
+		if n.Lang != "" {
+			fmt.Fprintf(&r.sb, ` class="language-%s"`, html.EscapeString(n.Lang))
+		}
+		r.sb.WriteString(">")
+		r.sb.WriteString(html.EscapeString(n.Value))
+		if n.Value != "" {
+			r.sb.WriteString("\n")
+		}
+		r.sb.WriteString("</code></pre>\n")
+
+	case "table":
+		r.table(n)
+
+	case "thematicBreak":
+		r.sb.WriteString("<hr />\n")
+
+	case "html":
+		if r.opts.EscapeHTML {
+			if !strings.HasPrefix(strings.TrimSpace(n.Value), "<!--") {
+				r.sb.WriteString("<p>" + html.EscapeString(n.Value) + "</p>\n")
+			}
+			return
+		}
+		r.sb.WriteString(n.Value)
+		r.sb.WriteString("\n")
+
+	default:
+		// Inline content in block position
+		r.sb.WriteString("<p>")
+		r.inline(n)
+		r.sb.WriteString("</p>\n")
+	}
+}
+
+func isTaskList(list *Node) bool {
+	for _, li := range list.Children {
+		if li.Checked != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *htmlRenderer) listItem(li *Node, tight bool) {
+	if li.Checked != nil {
+		r.sb.WriteString(`<li class="task-list-item">`)
+		r.sb.WriteString(`<input type="checkbox" disabled="disabled"`)
+		if *li.Checked {
+			r.sb.WriteString(` checked="checked"`)
+		}
+		r.sb.WriteString(" /> ")
+	} else {
+		r.sb.WriteString("<li>")
+	}
+	for i, c := range li.Children {
+		if tight && c.Type == "paragraph" {
+			r.inlines(c.Children)
+			if i < len(li.Children)-1 {
+				r.sb.WriteString("\n")
+			}
+			continue
+		}
+		if i == 0 {
+			r.sb.WriteString("\n")
+		}
+		r.block(c, tight)
+	}
+	r.sb.WriteString("</li>\n")
+}
+
+func (r *htmlRenderer) table(n *Node) {
+	r.sb.WriteString("<table>\n")
+	for i, row := range n.Children {
+		if i == 0 {
+			r.sb.WriteString("<thead>\n")
+		} else if i == 1 {
+			r.sb.WriteString("<tbody>\n")
+		}
+		tag := "td"
+		if i == 0 {
+			tag = "th"
+		}
+		r.sb.WriteString("<tr>\n")
+		for c, cell := range row.Children {
+			r.sb.WriteString("<" + tag)
+			if c < len(n.Align) && n.Align[c] != "" {
+				fmt.Fprintf(&r.sb, ` style="text-align: %s"`, n.Align[c])
+			}
+			r.sb.WriteString(">")
+			r.inlines(cell.Children)
+			r.sb.WriteString("</" + tag + ">\n")
+		}
+		r.sb.WriteString("</tr>\n")
+		if i == 0 {
+			r.sb.WriteString("</thead>\n")
+		}
+	}
+	if len(n.Children) > 1 {
+		r.sb.WriteString("</tbody>\n")
+	}
+	r.sb.WriteString("</table>\n")
+}
+
+func (r *htmlRenderer) inlines(nodes []*Node) {
+	for _, n := range nodes {
+		r.inline(n)
+	}
+}
+
+func (r *htmlRenderer) inline(n *Node) {
+	switch n.Type {
+	case "text":
+		r.sb.WriteString(html.EscapeString(n.Value))
+	case "inlineCode":
+		r.sb.WriteString("<code>" + html.EscapeString(n.Value) + "</code>")
+	case "strong":
+		r.sb.WriteString("<strong>")
+		r.inlines(n.Children)
+		r.sb.WriteString("</strong>")
+	case "emphasis":
+		r.sb.WriteString("<em>")
+		r.inlines(n.Children)
+		r.sb.WriteString("</em>")
+	case "delete":
+		r.sb.WriteString("<del>")
+		r.inlines(n.Children)
+		r.sb.WriteString("</del>")
+	case "break":
+		r.sb.WriteString("<br />\n")
+	case "link":
+		url := n.URL
+		if r.opts.LinkURL != nil {
+			url = r.opts.LinkURL(url)
+		}
+		fmt.Fprintf(&r.sb, `<a href="%s"`, html.EscapeString(url))
+		if n.Title != "" {
+			fmt.Fprintf(&r.sb, ` title="%s"`, html.EscapeString(n.Title))
+		}
+		r.sb.WriteString(">")
+		r.inlines(n.Children)
+		r.sb.WriteString("</a>")
+	case "image":
+		src := n.URL
+		if r.opts.ImageURL != nil {
+			src = r.opts.ImageURL(src)
+		}
+		fmt.Fprintf(&r.sb, `<img src="%s" alt="%s"`, html.EscapeString(src), html.EscapeString(n.Alt))
+		if n.Title != "" {
+			fmt.Fprintf(&r.sb, ` title="%s"`, html.EscapeString(n.Title))
+		}
+		r.sb.WriteString(" />")
+	case "html":
+		switch {
+		case !r.opts.EscapeHTML:
+			r.sb.WriteString(n.Value)
+		case isBreakTag(n.Value):
+			r.sb.WriteString("<br />")
+		default:
+			r.sb.WriteString(html.EscapeString(n.Value))
+		}
+	default:
+		r.inlines(n.Children)
+	}
+}
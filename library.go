@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ============================================================
+// Library
+// ============================================================
+//
+// The library is the set of exports in the watch directory. Routes that
+// work on more than the loaded page pick exports from it by file name.
+
+var (
+	libraryDir string
+	libraryMu  sync.RWMutex
+)
+
+// setLibraryDir points the library at a new watch directory
+func setLibraryDir(dir string) {
+	libraryMu.Lock()
+	libraryDir = dir
+	libraryMu.Unlock()
+}
+
+func getLibraryDir() string {
+	libraryMu.RLock()
+	defer libraryMu.RUnlock()
+	return libraryDir
+}
+
+// LibraryEntry describes an export in the library
+type LibraryEntry struct {
+	File     string    `json:"file"`
+	Title    string    `json:"title"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+	Loaded   bool      `json:"loaded"`
+}
+
+// handleLibrary lists the exports in the watch directory, newest first
+func handleLibrary(w http.ResponseWriter, r *http.Request) {
+	dir := getLibraryDir()
+	paths, err := listExports(dir)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("List exports: %v", err), 500)
+		return
+	}
+
+	contentMu.RLock()
+	loaded := ""
+	if currentContent != nil {
+		loaded = currentContent.TarPath
+	}
+	contentMu.RUnlock()
+
+	entries := []LibraryEntry{}
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			continue
+		}
+		entries = append(entries, LibraryEntry{
+			File:     filepath.Base(p),
+			Title:    exportTitle(filepath.Base(p)),
+			Size:     info.Size(),
+			Modified: info.ModTime(),
+			Loaded:   p == loaded,
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Modified.After(entries[j].Modified)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"dir":     dir,
+		"exports": entries,
+	})
+}
+
+// libraryPath resolves an export file name inside the library. Only plain
+// .tar names are accepted so requests cannot reach outside the directory.
+func libraryPath(name string) (string, error) {
+	if name == "" || name != filepath.Base(name) || !strings.HasSuffix(name, ".tar") {
+		return "", fmt.Errorf("invalid export name %q", name)
+	}
+	dir := getLibraryDir()
+	if dir == "" {
+		return "", fmt.Errorf("no library directory")
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// readLibraryExports reads the named exports from the library
+func readLibraryExports(names []string) ([]*Content, error) {
+	var contents []*Content
+	for _, name := range names {
+		path, err := libraryPath(name)
+		if err != nil {
+			return nil, err
+		}
+		content, err := readTar(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		contents = append(contents, content)
+	}
+	return contents, nil
+}
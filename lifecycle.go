@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ============================================================
+// Lifecycle
+// ============================================================
+//
+// The server, the directory watcher and background loads share one
+// context that Ctrl+C or SIGTERM cancels. Shutdown stops the watcher,
+// lets in-flight requests finish, waits for loads already reading an
+// archive, then runs the flush hooks, so loopd exits cleanly under
+// systemd or launchd. A second signal during shutdown exits at once.
+
+// shutdownTimeout bounds how long requests and loads may take to finish
+const shutdownTimeout = 10 * time.Second
+
+// lifecycle owns the long-running parts of the server
+type lifecycle struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	server *http.Server
+
+	mu        sync.Mutex
+	closing   bool
+	loads     sync.WaitGroup
+	stopWatch context.CancelFunc
+	flushers  []func()
+}
+
+// app is the running server's lifecycle
+var app = newLifecycle()
+
+// newLifecycle returns a lifecycle whose context ends on Ctrl+C or SIGTERM
+func newLifecycle() *lifecycle {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &lifecycle{ctx: ctx, cancel: cancel}
+}
+
+// handleSignals cancels the lifecycle on the first interrupt and restores
+// the default handling so a second one kills the process
+func (l *lifecycle) handleSignals() {
+	ctx, stop := signal.NotifyContext(l.ctx, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+		l.cancel()
+	}()
+}
+
+// Done is closed when loopd has been asked to stop
+func (l *lifecycle) Done() <-chan struct{} {
+	return l.ctx.Done()
+}
+
+// serve runs the HTTP server on listener until shutdown
+func (l *lifecycle) serve(listener net.Listener, handler http.Handler) {
+	l.server = &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+		MaxHeaderBytes:    maxHeaderBytes,
+		ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+	}
+	go func() {
+		if err := l.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("HTTP server error: "+err.Error(), "err", err)
+		}
+	}()
+}
+
+// watch starts watching dir, stopping the watcher of any previous
+// directory
+func (l *lifecycle) watch(dir string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closing {
+		return
+	}
+	if l.stopWatch != nil {
+		l.stopWatch()
+	}
+	ctx, cancel := context.WithCancel(l.ctx)
+	l.stopWatch = cancel
+	go watchDirectory(ctx, dir)
+}
+
+// stopping reports whether shutdown has started
+func (l *lifecycle) stopping() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.closing
+}
+
+// beginLoad registers a load so shutdown waits for it. It reports false
+// once shutdown has started.
+func (l *lifecycle) beginLoad() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closing {
+		return false
+	}
+	l.loads.Add(1)
+	return true
+}
+
+// endLoad marks a load started with beginLoad as finished
+func (l *lifecycle) endLoad() {
+	l.loads.Done()
+}
+
+// onShutdown registers a hook to run after the server and loads have
+// stopped, for state that must be written out before exit
+func (l *lifecycle) onShutdown(fn func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.flushers = append(l.flushers, fn)
+}
+
+// shutdown stops the watcher and server, drains in-flight requests and
+// loads, and runs the flush hooks in reverse order of registration
+func (l *lifecycle) shutdown() error {
+	l.mu.Lock()
+	if l.closing {
+		l.mu.Unlock()
+		return nil
+	}
+	l.closing = true
+	if l.stopWatch != nil {
+		l.stopWatch()
+	}
+	flushers := l.flushers
+	l.mu.Unlock()
+	l.cancel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	var err error
+	if l.server != nil {
+		err = l.server.Shutdown(ctx)
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		l.loads.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		err = errors.Join(err, errors.New("timed out waiting for loads to finish"))
+	}
+
+	for i := len(flushers) - 1; i >= 0; i-- {
+		flushers[i]()
+	}
+	return err
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ============================================================
+// Request Limits
+// ============================================================
+//
+// A plugin stuck in a retry loop or a page polling /content in a tight
+// loop should not be able to starve the server or exhaust memory. Each
+// client address and the server as a whole get a token bucket of
+// requests. Heavy operations such as rendering exports and checking
+// links also have a cap on how many run at once. Request bodies and
+// headers are capped in size. Rejected requests get 429 or 413 and are
+// logged at most once per client every logInterval.
+
+// LimitsConfig configures request limits. Zero values use the defaults.
+type LimitsConfig struct {
+	ClientRate  float64 `json:"client_rate,omitempty"`  // requests per second per client (default 20)
+	ClientBurst int     `json:"client_burst,omitempty"` // requests a client may send at once (default 100)
+	GlobalRate  float64 `json:"global_rate,omitempty"`  // requests per second for all clients (default 200)
+	GlobalBurst int     `json:"global_burst,omitempty"` // (default 400)
+	MaxBodyMB   int     `json:"max_body_mb,omitempty"`  // largest request body (default 10)
+	Heavy       int     `json:"heavy,omitempty"`        // heavy operations running at once (default 4)
+	ClientHeavy int     `json:"client_heavy,omitempty"` // heavy operations per client (default 2)
+	Disable     bool    `json:"disable,omitempty"`      // turn every limit off
+}
+
+const (
+	// maxHeaderBytes caps request headers; Go's default is 1 MB
+	maxHeaderBytes = 64 << 10
+
+	// logInterval spaces out rejection logs for one client
+	logInterval = 10 * time.Second
+
+	// idleClient is how long an unused client bucket is kept
+	idleClient = 5 * time.Minute
+)
+
+// withDefaults fills in zero values
+func (c LimitsConfig) withDefaults() LimitsConfig {
+	if c.ClientRate <= 0 {
+		c.ClientRate = 20
+	}
+	if c.ClientBurst <= 0 {
+		c.ClientBurst = 100
+	}
+	if c.GlobalRate <= 0 {
+		c.GlobalRate = 200
+	}
+	if c.GlobalBurst <= 0 {
+		c.GlobalBurst = 400
+	}
+	if c.MaxBodyMB <= 0 {
+		c.MaxBodyMB = 10
+	}
+	if c.Heavy <= 0 {
+		c.Heavy = 4
+	}
+	if c.ClientHeavy <= 0 {
+		c.ClientHeavy = 2
+	}
+	return c
+}
+
+// bucket is a token bucket refilled at a fixed rate
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take removes a token if there is one, or reports how long until there
+// will be
+func (b *bucket) take(now time.Time, rate float64, burst int) (bool, time.Duration) {
+	if b.last.IsZero() {
+		b.tokens = float64(burst)
+	} else {
+		b.tokens = math.Min(float64(burst), b.tokens+now.Sub(b.last).Seconds()*rate)
+	}
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / rate * float64(time.Second))
+}
+
+// clientState is what the limiter tracks for one client
+type clientState struct {
+	bucket
+	heavy    int       // heavy operations running
+	rejected int       // rejections not yet logged
+	lastLog  time.Time // when rejections were last logged
+	lastUsed time.Time
+
+	// the latest held-back rejection, logged by a flush timer
+	lastReason, lastPath string
+	flushing             bool
+}
+
+// limiter enforces LimitsConfig
+type limiter struct {
+	cfg LimitsConfig
+
+	mu        sync.Mutex
+	global    bucket
+	heavy     int
+	clients   map[string]*clientState
+	lastSweep time.Time
+}
+
+func newLimiter(cfg LimitsConfig) *limiter {
+	return &limiter{cfg: cfg.withDefaults(), clients: make(map[string]*clientState)}
+}
+
+// clientKey identifies the sender of a request by address alone. Headers
+// such as Origin are chosen by the caller, so keying on them would hand
+// out a fresh bucket per value.
+func clientKey(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// client returns the state for key, dropping clients idle for a while
+func (l *limiter) client(key string, now time.Time) *clientState {
+	if now.Sub(l.lastSweep) > time.Minute {
+		for k, c := range l.clients {
+			if c.heavy == 0 && !c.flushing && now.Sub(c.lastUsed) > idleClient {
+				delete(l.clients, k)
+			}
+		}
+		l.lastSweep = now
+	}
+	c, ok := l.clients[key]
+	if !ok {
+		c = &clientState{}
+		l.clients[key] = c
+	}
+	c.lastUsed = now
+	return c
+}
+
+// allow takes a token from the client's and the global bucket
+func (l *limiter) allow(key string) (bool, time.Duration) {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	c := l.client(key, now)
+	if ok, wait := c.take(now, l.cfg.ClientRate, l.cfg.ClientBurst); !ok {
+		return false, wait
+	}
+	if ok, wait := l.global.take(now, l.cfg.GlobalRate, l.cfg.GlobalBurst); !ok {
+		c.tokens++ // not the client's fault
+		return false, wait
+	}
+	return true, 0
+}
+
+// acquireHeavy reserves a heavy operation slot for the client
+func (l *limiter) acquireHeavy(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	c := l.client(key, time.Now())
+	if l.heavy >= l.cfg.Heavy || c.heavy >= l.cfg.ClientHeavy {
+		return false
+	}
+	l.heavy++
+	c.heavy++
+	return true
+}
+
+func (l *limiter) releaseHeavy(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.heavy--
+	if c, ok := l.clients[key]; ok {
+		c.heavy--
+	}
+}
+
+// rejectReasons explain the reasons counted in loopd_http_rejected_total
+var rejectReasons = map[string]string{
+	"rate": "over the request rate",
+	"busy": "too many heavy operations running",
+	"body": "request body too large",
+}
+
+// reject answers 429 and logs the rejection, batching repeated ones.
+// Rejections held back are logged when their interval ends, even if the
+// client has stopped sending by then.
+func (l *limiter) reject(w http.ResponseWriter, r *http.Request, key, reason string, retry time.Duration) {
+	metrics.rejected.inc(reason)
+	now := time.Now()
+	l.mu.Lock()
+	c := l.client(key, now)
+	c.rejected++
+	c.lastReason, c.lastPath = reason, r.URL.Path
+	var count int
+	if now.Sub(c.lastLog) >= logInterval {
+		count, c.rejected, c.lastLog = c.rejected, 0, now
+	} else if !c.flushing {
+		c.flushing = true
+		time.AfterFunc(c.lastLog.Add(logInterval).Sub(now), func() { l.flushRejections(key) })
+	}
+	l.mu.Unlock()
+	if count > 0 {
+		logRejections(key, reason, r.URL.Path, count)
+	}
+
+	seconds := int(math.Ceil(retry.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	http.Error(w, "Too many requests, retry in "+strconv.Itoa(seconds)+"s", http.StatusTooManyRequests)
+}
+
+// flushRejections logs the rejections held back for a client
+func (l *limiter) flushRejections(key string) {
+	l.mu.Lock()
+	c, ok := l.clients[key]
+	if !ok {
+		l.mu.Unlock()
+		return
+	}
+	c.flushing = false
+	count, reason, path := c.rejected, c.lastReason, c.lastPath
+	if count > 0 {
+		c.rejected, c.lastLog = 0, time.Now()
+	}
+	l.mu.Unlock()
+	if count > 0 {
+		logRejections(key, reason, path, count)
+	}
+}
+
+func logRejections(key, reason, path string, count int) {
+	slog.Warn(fmt.Sprintf("Rejected %d %s from %s: %s (last %s)", count, plural(count, "request", "requests"), key, rejectReasons[reason], path),
+		"client", key, "reason", reason, "rejected", count, "path", path)
+}
+
+// limitRequests applies the rate and body size limits to a route
+func (l *limiter) limitRequests(next http.HandlerFunc) http.HandlerFunc {
+	if l.cfg.Disable {
+		return next
+	}
+	maxBody := int64(l.cfg.MaxBodyMB) << 20
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := clientKey(r)
+		if ok, wait := l.allow(key); !ok {
+			l.reject(w, r, key, "rate", wait)
+			return
+		}
+		if r.ContentLength > maxBody {
+			metrics.rejected.inc("body")
+			slog.Warn(fmt.Sprintf("Rejected a %s request body from %s to %s", formatSize(int(r.ContentLength)), key, r.URL.Path),
+				"client", key, "bytes", r.ContentLength, "path", r.URL.Path)
+			http.Error(w, fmt.Sprintf("Request body over %d MB", l.cfg.MaxBodyMB), http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxBody)
+		next(w, r)
+	}
+}
+
+// limitHeavy caps how many runs of an expensive route happen at once
+func (l *limiter) limitHeavy(next http.HandlerFunc) http.HandlerFunc {
+	if l.cfg.Disable {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := clientKey(r)
+		if !l.acquireHeavy(key) {
+			l.reject(w, r, key, "busy", time.Second)
+			return
+		}
+		defer l.releaseHeavy(key)
+		next(w, r)
+	}
+}
+
+// bodyTooLarge reports whether reading a request body failed at the
+// size limit
+func bodyTooLarge(err error) bool {
+	var maxErr *http.MaxBytesError
+	return errors.As(err, &maxErr)
+}
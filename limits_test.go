@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBucketTake(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		takes    []time.Duration // offsets from start
+		rate     float64
+		burst    int
+		wantOK   bool // result of the last take
+		wantWait time.Duration
+	}{
+		{name: "first take starts full", takes: []time.Duration{0}, rate: 1, burst: 1, wantOK: true},
+		{name: "burst spent", takes: []time.Duration{0, 0, 0}, rate: 1, burst: 2, wantOK: false, wantWait: time.Second},
+		{name: "refills at rate", takes: []time.Duration{0, 0, 500 * time.Millisecond}, rate: 2, burst: 1, wantOK: true},
+		{name: "partial refill waits for the rest", takes: []time.Duration{0, 250 * time.Millisecond}, rate: 2, burst: 1, wantOK: false, wantWait: 250 * time.Millisecond},
+		{name: "idle time caps at burst", takes: []time.Duration{0, time.Hour, time.Hour, time.Hour}, rate: 1, burst: 2, wantOK: false, wantWait: time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bucket
+			var ok bool
+			var wait time.Duration
+			for _, d := range tt.takes {
+				ok, wait = b.take(start.Add(d), tt.rate, tt.burst)
+			}
+			if ok != tt.wantOK || wait != tt.wantWait {
+				t.Errorf("take() = %v, %v; want %v, %v", ok, wait, tt.wantOK, tt.wantWait)
+			}
+		})
+	}
+}
+
+func TestLimitRequestsSharesBucketAcrossOrigins(t *testing.T) {
+	l := newLimiter(LimitsConfig{ClientRate: 0.001, ClientBurst: 1})
+	handler := l.limitRequests(func(w http.ResponseWriter, r *http.Request) {})
+
+	codes := []int{}
+	for _, origin := range []string{"http://localhost:8080", "https://www.figma.com"} {
+		r := httptest.NewRequest(http.MethodGet, "/content", nil)
+		r.RemoteAddr = "192.0.2.1:50000"
+		r.Header.Set("Origin", origin)
+		w := httptest.NewRecorder()
+		handler(w, r)
+		codes = append(codes, w.Code)
+	}
+	if codes[0] != http.StatusOK || codes[1] != http.StatusTooManyRequests {
+		t.Errorf("status codes = %v; want [200 429]", codes)
+	}
+	if len(l.clients) != 1 {
+		t.Errorf("tracked %d clients; want 1", len(l.clients))
+	}
+}
+
+func TestRejectFlushesHeldBackRejections(t *testing.T) {
+	var logs bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+
+	l := newLimiter(LimitsConfig{})
+	r := httptest.NewRequest(http.MethodGet, "/content", nil)
+	r.RemoteAddr = "192.0.2.1:50000"
+	for range 9 {
+		l.reject(httptest.NewRecorder(), r, "192.0.2.1", "rate", time.Second)
+	}
+	if got := strings.Count(logs.String(), "Rejected"); got != 1 {
+		t.Fatalf("logged %d times during the burst; want 1:\n%s", got, logs.String())
+	}
+	l.flushRejections("192.0.2.1")
+	if !strings.Contains(logs.String(), "Rejected 8 requests from 192.0.2.1") {
+		t.Errorf("held-back rejections not logged:\n%s", logs.String())
+	}
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// ============================================================
+// Link Checker
+// ============================================================
+//
+// Checks a page's references without touching the internet: #anchors
+// against the heading outline, images against the archive, and external
+// links against an allowlist of known-good hosts or a local HTTP stand-in
+// that mirrors them.
+
+func init() {
+	subcommands["links"] = subcommand{
+		usage:   "check <tar|dir>... [--allow hosts] [--mirror url]",
+		summary: "Check anchors, images and links for broken references",
+		run:     runLinks,
+	}
+}
+
+// LinkCheckConfig configures external link checks
+type LinkCheckConfig struct {
+	Allow  []string `json:"allow,omitempty"`  // example.com, *.example.com or URL prefixes
+	Mirror string   `json:"mirror,omitempty"` // local stand-in serving <mirror>/<host>/<path>
+}
+
+// linkChecker checks external links, remembering each URL's result
+type linkChecker struct {
+	allow  []string
+	mirror string
+	client *http.Client
+	cache  map[string]linkVerdict
+}
+
+type linkVerdict struct {
+	status string // ok, broken or unverified
+	reason string
+}
+
+func newLinkChecker(cfg LinkCheckConfig) *linkChecker {
+	return &linkChecker{
+		allow:  cfg.Allow,
+		mirror: strings.TrimRight(cfg.Mirror, "/"),
+		client: &http.Client{Timeout: 5 * time.Second},
+		cache:  make(map[string]linkVerdict),
+	}
+}
+
+// LinkCheckResult is one checked reference
+type LinkCheckResult struct {
+	Kind    string `json:"kind"` // anchor, image or external
+	URL     string `json:"url"`
+	Text    string `json:"text,omitempty"`    // anchor text or alt text
+	Heading string `json:"heading,omitempty"` // nearest heading above the reference
+	Status  string `json:"status"`            // ok, broken or unverified
+	Reason  string `json:"reason,omitempty"`
+}
+
+// LinkCheckReport is the outcome of checking one page
+type LinkCheckReport struct {
+	File       string            `json:"file"`
+	Checked    int               `json:"checked"`
+	Broken     int               `json:"broken"`
+	Unverified int               `json:"unverified"`
+	Results    []LinkCheckResult `json:"results"`
+}
+
+// checkLinks checks every anchor, image and external link in a document.
+// Links are checked as convert would write them: SafeLinks unwrapped and
+// rewrite rules applied. Only problems are kept unless all is set.
+func checkLinks(doc *Document, lr *linkRewriter, lc *linkChecker, all bool) *LinkCheckReport {
+	processLinks(doc.Root, lr)
+	anchors := make(map[string]bool)
+	for _, h := range doc.Headings {
+		anchors[h.Slug] = true
+	}
+
+	report := &LinkCheckReport{File: doc.TarFile, Results: []LinkCheckResult{}}
+	heading := ""
+	walkNodes(doc.Root, func(n *Node) bool {
+		var res LinkCheckResult
+		switch n.Type {
+		case "heading":
+			heading = strings.TrimSpace(nodeText(n))
+			return true
+		case "link":
+			res = LinkCheckResult{URL: n.URL, Text: strings.Join(strings.Fields(nodeText(n)), " ")}
+			if frag, ok := strings.CutPrefix(n.URL, "#"); ok {
+				res.Kind = "anchor"
+				res.Status = checkAnchor(frag, anchors)
+				if res.Status == "broken" {
+					res.Reason = "no heading with this anchor"
+				}
+				break
+			}
+			res.Kind = "external"
+			if kind, _ := linkKind(n.URL); kind == "mailto" || kind == "other" {
+				return true
+			}
+			v := lc.check(n.URL)
+			res.Status, res.Reason = v.status, v.reason
+		case "image":
+			res = LinkCheckResult{URL: n.URL, Text: n.Alt}
+			if u, err := url.Parse(n.URL); err == nil && u.Scheme != "" {
+				if u.Scheme == "data" {
+					return true
+				}
+				res.Kind = "external"
+				v := lc.check(n.URL)
+				res.Status, res.Reason = v.status, v.reason
+				break
+			}
+			res.Kind = "image"
+			res.Status, res.Reason = checkImage(n.URL, doc.Images)
+		default:
+			return true
+		}
+		res.Heading = heading
+		report.Checked++
+		switch res.Status {
+		case "broken":
+			report.Broken++
+		case "unverified":
+			report.Unverified++
+		}
+		if all || res.Status != "ok" {
+			report.Results = append(report.Results, res)
+		}
+		return true
+	})
+	return report
+}
+
+// checkAnchor accepts a fragment that is a heading slug as written or
+// once decoded and slugified
+func checkAnchor(frag string, anchors map[string]bool) string {
+	if anchors[frag] {
+		return "ok"
+	}
+	if decoded, err := url.PathUnescape(frag); err == nil && (anchors[decoded] || anchors[slugify(decoded)]) {
+		return "ok"
+	}
+	return "broken"
+}
+
+// checkImage looks a relative image reference up in the archive
+func checkImage(ref string, images map[string]string) (status, reason string) {
+	p, err := url.PathUnescape(ref)
+	if err != nil {
+		p = ref
+	}
+	name, ok := strings.CutPrefix(path.Clean(p), "images/")
+	if !ok {
+		return "broken", "not in the archive's images/ folder"
+	}
+	if _, ok := images[name]; !ok {
+		return "broken", "missing from the archive"
+	}
+	return "ok", ""
+}
+
+// check decides an external link: allowlisted hosts pass, others are
+// fetched from the mirror when one is set and left unverified otherwise
+func (lc *linkChecker) check(raw string) linkVerdict {
+	if v, ok := lc.cache[raw]; ok {
+		return v
+	}
+	v := lc.verdict(raw)
+	lc.cache[raw] = v
+	return v
+}
+
+func (lc *linkChecker) verdict(raw string) linkVerdict {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return linkVerdict{"broken", "not a valid URL"}
+	}
+	if lc.allowed(u) {
+		return linkVerdict{"ok", ""}
+	}
+	if lc.mirror == "" {
+		if len(lc.allow) > 0 {
+			return linkVerdict{"broken", "host not in the allowlist"}
+		}
+		return linkVerdict{"unverified", "no allowlist or mirror configured"}
+	}
+
+	target := lc.mirror + "/" + u.Host + u.EscapedPath()
+	if u.RawQuery != "" {
+		target += "?" + u.RawQuery
+	}
+	resp, err := lc.client.Head(target)
+	if err == nil && (resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented) {
+		resp.Body.Close()
+		resp, err = lc.client.Get(target)
+	}
+	if err != nil {
+		return linkVerdict{"unverified", fmt.Sprintf("mirror unreachable: %v", err)}
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return linkVerdict{"broken", fmt.Sprintf("mirror returned %s", resp.Status)}
+	}
+	return linkVerdict{"ok", ""}
+}
+
+// allowed matches a link against "example.com" and "*.example.com" host
+// entries, the latter including example.com itself, or against
+// "https://example.com/docs/" URL prefixes. A prefix needs the same scheme
+// and host and only matches whole path segments.
+func (lc *linkChecker) allowed(u *url.URL) bool {
+	host := strings.ToLower(u.Hostname())
+	for _, a := range lc.allow {
+		a = strings.TrimSpace(a)
+		if strings.Contains(a, "://") {
+			if prefix, err := url.Parse(a); err == nil && urlHasPrefix(u, prefix) {
+				return true
+			}
+			continue
+		}
+		a = strings.ToLower(a)
+		switch {
+		case strings.HasPrefix(a, "*."):
+			if host == a[2:] || strings.HasSuffix(host, a[1:]) {
+				return true
+			}
+		case host == a:
+			return true
+		}
+	}
+	return false
+}
+
+// urlHasPrefix reports whether u is prefix or a path below it
+func urlHasPrefix(u, prefix *url.URL) bool {
+	if !strings.EqualFold(u.Scheme, prefix.Scheme) || !strings.EqualFold(u.Host, prefix.Host) {
+		return false
+	}
+	dir := strings.TrimSuffix(prefix.Path, "/")
+	return dir == "" || u.Path == dir || strings.HasPrefix(u.Path, dir+"/")
+}
+
+// logLinkCheck reports broken references in a freshly loaded page to the
+// TUI log
+func logLinkCheck(content *Content) {
+	lr, err := newLinkRewriter(globalConfig.Convert.LinkRules)
+	if err != nil {
+		slog.Warn(err.Error())
+		return
+	}
+	report := checkLinks(newDocument(content), lr, newLinkChecker(globalConfig.LinkCheck), false)
+	if report.Broken == 0 {
+		return
+	}
+	slog.Warn(fmt.Sprintf("Links: %d broken of %d checked in %s", report.Broken, report.Checked, content.TarFile))
+	shown := 0
+	for _, res := range report.Results {
+		if res.Status != "broken" {
+			continue
+		}
+		if shown == 5 {
+			slog.Warn(fmt.Sprintf("  … and %d more (see /api/links/check)", report.Broken-shown))
+			break
+		}
+		slog.Warn(fmt.Sprintf("  %s %s: %s", res.Kind, res.URL, res.Reason))
+		shown++
+	}
+}
+
+// handleLinkCheck checks the loaded page's references. Add ?all=1 to list
+// the references that passed too.
+func handleLinkCheck(w http.ResponseWriter, r *http.Request) {
+	contentMu.RLock()
+	content := currentContent
+	contentMu.RUnlock()
+
+	if content == nil {
+		http.Error(w, "No content loaded", 404)
+		return
+	}
+	lr, err := newLinkRewriter(globalConfig.Convert.LinkRules)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	report := checkLinks(newDocument(content), lr, newLinkChecker(globalConfig.LinkCheck), r.URL.Query().Get("all") != "")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+func runLinks(args []string) error {
+	if helpRequested("links", args) {
+		return flag.ErrHelp
+	}
+	if len(args) == 0 || args[0] != "check" {
+		return fmt.Errorf("usage: loopd links check <tar|dir>... [--allow hosts] [--mirror url]")
+	}
+	cfg := loadConfig()
+
+	fs := newFlagSet("links")
+	allow := fs.String("allow", strings.Join(cfg.LinkCheck.Allow, ","), "Comma-separated hosts (*.example.com) or URL prefixes that count as valid")
+	mirror := fs.String("mirror", cfg.LinkCheck.Mirror, "Base URL of a local HTTP stand-in serving <mirror>/<host>/<path>")
+	all := fs.Bool("all", false, "List references that passed too")
+	positional, err := parseArgs(fs, args[1:])
+	if err != nil {
+		return err
+	}
+	if len(positional) == 0 {
+		fs.Usage()
+		return fmt.Errorf("expected at least one tar file or directory")
+	}
+	lr, err := newLinkRewriter(cfg.Convert.LinkRules)
+	if err != nil {
+		return err
+	}
+	paths, err := expandExportArgs(positional)
+	if err != nil {
+		return err
+	}
+
+	lc := newLinkChecker(LinkCheckConfig{Allow: splitList(*allow), Mirror: *mirror})
+	reports := []*LinkCheckReport{}
+	broken := 0
+	for _, p := range paths {
+		content, err := readTar(p)
+		if err != nil {
+			return fmt.Errorf("%s: %w", p, err)
+		}
+		report := checkLinks(newDocument(content), lr, lc, *all)
+		broken += report.Broken
+		reports = append(reports, report)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(map[string]interface{}{
+		"broken": broken,
+		"pages":  reports,
+	}); err != nil {
+		return err
+	}
+	if broken > 0 {
+		return fmt.Errorf("%d broken references", broken)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestLinkCheckerAllowed(t *testing.T) {
+	tests := []struct {
+		allow, link string
+		want        bool
+	}{
+		{"example.com", "https://example.com/x", true},
+		{"example.com", "https://www.example.com/x", false},
+		{"*.example.com", "https://docs.example.com/x", true},
+		{"*.example.com", "https://example.com/x", true},
+		{"*.example.com", "https://badexample.com/x", false},
+		{"https://example.com", "https://example.com/x", true},
+		{"https://example.com", "https://example.com.evil.net/x", false},
+		{"https://example.com", "http://example.com/x", false},
+		{"https://example.com/docs/", "https://example.com/docs/a", true},
+		{"https://example.com/docs", "https://example.com/docs", true},
+		{"https://example.com/docs", "https://example.com/docs-old/a", false},
+		{"https://example.com/docs/", "https://example.com/other", false},
+		{"https://Example.com/Docs/", "https://example.com/Docs/a", true},
+		{"https://example.com:8443/", "https://example.com/x", false},
+	}
+	for _, tt := range tests {
+		lc := newLinkChecker(LinkCheckConfig{Allow: []string{tt.allow}})
+		u, err := url.Parse(tt.link)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := lc.allowed(u); got != tt.want {
+			t.Errorf("allow %q, link %q: got %v, want %v", tt.allow, tt.link, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// ============================================================
+// Link Processing
+// ============================================================
+//
+// Links in Loop pages often arrive wrapped by Outlook SafeLinks, and teams
+// move wikis and shortlink hosts over time. The link stage unwraps
+// SafeLinks and applies the rewrite rules from the config before convert
+// writes a page; /api/links lists every link in the loaded page.
+
+// LinkRule rewrites link URLs matching Pattern, a Go regexp, to Replace,
+// which may refer to groups as $1 or ${name}
+type LinkRule struct {
+	Pattern string `json:"pattern"`
+	Replace string `json:"replace"`
+}
+
+// linkRewriter applies compiled rules in order
+type linkRewriter struct {
+	patterns []*regexp.Regexp
+	replace  []string
+}
+
+// newLinkRewriter compiles rules, reporting the first bad pattern
+func newLinkRewriter(rules []LinkRule) (*linkRewriter, error) {
+	lr := &linkRewriter{}
+	for _, rule := range rules {
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("link rule %q: %w", rule.Pattern, err)
+		}
+		lr.patterns = append(lr.patterns, re)
+		lr.replace = append(lr.replace, rule.Replace)
+	}
+	return lr, nil
+}
+
+// rewrite runs every rule over the URL in order; each sees the previous
+// rule's output
+func (lr *linkRewriter) rewrite(u string) string {
+	if lr == nil {
+		return u
+	}
+	for i, re := range lr.patterns {
+		u = re.ReplaceAllString(u, lr.replace[i])
+	}
+	return u
+}
+
+// unwrapSafeLink returns the original URL behind an Outlook SafeLinks
+// wrapper such as https://nam06.safelinks.protection.outlook.com/?url=...,
+// or the URL unchanged
+func unwrapSafeLink(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || !strings.HasSuffix(strings.ToLower(u.Hostname()), ".safelinks.protection.outlook.com") {
+		return raw
+	}
+	if target := u.Query().Get("url"); target != "" {
+		return target
+	}
+	return raw
+}
+
+// processLinks unwraps SafeLinks and applies rewrite rules to every link
+// in the tree. Link text that spelled out the old URL is updated with it.
+// It returns the number of links changed.
+func processLinks(root *Node, lr *linkRewriter) int {
+	changed := 0
+	walkNodes(root, func(n *Node) bool {
+		if n.Type != "link" {
+			return true
+		}
+		to := lr.rewrite(unwrapSafeLink(n.URL))
+		if to == n.URL {
+			return true
+		}
+		for _, c := range n.Children {
+			if c.Type == "text" && c.Value == n.URL {
+				c.Value = to
+			}
+		}
+		n.URL = to
+		changed++
+		return true
+	})
+	return changed
+}
+
+// ============================================================
+// Link Inventory
+// ============================================================
+
+// LinkInfo is one link in a page and where it appears
+type LinkInfo struct {
+	URL       string `json:"url"`  // after unwrapping SafeLinks
+	Text      string `json:"text"` // anchor text
+	Kind      string `json:"kind"` // web, loop, shortlink, mailto, anchor or other
+	Host      string `json:"host,omitempty"`
+	Heading   string `json:"heading,omitempty"`   // nearest heading above the link
+	Anchor    string `json:"anchor,omitempty"`    // that heading's slug
+	Block     int    `json:"block"`               // 1-based top-level block the link is in
+	Original  string `json:"original,omitempty"`  // the SafeLinks URL as exported
+	Rewritten string `json:"rewritten,omitempty"` // the URL after rewrite rules, when they change it
+}
+
+// shortlinkHosts are redirect services whose targets cannot be known
+// without following them
+var shortlinkHosts = map[string]bool{
+	"aka.ms": true, "bit.ly": true, "go.microsoft.com": true, "tinyurl.com": true, "t.co": true,
+}
+
+// inventoryLinks lists the links in a document in page order
+func inventoryLinks(doc *Document, lr *linkRewriter) []LinkInfo {
+	links := []LinkInfo{}
+	slugs := newSlugger()
+	heading, anchor := "", ""
+	for i, block := range doc.Root.Children {
+		walkNodes(block, func(n *Node) bool {
+			switch n.Type {
+			case "heading":
+				heading = strings.TrimSpace(nodeText(n))
+				anchor = slugs.slug(heading)
+			case "link":
+				info := LinkInfo{
+					URL:     unwrapSafeLink(n.URL),
+					Text:    strings.Join(strings.Fields(nodeText(n)), " "),
+					Heading: heading,
+					Anchor:  anchor,
+					Block:   i + 1,
+				}
+				if info.URL != n.URL {
+					info.Original = n.URL
+				}
+				if to := lr.rewrite(info.URL); to != info.URL {
+					info.Rewritten = to
+				}
+				info.Kind, info.Host = linkKind(info.URL)
+				links = append(links, info)
+			}
+			return true
+		})
+	}
+	return links
+}
+
+// linkKind classifies a URL and returns its host
+func linkKind(raw string) (kind, host string) {
+	if strings.HasPrefix(raw, "#") {
+		return "anchor", ""
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "other", ""
+	}
+	host = strings.ToLower(u.Hostname())
+	switch {
+	case strings.EqualFold(u.Scheme, "mailto"):
+		return "mailto", ""
+	case u.Scheme != "http" && u.Scheme != "https":
+		return "other", host
+	case isLoopURL(raw):
+		return "loop", host
+	case shortlinkHosts[host]:
+		return "shortlink", host
+	}
+	return "web", host
+}
+
+// handleLinks lists the links in the loaded page with their location.
+// Rewrite rules from the config are previewed in each link's rewritten
+// field; the page itself is not changed.
+func handleLinks(w http.ResponseWriter, r *http.Request) {
+	contentMu.RLock()
+	content := currentContent
+	contentMu.RUnlock()
+
+	if content == nil {
+		http.Error(w, "No content loaded", 404)
+		return
+	}
+
+	lr, err := newLinkRewriter(globalConfig.Convert.LinkRules)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	links := inventoryLinks(newDocument(content), lr)
+	kinds := make(map[string]int)
+	safeLinks := 0
+	for _, l := range links {
+		kinds[l.Kind]++
+		if l.Original != "" {
+			safeLinks++
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"file":      content.TarFile,
+		"count":     len(links),
+		"kinds":     kinds,
+		"safelinks": safeLinks,
+		"links":     links,
+	})
+}
@@ -0,0 +1,431 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// ============================================================
+// Lint and Cleanup
+// ============================================================
+//
+// Loop's exporter leaves artifacts in content.md: &#x20; entities at line
+// ends, backslash-escaped characters inside URLs, text split into adjacent
+// runs of the same formatting, and "Image has no description" as alt text.
+// The cleanup stage fixes these on load and on convert; loopd lint reports
+// them alongside standard markdown checks.
+
+func init() {
+	subcommands["lint"] = subcommand{
+		usage:   "<tar|dir>... [--fix] [--disable rules] [--json]",
+		summary: "Check pages for Loop artifacts and markdown problems",
+		run:     runLint,
+	}
+}
+
+// LintConfig turns lint rules and the cleanup stage on and off
+type LintConfig struct {
+	Disable   []string `json:"disable,omitempty"`    // rule names to skip
+	NoCleanup bool     `json:"no_cleanup,omitempty"` // serve and convert pages as exported
+}
+
+// lintRule is one check. Fixable rules are what the cleanup stage repairs.
+type lintRule struct {
+	name    string
+	summary string
+	fixable bool
+}
+
+var lintRules = []lintRule{
+	{"entity-space", "&#x20; entities left by the exporter", true},
+	{"url-escape", "backslash-escaped characters in link destinations", true},
+	{"split-text", "text split into adjacent runs of the same formatting", true},
+	{"placeholder-alt", `"Image has no description" used as alt text`, true},
+	{"trailing-space", "trailing spaces at the end of a line", true},
+	{"heading-jump", "heading levels that skip a level", false},
+	{"duplicate-heading", "headings with the same text", false},
+}
+
+func lintRuleNames() []string {
+	names := make([]string, len(lintRules))
+	for i, r := range lintRules {
+		names[i] = r.name
+	}
+	return names
+}
+
+// lintRuleSet is the set of enabled rules
+type lintRuleSet map[string]bool
+
+// newLintRuleSet enables every rule not in disable, rejecting unknown names
+func newLintRuleSet(disable []string) (lintRuleSet, error) {
+	known := lintRuleNames()
+	rules := make(lintRuleSet)
+	for _, name := range known {
+		rules[name] = true
+	}
+	for _, name := range disable {
+		if !slices.Contains(known, name) {
+			return nil, fmt.Errorf("unknown lint rule %q (choose from %s)", name, strings.Join(known, ", "))
+		}
+		rules[name] = false
+	}
+	return rules, nil
+}
+
+// LintIssue is one problem found in a page
+type LintIssue struct {
+	Rule    string `json:"rule"`
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+	Fixable bool   `json:"fixable"`
+}
+
+// LintReport lists a page's problems in line order
+type LintReport struct {
+	File    string         `json:"file"`
+	Issues  []LintIssue    `json:"issues"`
+	Counts  map[string]int `json:"counts"`
+	Fixable int            `json:"fixable"`
+}
+
+var (
+	reEntitySpace    = regexp.MustCompile(`&#(?:[xX]0*20|0*32);`)
+	reLinkDest       = regexp.MustCompile(`\]\(([^)\s]*)`)
+	reDestEscape     = regexp.MustCompile(`\\[&_*~#=+.,;:!?$@%-]`)
+	reSplitRun       = regexp.MustCompile(`[^*\s]\*{4}[^*\s]|<!--\s*-->`)
+	rePlaceholderAlt = regexp.MustCompile(`!\[Image has no description\]`)
+	reTrailingSpace  = regexp.MustCompile(`\S[ \t]+$`)
+	reLintFence      = regexp.MustCompile("^\\s*(`{3,}|~{3,})") // fences nested in lists too
+	reEmptyComment   = regexp.MustCompile(`^<!--\s*-->$`)
+)
+
+// placeholderAlt is the alt text Loop gives images without a description
+const placeholderAlt = "Image has no description"
+
+// hardBreak reports whether a line ends in exactly two spaces followed by
+// another line of the same block, the markdown hard break that
+// markdownlint's MD009 also allows
+func hardBreak(line string, rest []string) bool {
+	body := strings.TrimSuffix(line, "  ")
+	return body != line && !strings.HasSuffix(body, " ") && !strings.HasSuffix(body, "\t") &&
+		len(rest) > 0 && !isBlank(rest[0])
+}
+
+// lintMarkdown checks a page's markdown line by line. Fenced code is
+// skipped.
+func lintMarkdown(file, src string, rules lintRuleSet) *LintReport {
+	report := &LintReport{File: file, Issues: []LintIssue{}, Counts: make(map[string]int)}
+	add := func(rule string, line int, format string, args ...interface{}) {
+		if !rules[rule] {
+			return
+		}
+		fixable := false
+		for _, r := range lintRules {
+			if r.name == rule {
+				fixable = r.fixable
+			}
+		}
+		report.Issues = append(report.Issues, LintIssue{Rule: rule, Line: line, Message: fmt.Sprintf(format, args...), Fixable: fixable})
+		report.Counts[rule]++
+		if fixable {
+			report.Fixable++
+		}
+	}
+
+	fence := ""
+	prevLevel := 0
+	seen := make(map[string]int)
+	lines := strings.Split(src, "\n")
+	for i, line := range lines {
+		n := i + 1
+		if m := reLintFence.FindStringSubmatch(line); m != nil {
+			switch {
+			case fence == "":
+				fence = m[1]
+			case strings.HasPrefix(m[1], fence) && strings.TrimSpace(line) == m[1]:
+				fence = ""
+			}
+			continue
+		}
+		if fence != "" {
+			continue
+		}
+
+		if c := len(reEntitySpace.FindAllString(line, -1)); c > 0 {
+			add("entity-space", n, "%d &#x20; %s", c, plural(c, "entity", "entities"))
+		}
+		for _, m := range reLinkDest.FindAllStringSubmatch(line, -1) {
+			if reDestEscape.MatchString(m[1]) {
+				add("url-escape", n, "escaped %s in link destination", strings.Join(uniqueStrings(reDestEscape.FindAllString(m[1], -1)), " "))
+			}
+		}
+		if reSplitRun.MatchString(line) {
+			add("split-text", n, "text split into adjacent runs")
+		}
+		if c := len(rePlaceholderAlt.FindAllString(line, -1)); c > 0 {
+			add("placeholder-alt", n, "%d %s with placeholder alt text", c, plural(c, "image", "images"))
+		}
+		if reTrailingSpace.MatchString(line) && !hardBreak(line, lines[i+1:]) {
+			add("trailing-space", n, "trailing whitespace")
+		}
+
+		m := reATXHeading.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		level := len(m[1])
+		if prevLevel > 0 && level > prevLevel+1 {
+			add("heading-jump", n, "h%d follows h%d", level, prevLevel)
+		}
+		prevLevel = level
+		text := strings.TrimSpace(nodeText(&Node{Type: "heading", Children: parseInline(m[2])}))
+		key := strings.ToLower(strings.Join(strings.Fields(text), " "))
+		if key == "" {
+			continue
+		}
+		if first, ok := seen[key]; ok {
+			add("duplicate-heading", n, "%q repeats the heading on line %d", text, first)
+		} else {
+			seen[key] = n
+		}
+	}
+	return report
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
+
+func uniqueStrings(values []string) []string {
+	var out []string
+	for _, v := range values {
+		if !slices.Contains(out, v) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// cleanupTree applies the tree-level fixes to a parsed page and returns
+// the number of changes
+func cleanupTree(root *Node, rules lintRuleSet) int {
+	changed := 0
+	if rules["split-text"] {
+		changed += mergeSplitRuns(root)
+	}
+	if rules["placeholder-alt"] {
+		walkNodes(root, func(n *Node) bool {
+			if n.Type == "image" && n.Alt == placeholderAlt {
+				n.Alt = ""
+				changed++
+			}
+			return true
+		})
+	}
+	return changed
+}
+
+// inlineParents are the nodes whose children are inline content
+var inlineParents = map[string]bool{
+	"paragraph": true, "heading": true, "tableCell": true,
+	"strong": true, "emphasis": true, "delete": true, "link": true,
+}
+
+// mergeSplitRuns joins adjacent text nodes and adjacent runs of the same
+// formatting, dropping the empty comments used to keep them apart
+func mergeSplitRuns(n *Node) int {
+	changed := 0
+	for _, c := range n.Children {
+		changed += mergeSplitRuns(c)
+	}
+	if !inlineParents[n.Type] {
+		return changed
+	}
+	var out []*Node
+	for _, c := range n.Children {
+		if c.Type == "html" && reEmptyComment.MatchString(strings.TrimSpace(c.Value)) {
+			changed++
+			continue
+		}
+		if len(out) > 0 {
+			prev := out[len(out)-1]
+			switch {
+			case prev.Type == "text" && c.Type == "text":
+				prev.Value += c.Value
+				changed++
+				continue
+			case prev.Type == c.Type && (c.Type == "strong" || c.Type == "emphasis" || c.Type == "delete"):
+				prev.Children = mergeText(append(prev.Children, c.Children...))
+				changed++
+				continue
+			}
+		}
+		out = append(out, c)
+	}
+	n.Children = out
+	return changed
+}
+
+// cleanupMarkdown fixes Loop artifacts in a page's markdown. The page is
+// re-rendered only when an enabled fix applies, which also normalizes
+// escapes and entities; otherwise the markdown is returned as exported.
+func cleanupMarkdown(src string, rules lintRuleSet) (string, int) {
+	fixes := lintMarkdown("", src, rules).Fixable
+	root := parseMarkdown(src)
+	treeFixes := cleanupTree(root, rules)
+	if fixes == 0 && treeFixes == 0 {
+		return src, 0
+	}
+	return renderMarkdown(root, markdownOptions{}), max(fixes, treeFixes)
+}
+
+// cleanupOnLoad runs the cleanup stage over a freshly read export unless
+// the config turns it off
+func cleanupOnLoad(content *Content) {
+	cfg := globalConfig.Lint
+	if cfg.NoCleanup {
+		return
+	}
+	rules, err := newLintRuleSet(cfg.Disable)
+	if err != nil {
+		slog.Warn(err.Error())
+		return
+	}
+	cleaned, fixed := cleanupMarkdown(content.Markdown, rules)
+	if fixed == 0 {
+		return
+	}
+	content.Markdown = cleaned
+	slog.Info(fmt.Sprintf("Cleanup: fixed %d Loop %s in %s", fixed, plural(fixed, "artifact", "artifacts"), content.TarFile))
+	if report := lintMarkdown(content.TarFile, cleaned, rules); len(report.Issues) > 0 {
+		slog.Warn(fmt.Sprintf("Lint: %d %s left in %s (see /api/lint)", len(report.Issues), plural(len(report.Issues), "issue", "issues"), content.TarFile))
+	}
+}
+
+// handleLint lints the loaded page as it is served, after cleanup
+func handleLint(w http.ResponseWriter, r *http.Request) {
+	contentMu.RLock()
+	content := currentContent
+	contentMu.RUnlock()
+
+	if content == nil {
+		http.Error(w, "No content loaded", 404)
+		return
+	}
+	rules, err := newLintRuleSet(globalConfig.Lint.Disable)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(lintMarkdown(content.TarFile, content.Markdown, rules))
+}
+
+// cleanedName names the cleaned copy of an export
+func cleanedName(tarFile string) string {
+	return strings.TrimSuffix(tarFile, ".tar") + " (cleaned).tar"
+}
+
+func runLint(args []string) error {
+	cfg := loadConfig().Lint
+
+	fs := newFlagSet("lint")
+	fix := fs.Bool("fix", false, "Write a cleaned copy of each export: \"<name> (cleaned).tar\"")
+	out := fs.String("out", "", "Directory for cleaned copies (default: beside each original)")
+	disable := fs.String("disable", strings.Join(cfg.Disable, ","), "Comma-separated rules to skip: "+strings.Join(lintRuleNames(), ", "))
+	asJSON := fs.Bool("json", false, "Print reports as JSON")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) == 0 {
+		fs.Usage()
+		return fmt.Errorf("expected at least one tar file or directory")
+	}
+	rules, err := newLintRuleSet(splitList(*disable))
+	if err != nil {
+		return err
+	}
+	paths, err := expandExportArgs(positional)
+	if err != nil {
+		return err
+	}
+
+	successStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#10B981")).Bold(true)
+	pathStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#FBBF24"))
+	reports := []*LintReport{}
+	issues := 0
+	for _, p := range paths {
+		content, err := readTar(p)
+		if err != nil {
+			return fmt.Errorf("%s: %w", p, err)
+		}
+		report := lintMarkdown(content.TarFile, content.Markdown, rules)
+		reports = append(reports, report)
+
+		if !*fix {
+			issues += len(report.Issues)
+			continue
+		}
+		cleaned, fixed := cleanupMarkdown(content.Markdown, rules)
+		issues += len(lintMarkdown(content.TarFile, cleaned, rules).Issues)
+		if fixed == 0 {
+			continue
+		}
+		dir := filepath.Dir(p)
+		if *out != "" {
+			dir = expandHome(*out)
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return fmt.Errorf("create %s: %w", dir, err)
+			}
+		}
+		dst := filepath.Join(dir, cleanedName(content.TarFile))
+		var buf bytes.Buffer
+		err = rewriteTar(p, &buf, func(name string, data []byte) []byte {
+			if name == "content.md" {
+				return []byte(cleaned)
+			}
+			return data
+		})
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(dst, buf.Bytes(), 0644); err != nil {
+			return fmt.Errorf("write %s: %w", dst, err)
+		}
+		fmt.Fprintf(os.Stderr, "%s %s\n", successStyle.Render(fmt.Sprintf("✓ Fixed %d %s into", fixed, plural(fixed, "issue", "issues"))), pathStyle.Render(dst))
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(reports); err != nil {
+			return err
+		}
+	} else {
+		for _, report := range reports {
+			for _, is := range report.Issues {
+				fmt.Printf("%s:%d: %s: %s\n", report.File, is.Line, is.Rule, is.Message)
+			}
+		}
+	}
+	if issues > 0 {
+		return fmt.Errorf("%d lint %s", issues, plural(issues, "issue", "issues"))
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestLintTrailingSpace(t *testing.T) {
+	tests := []struct {
+		name, src string
+		want      int
+	}{
+		{"hard break", "line one  \nline two\n", 0},
+		{"hard break in a list", "- item  \n  continued\n", 0},
+		{"one space", "line one \nline two\n", 1},
+		{"three spaces", "line one   \nline two\n", 1},
+		{"tab", "line one\t\nline two\n", 1},
+		{"end of paragraph", "line one  \n\nline two\n", 1},
+		{"end of file", "line one  ", 1},
+	}
+	rules, err := newLintRuleSet(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		if got := lintMarkdown("", tt.src, rules).Counts["trailing-space"]; got != tt.want {
+			t.Errorf("%s: %d trailing-space issues, want %d", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ============================================================
+// Logging
+// ============================================================
+//
+// Server events go through log/slog. One logger fans out to the TUI's
+// event log, to stderr when there is no TUI (text or JSON), and to an
+// optional size-rotated log file. The TUI and daemon event streams read
+// from unbounded queues, so no message is dropped however busy the
+// server gets. Messages are complete sentences for the TUI; attributes
+// carry the same facts for machine-readable outputs.
+
+// LevelSuccess sits between info and warn and is shown in green in the TUI
+const LevelSuccess = slog.LevelInfo + 2
+
+// LogConfig configures log outputs
+type LogConfig struct {
+	Format    string `json:"format,omitempty"`      // stderr format: text (default) or json
+	Level     string `json:"level,omitempty"`       // debug, info (default), warn or error
+	File      string `json:"file,omitempty"`        // also write JSON lines to this file
+	MaxSizeMB int    `json:"max_size_mb,omitempty"` // rotate the file at this size (default 10)
+	MaxFiles  int    `json:"max_files,omitempty"`   // rotated files to keep (default 3)
+}
+
+// logSuccess logs at LevelSuccess with the default logger
+func logSuccess(msg string, args ...any) {
+	slog.Log(context.Background(), LevelSuccess, msg, args...)
+}
+
+// levelStyle maps a level to the TUI's log styles
+func levelStyle(level slog.Level) string {
+	switch {
+	case level >= slog.LevelError:
+		return "error"
+	case level >= slog.LevelWarn:
+		return "warn"
+	case level >= LevelSuccess:
+		return "success"
+	default:
+		return "info"
+	}
+}
+
+// parseLevel reads a level name, defaulting to info
+func parseLevel(name string) (slog.Level, error) {
+	switch strings.ToLower(name) {
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "debug":
+		return slog.LevelDebug, nil
+	case "success":
+		return LevelSuccess, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q (want debug, info, warn or error)", name)
+}
+
+// replaceLevel names LevelSuccess in text and JSON output
+func replaceLevel(groups []string, a slog.Attr) slog.Attr {
+	if a.Key == slog.LevelKey && len(groups) == 0 {
+		if level, ok := a.Value.Any().(slog.Level); ok && level == LevelSuccess {
+			a.Value = slog.StringValue("SUCCESS")
+		}
+	}
+	return a
+}
+
+// setupLogging installs the default logger. stderr is used when the TUI is
+// not. The returned function closes the log file.
+func setupLogging(cfg LogConfig, toStderr bool) (func(), error) {
+	level, err := parseLevel(cfg.Level)
+	if err != nil {
+		return nil, err
+	}
+	opts := &slog.HandlerOptions{Level: level, ReplaceAttr: replaceLevel}
+
+	handlers := []slog.Handler{&hubHandler{level: level}}
+	if toStderr {
+		h, err := stderrHandler(cfg.Format, opts)
+		if err != nil {
+			return nil, err
+		}
+		handlers = append(handlers, h)
+	}
+	closeFile := func() {}
+	if cfg.File != "" {
+		f, err := newRotatingFile(expandHome(cfg.File), cfg.MaxSizeMB, cfg.MaxFiles)
+		if err != nil {
+			return nil, fmt.Errorf("log file: %w", err)
+		}
+		handlers = append(handlers, slog.NewJSONHandler(f, opts))
+		closeFile = func() { f.Close() }
+	}
+	slog.SetDefault(slog.New(fanoutHandler(handlers)))
+	return closeFile, nil
+}
+
+// stderrHandler writes text or JSON to stderr
+func stderrHandler(format string, opts *slog.HandlerOptions) (slog.Handler, error) {
+	switch strings.ToLower(format) {
+	case "", "text":
+		return slog.NewTextHandler(os.Stderr, opts), nil
+	case "json":
+		return slog.NewJSONHandler(os.Stderr, opts), nil
+	}
+	return nil, fmt.Errorf("unknown log format %q (want text or json)", format)
+}
+
+// fallBackToStderr moves logging from the TUI's queue to stderr when the
+// TUI fails to start, printing what the queue already holds first
+func fallBackToStderr(cfg LogConfig, events *logQueue) {
+	unsubscribeLogs(events)
+	for _, msg := range events.drain() {
+		fmt.Fprintln(os.Stderr, msg.text)
+	}
+	level, _ := parseLevel(cfg.Level)
+	h, err := stderrHandler(cfg.Format, &slog.HandlerOptions{Level: level, ReplaceAttr: replaceLevel})
+	if err != nil {
+		return // setupLogging already accepted the format
+	}
+	slog.SetDefault(slog.New(fanoutHandler{slog.Default().Handler(), h}))
+}
+
+// ------------------------------------------------------------
+// Fan-out
+// ------------------------------------------------------------
+
+// fanoutHandler sends each record to every handler that accepts it
+type fanoutHandler []slog.Handler
+
+func (h fanoutHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, c := range h {
+		if c.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h fanoutHandler) Handle(ctx context.Context, r slog.Record) error {
+	var first error
+	for _, c := range h {
+		if c.Enabled(ctx, r.Level) {
+			if err := c.Handle(ctx, r.Clone()); err != nil && first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+func (h fanoutHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	out := make(fanoutHandler, len(h))
+	for i, c := range h {
+		out[i] = c.WithAttrs(attrs)
+	}
+	return out
+}
+
+func (h fanoutHandler) WithGroup(name string) slog.Handler {
+	out := make(fanoutHandler, len(h))
+	for i, c := range h {
+		out[i] = c.WithGroup(name)
+	}
+	return out
+}
+
+// ------------------------------------------------------------
+// TUI and event stream subscribers
+// ------------------------------------------------------------
+
+// logQueue is an unbounded queue of log messages for one reader
+type logQueue struct {
+	mu    sync.Mutex
+	msgs  []logMsg
+	ready chan struct{} // signalled when msgs becomes non-empty
+}
+
+func newLogQueue() *logQueue {
+	return &logQueue{ready: make(chan struct{}, 1)}
+}
+
+// push appends a message without blocking
+func (q *logQueue) push(msg logMsg) {
+	q.mu.Lock()
+	q.msgs = append(q.msgs, msg)
+	q.mu.Unlock()
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// drain removes and returns every queued message
+func (q *logQueue) drain() []logMsg {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	msgs := q.msgs
+	q.msgs = nil
+	return msgs
+}
+
+// next waits for the next message; ok is false once done is closed
+func (q *logQueue) next(done <-chan struct{}) (msg logMsg, ok bool) {
+	for {
+		q.mu.Lock()
+		if len(q.msgs) > 0 {
+			msg = q.msgs[0]
+			q.msgs = q.msgs[1:]
+			q.mu.Unlock()
+			return msg, true
+		}
+		q.mu.Unlock()
+		select {
+		case <-q.ready:
+		case <-done:
+			return msg, false
+		}
+	}
+}
+
+// logHub holds the queues of the TUI and attached daemon clients
+var logHub = struct {
+	sync.Mutex
+	queues map[*logQueue]struct{}
+}{queues: make(map[*logQueue]struct{})}
+
+// subscribeLogs returns a queue that receives every message from now on
+func subscribeLogs() *logQueue {
+	q := newLogQueue()
+	logHub.Lock()
+	logHub.queues[q] = struct{}{}
+	logHub.Unlock()
+	return q
+}
+
+// unsubscribeLogs stops delivering messages to q
+func unsubscribeLogs(q *logQueue) {
+	logHub.Lock()
+	delete(logHub.queues, q)
+	logHub.Unlock()
+}
+
+// hubHandler delivers records to subscribed queues as TUI log messages
+type hubHandler struct {
+	level slog.Level
+}
+
+func (h *hubHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h *hubHandler) Handle(_ context.Context, r slog.Record) error {
+	msg := logMsg{text: r.Message, style: levelStyle(r.Level)}
+	logHub.Lock()
+	for q := range logHub.queues {
+		q.push(msg)
+	}
+	logHub.Unlock()
+	return nil
+}
+
+// Attributes repeat facts already in the message, so the TUI ignores them
+func (h *hubHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+func (h *hubHandler) WithGroup(string) slog.Handler      { return h }
+
+// ------------------------------------------------------------
+// Rotating log file
+// ------------------------------------------------------------
+
+// rotatingFile is a log file that moves to name.1, name.2, ... when it
+// reaches its size limit
+type rotatingFile struct {
+	mu       sync.Mutex
+	path     string
+	maxBytes int64
+	maxFiles int
+	file     *os.File
+	size     int64
+}
+
+var _ io.WriteCloser = (*rotatingFile)(nil)
+
+func newRotatingFile(path string, maxSizeMB, maxFiles int) (*rotatingFile, error) {
+	if maxSizeMB <= 0 {
+		maxSizeMB = 10
+	}
+	if maxFiles <= 0 {
+		maxFiles = 3
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	f := &rotatingFile{path: path, maxBytes: int64(maxSizeMB) << 20, maxFiles: maxFiles}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+// rotate shifts name.N-1 to name.N down to name itself and starts afresh
+func (f *rotatingFile) rotate() error {
+	f.file.Close()
+	for i := f.maxFiles - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", f.path, i), fmt.Sprintf("%s.%d", f.path, i+1))
+	}
+	os.Rename(f.path, f.path+".1")
+	return f.open()
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.size > 0 && f.size+int64(len(p)) > f.maxBytes {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *rotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.file.Sync(); err != nil {
+		f.file.Close()
+		return err
+	}
+	return f.file.Close()
+}
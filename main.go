@@ -2,15 +2,14 @@
 package main
 
 import (
-	"archive/tar"
 	"context"
 	"embed"
-	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"html/template"
-	"io"
+	"log/slog"
 	"net"
 	"net/http"
 	"os"
@@ -27,6 +26,7 @@ import (
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/term"
 	"github.com/fsnotify/fsnotify"
 )
 
@@ -57,15 +57,26 @@ var (
 // Config holds application settings
 type Config struct {
 	Port        int               `json:"port"`
+	Bind        string            `json:"bind,omitempty"` // listen address, 127.0.0.1 by default
+	LAN         bool              `json:"lan,omitempty"`  // allow binding beyond loopback
+	TLS         bool              `json:"tls,omitempty"`  // serve HTTPS with a locally trusted certificate
 	WatchDir    string            `json:"watch_dir"`
 	OpenBrowser bool              `json:"open_browser"`
 	Templates   map[string]string `json:"templates,omitempty"` // name -> file path
+	Convert     ConvertConfig     `json:"convert,omitzero"`
+	LinkCheck   LinkCheckConfig   `json:"link_check,omitzero"`
+	Redact      RedactConfig      `json:"redact,omitzero"`
+	Lint        LintConfig        `json:"lint,omitzero"`
+	Access      AccessConfig      `json:"access,omitzero"`
+	Log         LogConfig         `json:"log,omitzero"`
+	Limits      LimitsConfig      `json:"limits,omitzero"`
 }
 
 // DefaultConfig returns sensible defaults
 func DefaultConfig() Config {
 	return Config{
 		Port:        8080,
+		Bind:        defaultBind,
 		WatchDir:    ".",
 		OpenBrowser: true,
 		Templates:   make(map[string]string),
@@ -79,6 +90,13 @@ var (
 	// Command line flags
 	flagPort         = flag.Int("port", 0, "HTTP server port (0 = auto-find free port)")
 	flagDir          = flag.String("dir", "", "Directory to watch for .tar files")
+	flagBind         = flag.String("bind", "", "Address to listen on (default 127.0.0.1)")
+	flagLAN          = flag.Bool("lan", false, "Share the preview on your local network")
+	flagTLS          = flag.Bool("tls", false, "Serve HTTPS with a locally generated certificate")
+	flagLogFormat    = flag.String("log-format", "", "Log format on stderr: text or json")
+	flagLogFile      = flag.String("log-file", "", "Also write logs to this file, rotated by size")
+	flagDaemon       = flag.Bool("daemon", false, "Run headless with the daemon control socket")
+	flagAttach       = flag.Bool("attach", false, "Run the TUI against a running daemon")
 	flagOpen         = flag.Bool("open", true, "Open browser automatically")
 	flagNoOpen       = flag.Bool("no-open", false, "Do not open browser")
 	flagConfig       = flag.String("config", "", "Path to config file")
@@ -98,13 +116,24 @@ markdown preview at http://localhost:<port>
 
 USAGE:
     %s [OPTIONS]
+    %s <command> [ARGS]
+
+COMMANDS:
+%s
 
 OPTIONS:
     --port <n>       HTTP server port (default: 8080, 0 = find free port)
     --dir <path>     Directory to watch (default: current directory)
+    --bind <addr>    Address to listen on (default: 127.0.0.1)
+    --lan            Share on your local network (all interfaces unless --bind)
+    --tls            Serve HTTPS with a locally generated certificate
     --open           Open browser automatically (default: true)
     --no-open        Do not open browser automatically
     --headless       Run without TUI, Ctrl+C to quit
+    --log-format <f> Log format without the TUI: text (default) or json
+    --log-file <path>  Also write JSON logs to a size-rotated file
+    --daemon         Run headless with the control socket (see loopd daemon)
+    --attach         Run the TUI against a running daemon
     --copy-script    Copy export script to clipboard and exit
     --export-plugin <dir>  Export Figma plugin to directory and exit
     --config <path>  Path to config file (default: XDG config dir)
@@ -125,6 +154,7 @@ CONFIG FILE:
     Example settings.json:
     {
       "port": 8080,
+      "bind": "127.0.0.1",
       "watch_dir": ".",
       "open_browser": false
     }
@@ -135,17 +165,23 @@ EXAMPLES:
     %s --port 3000 --no-open     # Use port 3000, don't open browser
     %s --headless                 # Run without TUI, Ctrl+C to quit
     %s --save-config             # Save current settings for next time
+    %s site ~/Loop --out ./kb    # Publish a folder of exports as HTML
+    %s convert ~/Loop --target hugo --out ./blog   # Markdown with front matter
 
-`, appName, version, appName, appName, appName, appName, appName, appName, appName, appName)
+`, appName, version, appName, appName, subcommandHelp(), appName, appName, appName, appName, appName, appName, appName, appName, appName)
 	}
 }
 
 type Content struct {
-	Markdown string
-	Images   map[string]string // filename -> base64 data URL
-	LoadedAt time.Time
-	TarFile  string
-	TarPath  string // full path to the tar file
+	Markdown  string
+	Images    map[string]string // filename -> base64 data URL
+	LoadedAt  time.Time
+	TarFile   string
+	TarPath   string // full path to the tar file
+	SourceURL string // Loop page URL from metadata.json, if recorded
+	Version   string // hash of the archive, for ETags
+
+	AutomationTypes map[string]AutomationType // from automation-types.json, if recorded
 }
 
 var (
@@ -185,14 +221,18 @@ type model struct {
 	logs        []logEntry
 	maxLogs     int
 	url         string
+	network     []string // LAN addresses, when shared
+	bound       string   // listener address
 	watchDir    string
 	quitting    bool
 	width       int
 	height      int
-	logChan     chan logMsg
+	events      *logQueue // log messages for the event log
 	mode        uiMode
 	ready       bool // viewport initialized
 	showWelcome bool
+	daemon      *daemonClient // set when attached to a background daemon
+	remote      *DaemonStatus // the attached daemon's last status
 }
 
 type logEntry struct {
@@ -201,9 +241,6 @@ type logEntry struct {
 	style string
 }
 
-// Global channel for log messages
-var tuiLogChan chan logMsg
-
 // Welcome screen content for interactive TUI (no ASCII art)
 func getWelcomeContent() string {
 	return `
@@ -233,7 +270,7 @@ func getWelcomeContent() string {
 `
 }
 
-func initialModel(url, watchDir string, logChan chan logMsg) model {
+func initialModel(url string, network []string, bound, watchDir string, events *logQueue) model {
 	// Text input
 	ti := textinput.New()
 	ti.Placeholder = "Type /script to export file or press Tab to browse files..."
@@ -277,8 +314,10 @@ func initialModel(url, watchDir string, logChan chan logMsg) model {
 		logs:        []logEntry{},
 		maxLogs:     100,
 		url:         url,
+		network:     network,
+		bound:       bound,
 		watchDir:    watchDir,
-		logChan:     logChan,
+		events:      events,
 		mode:        modeNormal,
 		showWelcome: true,
 	}
@@ -303,7 +342,10 @@ func tickCmd() tea.Cmd {
 
 func (m model) listenForLogs() tea.Cmd {
 	return func() tea.Msg {
-		msg := <-m.logChan
+		msg, ok := m.events.next(app.Done())
+		if !ok {
+			return nil
+		}
 		return msg
 	}
 }
@@ -344,7 +386,11 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			// Check if a .tar file was selected (AllowedTypes filters to .tar only)
 			if didSelect, path := m.filepicker.DidSelectFile(msg); didSelect {
 				m.mode = modeNormal
-				go loadTar(path)
+				if m.daemon != nil {
+					cmds = append(cmds, m.daemon.commandCmd("load", path))
+				} else {
+					go loadTar(path)
+				}
 				m.addLog(fmt.Sprintf("Loading: %s", filepath.Base(path)), "info")
 			}
 
@@ -390,6 +436,12 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	case tickMsg:
 		cmds = append(cmds, tickCmd())
+		if m.daemon != nil {
+			cmds = append(cmds, m.daemon.statusCmd())
+		}
+
+	case daemonStatusMsg:
+		m.remote = msg.status
 
 	case clearFilePickerMsg:
 		// Reset filepicker state if needed
@@ -505,6 +557,14 @@ func (m model) handleCommand(input string) tea.Cmd {
 			return m.cmdReload()
 		case "/script", "/export":
 			return m.cmdScript()
+		case "/plugin":
+			dir := "~/loopd-figma-plugin"
+			if len(args) > 0 {
+				dir = strings.Join(args, " ")
+			}
+			return m.cmdPlugin(dir)
+		case "/diagnostics", "/diag":
+			return m.cmdDiagnostics()
 		default:
 			return func() tea.Msg {
 				return logMsg{text: fmt.Sprintf("Unknown command: %s (try /help)", cmd), style: "error"}
@@ -532,6 +592,7 @@ func (m model) cmdHelp() tea.Cmd {
   /dir, /d        Show watched directory
   /reload, /r     Reload current tar file
   /script         Copy export script to clipboard
+  /diagnostics    Loop components the converter drops, across exports
   /plugin [dir]   Export Figma plugin to ~/loopd-figma-plugin (or dir)
   /clear, /c      Clear event log
   /quit, /q       Exit (Ctrl+C also works)`
@@ -562,10 +623,14 @@ func (m model) cmdLoad(path string) tea.Cmd {
 		}
 	}
 
-	go loadTar(path)
-	return func() tea.Msg {
+	loading := func() tea.Msg {
 		return logMsg{text: fmt.Sprintf("Loading: %s", filepath.Base(path)), style: "info"}
 	}
+	if m.daemon != nil {
+		return tea.Batch(loading, m.daemon.commandCmd("load", path))
+	}
+	go loadTar(path)
+	return loading
 }
 
 func (m *model) cmdChangeDir(path string) tea.Cmd {
@@ -596,15 +661,27 @@ func (m *model) cmdChangeDir(path string) tea.Cmd {
 		}
 	}
 
+	if m.daemon != nil {
+		if _, err := m.daemon.do("cd", absPath); err != nil {
+			return func() tea.Msg {
+				return logMsg{text: err.Error(), style: "error"}
+			}
+		}
+	}
 	m.watchDir = absPath
 	m.filepicker.CurrentDirectory = absPath
+	setLibraryDir(absPath)
+	if m.daemon != nil {
+		return nil // the daemon logs the change
+	}
+	app.watch(absPath)
 	return func() tea.Msg {
 		return logMsg{text: fmt.Sprintf("Watch directory changed to: %s", absPath), style: "success"}
 	}
 }
 
 func (m model) cmdOpen() tea.Cmd {
-	go openURL(m.url)
+	go openURL(withToken(m.url))
 	return func() tea.Msg {
 		return logMsg{text: fmt.Sprintf("Opening %s", m.url), style: "success"}
 	}
@@ -612,24 +689,20 @@ func (m model) cmdOpen() tea.Cmd {
 
 func (m model) cmdOpenTemplate(template string) tea.Cmd {
 	url := m.url + "/" + template
-	go openURL(url)
+	go openURL(withToken(url))
 	return func() tea.Msg {
 		return logMsg{text: fmt.Sprintf("Opening %s", url), style: "success"}
 	}
 }
 
 func (m model) cmdStatus() tea.Cmd {
-	contentMu.RLock()
-	content := currentContent
-	contentMu.RUnlock()
-
 	var status string
-	if content != nil {
+	if loaded := m.loaded(); loaded != nil {
 		status = fmt.Sprintf("Loaded: %s\nSize: %d bytes\nImages: %d\nTime: %s",
-			content.TarFile,
-			len(content.Markdown),
-			len(content.Images),
-			content.LoadedAt.Format("15:04:05"))
+			loaded.File,
+			loaded.Bytes,
+			loaded.Images,
+			loaded.LoadedAt.Format("15:04:05"))
 	} else {
 		status = "No content loaded"
 	}
@@ -638,6 +711,19 @@ func (m model) cmdStatus() tea.Cmd {
 	}
 }
 
+// loaded summarizes the served export, from the daemon when attached
+func (m model) loaded() *LoadedExport {
+	if m.daemon != nil {
+		if m.remote == nil {
+			return nil
+		}
+		return m.remote.Loaded
+	}
+	contentMu.RLock()
+	defer contentMu.RUnlock()
+	return loadedExport(currentContent)
+}
+
 func (m *model) cmdClear() tea.Cmd {
 	m.logs = []logEntry{}
 	m.viewport.SetContent("")
@@ -672,23 +758,51 @@ func (m model) cmdDir() tea.Cmd {
 }
 
 func (m model) cmdReload() tea.Cmd {
-	contentMu.RLock()
-	content := currentContent
-	contentMu.RUnlock()
-
-	if content == nil {
+	loaded := m.loaded()
+	if loaded == nil {
 		return func() tea.Msg {
 			return logMsg{text: "No content to reload", style: "warn"}
 		}
 	}
 
-	path := content.TarPath
+	path := loaded.Path
+	if m.daemon != nil {
+		return m.daemon.commandCmd("reload", "")
+	}
 	go loadTar(path)
 	return func() tea.Msg {
 		return logMsg{text: fmt.Sprintf("Reloading %s", filepath.Base(path)), style: "info"}
 	}
 }
 
+func (m model) cmdDiagnostics() tea.Cmd {
+	// Reads every export in the watch directory, so it runs off the update loop
+	return func() tea.Msg {
+		report, err := libraryDiagnostics()
+		if err != nil {
+			return logMsg{text: fmt.Sprintf("Error: %v", err), style: "error"}
+		}
+		if report.Exports == 0 {
+			return logMsg{text: "No exports with automation-types.json", style: "info"}
+		}
+		if report.Unhandled == 0 {
+			return logMsg{text: fmt.Sprintf("No unhandled components in %d %s", report.Exports, plural(report.Exports, "export", "exports")), style: "success"}
+		}
+		lines := []string{fmt.Sprintf("Unhandled components across %d %s:", report.Exports, plural(report.Exports, "export", "exports"))}
+		for _, c := range report.Components {
+			if c.Status != "unhandled" {
+				continue
+			}
+			line := fmt.Sprintf("  %-32s %4d in %d", c.Name, c.Count, len(c.Exports))
+			if c.Sample.Tag != "" {
+				line += fmt.Sprintf("  <%s>", c.Sample.Tag)
+			}
+			lines = append(lines, line)
+		}
+		return logMsg{text: strings.Join(lines, "\n"), style: "warn"}
+	}
+}
+
 func (m model) cmdScript() tea.Cmd {
 	if err := copyScriptToClipboard(); err != nil {
 		return func() tea.Msg {
@@ -709,7 +823,7 @@ func (m model) cmdPlugin(destDir string) tea.Cmd {
 		}
 	}
 
-	if err := exportFigmaPlugin(destDir); err != nil {
+	if err := exportFigmaPlugin(destDir, m.url, sessionToken); err != nil {
 		return func() tea.Msg {
 			return logMsg{text: fmt.Sprintf("Error: %v", err), style: "error"}
 		}
@@ -719,8 +833,9 @@ func (m model) cmdPlugin(destDir string) tea.Cmd {
 	}
 }
 
-// exportFigmaPlugin exports the embedded Figma plugin files to the specified directory
-func exportFigmaPlugin(destDir string) error {
+// exportFigmaPlugin exports the embedded Figma plugin files to the specified
+// directory, pointing the plugin at the server and its token
+func exportFigmaPlugin(destDir, server, token string) error {
 	// Create destination directory
 	if err := os.MkdirAll(destDir, 0755); err != nil {
 		return fmt.Errorf("creating directory: %w", err)
@@ -730,7 +845,7 @@ func exportFigmaPlugin(destDir string) error {
 	files := map[string][]byte{
 		"manifest.json": figmaManifest,
 		"code.js":       figmaCode,
-		"ui.html":       figmaUI,
+		"ui.html":       figmaPluginUI(server, token),
 	}
 
 	for filename, data := range files {
@@ -743,6 +858,30 @@ func exportFigmaPlugin(destDir string) error {
 	return nil
 }
 
+// pluginServer is the address and token baked into an exported Figma
+// plugin. A running daemon reports the address its listener is actually
+// bound to; otherwise only a fixed configured port can be known ahead.
+func pluginServer(cfg Config) (string, string, error) {
+	if st, err := newDaemonClient().status(); err == nil {
+		return st.URL, st.Token, nil
+	}
+	if cfg.Port == 0 {
+		return "", "", fmt.Errorf("no fixed port is configured and no daemon is running; start loopd --daemon first, or use /plugin in the TUI")
+	}
+	if cfg.TLS {
+		urlScheme = "https"
+	}
+	return localURL(&net.TCPAddr{IP: net.ParseIP(cfg.Bind)}, cfg.Port), cfg.Access.Token, nil
+}
+
+// figmaPluginUI fills the server settings into the plugin's UI
+func figmaPluginUI(server, token string) []byte {
+	ui := string(figmaUI)
+	ui = strings.Replace(ui, `const LOOPD_SERVER = "http://localhost:8080";`, fmt.Sprintf("const LOOPD_SERVER = %q;", server), 1)
+	ui = strings.Replace(ui, `const LOOPD_TOKEN = "";`, fmt.Sprintf("const LOOPD_TOKEN = %q;", token), 1)
+	return []byte(ui)
+}
+
 // copyScriptToClipboard copies the loopd.js export script to the system clipboard
 func copyScriptToClipboard() error {
 	// Load loopd.js content
@@ -848,20 +987,23 @@ func (m model) View() string {
 
 	// Header (fixed at top) - 2 lines
 	header := titleStyle.Render(fmt.Sprintf("%s v%s", appName, version))
-	urlLine := dimStyle.Render("  Preview: ") + urlStyle.Render(m.url) +
+	urlLine := dimStyle.Render("  Preview: ") + urlStyle.Render(withToken(m.url))
+	if len(m.network) > 0 {
+		urlLine += dimStyle.Render("  •  LAN: ") + urlStyle.Render(strings.Join(m.network, " "))
+	}
+	urlLine += dimStyle.Render("  •  Bound: "+m.bound) +
 		dimStyle.Render("  •  Watching: ") + pathStyle.Render(m.watchDir)
 
 	// Status bar content
-	contentMu.RLock()
-	statusContent := currentContent
-	contentMu.RUnlock()
-
 	var statusText string
-	if statusContent != nil {
+	if loaded := m.loaded(); loaded != nil {
 		statusText = fmt.Sprintf("📄 %s  •  %d images  •  %s",
-			statusContent.TarFile,
-			len(statusContent.Images),
-			statusContent.LoadedAt.Format("15:04:05"))
+			loaded.File,
+			loaded.Images,
+			loaded.LoadedAt.Format("15:04:05"))
+		if m.daemon != nil {
+			statusText += "  •  daemon"
+		}
 	} else {
 		statusText = "No content loaded  •  Press tab to load a .tar file or use /browse"
 	}
@@ -944,19 +1086,9 @@ func (m model) View() string {
 		modeText)
 }
 
-// tuiLog sends a log message to the TUI
-func tuiLog(text, style string) {
-	if tuiLogChan != nil {
-		select {
-		case tuiLogChan <- logMsg{text: text, style: style}:
-		default:
-			// Channel full, drop message
-		}
-	}
-}
-
-// runHeadless runs the server in non-interactive mode (like vite)
-func runHeadless(url, watchDir string) {
+// runHeadless runs the server in non-interactive mode (like vite) until
+// ctx is cancelled
+func runHeadless(ctx context.Context, url string, network []string, bound, watchDir string) {
 	headerStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#10B981")).Bold(true)
 	labelStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#3B82F6")).Bold(true)
 	urlStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#E5E7EB")).Underline(true)
@@ -966,77 +1098,76 @@ func runHeadless(url, watchDir string) {
 	fmt.Println()
 	fmt.Printf("  %s %s\n", headerStyle.Render(appName), dimStyle.Render("v"+version))
 	fmt.Println()
-	fmt.Printf("  %s  %s\n", labelStyle.Render("➜  Local:"), urlStyle.Render(url))
-	fmt.Printf("  %s  %s\n", labelStyle.Render("➜  Watch:"), pathStyle.Render(watchDir))
+	fmt.Printf("  %s    %s\n", labelStyle.Render("➜  Local:"), urlStyle.Render(withToken(url)))
+	if len(network) == 0 {
+		fmt.Printf("  %s  %s\n", labelStyle.Render("➜  Network:"), dimStyle.Render("use --lan to expose"))
+	}
+	for _, u := range network {
+		fmt.Printf("  %s  %s\n", labelStyle.Render("➜  Network:"), urlStyle.Render(withToken(u)))
+	}
+	fmt.Printf("  %s    %s\n", labelStyle.Render("➜  Token:"), pathStyle.Render(sessionToken))
+	fmt.Printf("  %s    %s\n", labelStyle.Render("➜  Bound:"), pathStyle.Render(bound))
+	fmt.Printf("  %s    %s\n", labelStyle.Render("➜  Watch:"), pathStyle.Render(watchDir))
 	fmt.Println()
 
-	// Block forever - server runs in goroutine, Ctrl+C to exit
-	select {}
+	// Block until Ctrl+C or SIGTERM - the server runs in goroutines
+	<-ctx.Done()
 }
 
-// handleAPIOpen opens the browser
+// handleAPIOpen opens the preview in the browser. Only the server's own
+// address is opened, since the URL carries the session token.
 func handleAPIOpen(w http.ResponseWriter, r *http.Request) {
-	port := r.URL.Query().Get("port")
-	if port == "" {
-		port = "8080"
-	}
-	url := fmt.Sprintf("http://localhost:%s", port)
-	openURL(url)
-	w.Header().Set("Content-Type", "application/json")
-	fmt.Fprintf(w, `{"opened": %q}`, url)
-}
-
-// handleAPIRoutes returns available routes
-func handleAPIRoutes(w http.ResponseWriter, r *http.Request) {
-	host := r.Host
-	if host == "" {
-		host = "localhost:8080"
-	}
-	base := fmt.Sprintf("http://%s", host)
-	routes := map[string]string{
-		"/":                 "Landing page with instructions",
-		"/minimal":          "Dark mode preview",
-		"/github":           "GitHub file browser style",
-		"/vignelli":         "Typography focused",
-		"/raw":              "Raw markdown content",
-		"/content":          "Markdown with image URLs resolved",
-		"/images/":          "Image browser",
-		"/api/status":       "Server status JSON",
-		"/api/tar":          "Download loaded tar file",
-		"/api/routes":       "This endpoint",
-		"/api/open":         "Open browser (query: ?port=8080)",
-		"/api/figma-detect": "Figma desktop and MCP server detection",
-		"/loopd.js":         "Export script for clipboard",
+	if serverURL == "" {
+		http.Error(w, "Server is not listening yet", http.StatusServiceUnavailable)
+		return
 	}
+	openURL(withToken(serverURL))
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"base":   base,
-		"routes": routes,
-	})
+	fmt.Fprintf(w, `{"opened": %q}`, serverURL)
 }
 
-// corsHandler adds CORS headers to allow cross-origin requests from iframes and data: URLs
+// corsHandler adds CORS headers for allowlisted origins, such as the Figma
+// plugin iframe (origin: null)
 func corsHandler(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Allow all origins, including data: URLs (origin: null)
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS, HEAD")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		w.Header().Set("Access-Control-Max-Age", "86400")
+		origin := r.Header.Get("Origin")
+		w.Header().Add("Vary", "Origin")
+		if !allowedOrigin(r, origin) {
+			http.Error(w, "Origin not allowed", http.StatusForbidden)
+			return
+		}
+		if origin != "" {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS, HEAD")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, "+tokenHeader)
+			w.Header().Set("Access-Control-Max-Age", "86400")
+		}
 
 		// Handle OPTIONS preflight requests
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusNoContent)
 			return
 		}
-
 		next(w, r)
 	}
 }
 
 func main() {
+	if runSubcommand() {
+		return
+	}
+
 	flag.Parse()
 
+	// The server takes no arguments, so anything left is a mistyped
+	// subcommand or a path meant for --dir
+	if flag.NArg() > 0 {
+		errorStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#EF4444")).Bold(true)
+		fmt.Fprintln(os.Stderr, errorStyle.Render(fmt.Sprintf("Error: unknown command %q", flag.Arg(0))))
+		fmt.Fprintf(os.Stderr, "\nCommands:\n%s\n\nRun %s --help for server options.\n", subcommandHelp(), appName)
+		os.Exit(2)
+	}
+
 	if *flagVersion {
 		// Colorized version output
 		nameStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#10B981")).Bold(true)
@@ -1122,7 +1253,16 @@ func main() {
 			}
 		}
 
-		if err := exportFigmaPlugin(destDir); err != nil {
+		cfg := loadConfig()
+		if *flagPort != 0 {
+			cfg.Port = *flagPort
+		}
+		cfg.TLS = cfg.TLS || *flagTLS
+		server, token, err := pluginServer(cfg)
+		if err == nil {
+			err = exportFigmaPlugin(destDir, server, token)
+		}
+		if err != nil {
 			errorStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#EF4444")).Bold(true)
 			fmt.Fprintln(os.Stderr, errorStyle.Render(fmt.Sprintf("Error: %v", err)))
 			os.Exit(1)
@@ -1151,6 +1291,11 @@ func main() {
 		fmt.Println()
 		fmt.Printf("  %s\n", textStyle.Render("Then run the plugin from Plugins → Development → loopd Markdown Importer"))
 		fmt.Println()
+		if cfg.Access.Token == "" {
+			fmt.Printf("  %s\n", textStyle.Render("Paste the session token from the loopd terminal into the plugin, or set"))
+			fmt.Printf("  %s\n", textStyle.Render("\"access\": {\"token\": ...} in settings.json to bake a fixed one in."))
+			fmt.Println()
+		}
 
 		os.Exit(0)
 	}
@@ -1159,6 +1304,15 @@ func main() {
 	cfg := loadConfig()
 	globalConfig = cfg
 
+	if *flagAttach {
+		if err := runAttached(); err != nil {
+			errorStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#EF4444")).Bold(true)
+			fmt.Fprintln(os.Stderr, errorStyle.Render(fmt.Sprintf("Error: %v", err)))
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Apply command line overrides
 	if *flagPort != 0 {
 		cfg.Port = *flagPort
@@ -1166,11 +1320,30 @@ func main() {
 	if *flagDir != "" {
 		cfg.WatchDir = *flagDir
 	}
+	if *flagBind != "" {
+		cfg.Bind = *flagBind
+	}
+	if *flagLAN {
+		cfg.LAN = true
+	}
+	if *flagTLS {
+		cfg.TLS = true
+	}
 	if *flagNoOpen {
 		cfg.OpenBrowser = false
 	} else if isFlagSet("open") {
 		cfg.OpenBrowser = *flagOpen
 	}
+	if *flagLogFormat != "" {
+		cfg.Log.Format = *flagLogFormat
+	}
+	if *flagLogFile != "" {
+		cfg.Log.File = *flagLogFile
+	}
+	if *flagDaemon {
+		*flagHeadless = true
+		cfg.OpenBrowser = false
+	}
 
 	// Save config if requested
 	if *flagSaveConfig {
@@ -1192,47 +1365,80 @@ func main() {
 		fmt.Fprintln(os.Stderr, errorStyle.Render(fmt.Sprintf("Error: %v", err)))
 		os.Exit(1)
 	}
+	setLibraryDir(absDir)
+
+	bind, err := resolveBind(cfg.Bind, cfg.LAN)
+	if err != nil {
+		errorStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#EF4444")).Bold(true)
+		fmt.Fprintln(os.Stderr, errorStyle.Render(fmt.Sprintf("Error: %v", err)))
+		os.Exit(1)
+	}
+
+	// Log to the TUI, or to stderr without one, plus the log file. Without
+	// a terminal on stdout there is no TUI to log to.
+	useTUI := !*flagHeadless && term.IsTerminal(os.Stdout.Fd())
+	closeLog, err := setupLogging(cfg.Log, !useTUI)
+	if err != nil {
+		errorStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#EF4444")).Bold(true)
+		fmt.Fprintln(os.Stderr, errorStyle.Render(fmt.Sprintf("Error: %v", err)))
+		os.Exit(1)
+	}
+	app.onShutdown(closeLog)
+	var events *logQueue
+	if useTUI {
+		events = subscribeLogs()
+	}
 
 	// Find available port
-	port, listener, err := findAvailablePort(cfg.Port)
+	port, listener, err := findAvailablePort(bind, cfg.Port)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Could not find available port: %v\n", err)
 		os.Exit(1)
 	}
 
-	url := fmt.Sprintf("http://localhost:%d", port)
+	if cfg.TLS {
+		urlScheme = "https"
+	}
+	url := localURL(listener.Addr(), port)
+	serverURL = url
+	network := networkURLs(listener.Addr(), port)
+	initSessionToken(cfg.Access)
 
-	// Create log channel for TUI
-	tuiLogChan = make(chan logMsg, 100)
+	var trustCA string
+	if cfg.TLS {
+		cert, created, err := loadOrCreateCert(tlsDir(), certHosts(listener.Addr(), network))
+		if err != nil {
+			errorStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#EF4444")).Bold(true)
+			fmt.Fprintln(os.Stderr, errorStyle.Render(fmt.Sprintf("Error: TLS certificate: %v", err)))
+			os.Exit(1)
+		}
+		listener = newTLSListener(listener, cert)
+		if created {
+			trustCA = filepath.Join(tlsDir(), caCertFile)
+		}
+	}
 
-	// HTTP handlers are registered on mux below (in main function)
+	if trustCA != "" && !*flagHeadless {
+		slog.Warn("Created a local CA for HTTPS\n" + strings.Join(trustInstructions(trustCA), "\n"))
+	}
 
 	// Create HTTP server with CORS middleware
 	mux := http.NewServeMux()
-
-	// Register handlers on mux
-	mux.HandleFunc("/", corsHandler(handleIndex))
-	mux.HandleFunc("/minimal", corsHandler(handleMinimal))
-	mux.HandleFunc("/github", corsHandler(handleGithub))
-	mux.HandleFunc("/vignelli", corsHandler(handleVignelli))
-	mux.HandleFunc("/t/", corsHandler(handleCustomTemplate))
-	mux.HandleFunc("/content", corsHandler(handleContent))
-	mux.HandleFunc("/raw", corsHandler(handleRaw))
-	mux.HandleFunc("/images/", corsHandler(handleImages))
-	mux.HandleFunc("/api/status", corsHandler(handleStatus))
-	mux.HandleFunc("/api/tar", corsHandler(handleTarDownload))
-	mux.HandleFunc("/api/routes", corsHandler(handleAPIRoutes))
-	mux.HandleFunc("/api/open", corsHandler(handleAPIOpen))
-	mux.HandleFunc("/api/figma-detect", corsHandler(handleFigmaDetect))
-	mux.HandleFunc("/loopd.js", corsHandler(handleLoopdJS))
-	mux.HandleFunc("/plugins/", corsHandler(handlePlugins))
-
-	// Start HTTP server in goroutine
-	go func() {
-		if err := http.Serve(listener, mux); err != nil {
-			tuiLog(fmt.Sprintf("HTTP server error: %v", err), "error")
+	registerRoutes(mux, newLimiter(globalConfig.Limits))
+
+	// Start HTTP server; Ctrl+C or SIGTERM shuts everything down
+	app.handleSignals()
+	app.serve(listener, instrument(mux))
+	if *flagDaemon {
+		if err := startControl(url, network, listener.Addr().String()); err != nil {
+			app.shutdown()
+			errorStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#EF4444")).Bold(true)
+			fmt.Fprintln(os.Stderr, errorStyle.Render(fmt.Sprintf("Error: %v", err)))
+			os.Exit(1)
 		}
-	}()
+	} else if st, err := newDaemonClient().status(); err == nil && !*flagHeadless {
+		slog.Info(fmt.Sprintf("A loopd daemon is also running at %s (pid %d); use %s --attach to work with it", st.URL, st.PID, appName))
+	}
 
 	// Check for existing tar files on startup
 	go func() {
@@ -1241,38 +1447,72 @@ func main() {
 	}()
 
 	// Start file watcher
-	go watchDirectory(absDir)
+	app.watch(absDir)
 
 	// Open browser if requested
 	if cfg.OpenBrowser {
 		go func() {
 			time.Sleep(500 * time.Millisecond)
-			openURL(url)
+			openURL(withToken(url))
 		}()
 	}
 
 	// Run in headless mode or TUI mode
 	if *flagHeadless {
-		runHeadless(url, absDir)
-		return
+		if trustCA != "" {
+			fmt.Println()
+			fmt.Println("  Created a local CA for HTTPS")
+			for _, line := range trustInstructions(trustCA) {
+				fmt.Println("  " + line)
+			}
+		}
+		runHeadless(app.ctx, url, network, listener.Addr().String(), absDir)
+		fmt.Println("  Shutting down...")
+		exitAfterShutdown()
 	}
 
 	// Run TUI (with graceful fallback for non-TTY environments)
-	p := tea.NewProgram(
-		initialModel(url, absDir, tuiLogChan),
-		tea.WithAltScreen(),
-	)
+	tuiErr := errors.New("no terminal")
+	if useTUI {
+		p := tea.NewProgram(
+			initialModel(url, network, listener.Addr().String(), absDir, events),
+			tea.WithAltScreen(),
+		)
+		go func() {
+			<-app.Done()
+			p.Quit()
+		}()
+		_, tuiErr = p.Run()
+		if tuiErr != nil {
+			fallBackToStderr(cfg.Log, events)
+		}
+	}
 
-	if _, err := p.Run(); err != nil {
+	if tuiErr != nil {
 		// TUI failed (likely no TTY available). Just keep the server running.
 		// Log the error but don't exit - the HTTP server is already running.
 		fmt.Fprintf(os.Stderr, "Note: Running in headless mode (no TUI available)\n")
-		fmt.Fprintf(os.Stderr, "Server running at: %s\n", url)
+		fmt.Fprintf(os.Stderr, "Server running at: %s (bound to %s)\n", withToken(url), listener.Addr())
+		for _, u := range network {
+			fmt.Fprintf(os.Stderr, "Network: %s\n", withToken(u))
+		}
 		fmt.Fprintf(os.Stderr, "Press Ctrl+C to stop\n")
 
-		// Keep the server running with a blocking call
-		select {}
+		// Keep the server running until Ctrl+C or SIGTERM
+		<-app.Done()
+		fmt.Fprintf(os.Stderr, "Shutting down...\n")
 	}
+	exitAfterShutdown()
+}
+
+// exitAfterShutdown stops the server cleanly and exits, non-zero if
+// requests or loads were cut off
+func exitAfterShutdown() {
+	if err := app.shutdown(); err != nil {
+		fmt.Fprintf(os.Stderr, "Shutdown: %v\n", err)
+		os.Exit(1)
+	}
+	os.Exit(0)
 }
 
 // isFlagSet checks if a flag was explicitly set on command line
@@ -1355,8 +1595,9 @@ func saveConfig(cfg Config) error {
 	return nil
 }
 
-// findAvailablePort finds a free port starting from the preferred port
-func findAvailablePort(preferred int) (int, net.Listener, error) {
+// findAvailablePort finds a free port on the bind address starting from
+// the preferred port
+func findAvailablePort(bind string, preferred int) (int, net.Listener, error) {
 	// If preferred is 0, let OS pick
 	if preferred == 0 {
 		preferred = 8080
@@ -1364,11 +1605,11 @@ func findAvailablePort(preferred int) (int, net.Listener, error) {
 
 	// Try preferred port first
 	for port := preferred; port < preferred+100; port++ {
-		addr := fmt.Sprintf(":%d", port)
+		addr := net.JoinHostPort(bind, strconv.Itoa(port))
 		listener, err := net.Listen("tcp", addr)
 		if err == nil {
 			if port != preferred {
-				tuiLog(fmt.Sprintf("Port %d in use, using %d instead", preferred, port), "warn")
+				slog.Warn(fmt.Sprintf("Port %d in use, using %d instead", preferred, port))
 			}
 			return port, listener, nil
 		}
@@ -1389,13 +1630,13 @@ func openURL(url string) {
 	case "windows":
 		cmd = exec.Command("cmd", "/c", "start", url)
 	default:
-		tuiLog(fmt.Sprintf("Cannot open browser on %s, please visit: %s", runtime.GOOS, url), "warn")
+		slog.Warn(fmt.Sprintf("Cannot open browser on %s, please visit: %s", runtime.GOOS, url))
 		return
 	}
 
 	if err := cmd.Start(); err != nil {
-		tuiLog(fmt.Sprintf("Failed to open browser: %v", err), "error")
-		tuiLog(fmt.Sprintf("Please open manually: %s", url), "info")
+		slog.Error(fmt.Sprintf("Failed to open browser: %v", err))
+		slog.Info(fmt.Sprintf("Please open manually: %s", url))
 	}
 }
 
@@ -1431,23 +1672,26 @@ func checkExistingTars(dir string) {
 	}
 
 	if newest != "" {
-		tuiLog(fmt.Sprintf("Found existing: %s", filepath.Base(newest)), "info")
+		slog.Info(fmt.Sprintf("Found existing: %s", filepath.Base(newest)))
 		loadTar(newest)
 	}
 }
 
-func watchDirectory(dir string) {
+// watchDirectory loads new exports in dir until ctx is cancelled
+func watchDirectory(ctx context.Context, dir string) {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
-		tuiLog(fmt.Sprintf("Failed to create watcher: %v", err), "error")
+		slog.Error(fmt.Sprintf("Failed to create watcher: %v", err))
 		return
 	}
 	defer watcher.Close()
 
 	if err := watcher.Add(dir); err != nil {
-		tuiLog(fmt.Sprintf("Failed to watch directory: %v", err), "error")
+		slog.Error(fmt.Sprintf("Failed to watch directory: %v", err))
 		return
 	}
+	metrics.watchers.Add(1)
+	defer metrics.watchers.Add(-1)
 
 	// Debounce map for file events
 	pending := make(map[string]time.Time)
@@ -1456,10 +1700,14 @@ func watchDirectory(dir string) {
 
 	for {
 		select {
+		case <-ctx.Done():
+			return
+
 		case event, ok := <-watcher.Events:
 			if !ok {
 				return
 			}
+			metrics.watcherEvents.inc(strings.ToLower(event.Op.String()))
 			if event.Op&(fsnotify.Create|fsnotify.Write) != 0 {
 				if strings.HasSuffix(event.Name, ".tar") {
 					// Accept: loop_export_*.tar, Loop Export*.tar, or *at [time].tar
@@ -1477,7 +1725,7 @@ func watchDirectory(dir string) {
 			if !ok {
 				return
 			}
-			tuiLog(fmt.Sprintf("Watcher error: %v", err), "error")
+			slog.Error(fmt.Sprintf("Watcher error: %v", err))
 
 		case <-ticker.C:
 			now := time.Now()
@@ -1485,7 +1733,7 @@ func watchDirectory(dir string) {
 				// Wait 1 second after last event before processing
 				if now.Sub(lastEvent) > time.Second {
 					delete(pending, path)
-					tuiLog(fmt.Sprintf("Detected: %s", filepath.Base(path)), "info")
+					slog.Info(fmt.Sprintf("Detected: %s", filepath.Base(path)), "path", path)
 					loadTar(path)
 				}
 			}
@@ -1493,58 +1741,39 @@ func watchDirectory(dir string) {
 	}
 }
 
-func loadTar(path string) {
-	f, err := os.Open(path)
-	if err != nil {
-		tuiLog(fmt.Sprintf("Failed to open tar: %v", err), "error")
-		return
-	}
-	defer f.Close()
-
-	content := &Content{
-		Images:   make(map[string]string),
-		LoadedAt: time.Now(),
-		TarFile:  filepath.Base(path),
-		TarPath:  path,
+// loadTar reads an export and makes it the served content
+func loadTar(path string) error {
+	if !app.beginLoad() {
+		return fmt.Errorf("shutting down")
 	}
+	defer app.endLoad()
 
-	tr := tar.NewReader(f)
-	for {
-		header, err := tr.Next()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			tuiLog(fmt.Sprintf("Tar read error: %v", err), "error")
-			return
-		}
-
-		if header.Typeflag == tar.TypeDir {
-			continue
-		}
-
-		data, err := io.ReadAll(tr)
-		if err != nil {
-			tuiLog(fmt.Sprintf("Failed to read %s: %v", header.Name, err), "error")
-			continue
-		}
-
-		name := header.Name
-		if name == "content.md" {
-			content.Markdown = string(data)
-		} else if strings.HasPrefix(name, "images/") {
-			imgName := strings.TrimPrefix(name, "images/")
-			mimeType := getMimeType(imgName)
-			b64 := base64.StdEncoding.EncodeToString(data)
-			content.Images[imgName] = fmt.Sprintf("data:%s;base64,%s", mimeType, b64)
-		}
+	start := time.Now()
+	content, err := readTar(path)
+	recordLoad(start, content, err)
+	if err != nil {
+		slog.Error(fmt.Sprintf("Failed to load %s: %v", filepath.Base(path), err), "path", path, "err", err)
+		return err
 	}
+	cleanupOnLoad(content)
 
 	contentMu.Lock()
 	currentContent = content
 	contentMu.Unlock()
+	dropRepresentations()
 
-	tuiLog(fmt.Sprintf("Loaded: %s (%d bytes, %d images)", content.TarFile, len(content.Markdown), len(content.Images)), "success")
+	logSuccess(fmt.Sprintf("Loaded: %s (%d bytes, %d images)", content.TarFile, len(content.Markdown), len(content.Images)),
+		"path", path, "bytes", len(content.Markdown), "images", len(content.Images))
+	// The check may ask the link mirror, so it runs after the page is
+	// served but still counts as part of the load for shutdown
+	if app.beginLoad() {
+		go func() {
+			defer app.endLoad()
+			logLinkCheck(content)
+		}()
+	}
+	logDiagnostics(content)
+	return nil
 }
 
 func getMimeType(filename string) string {
@@ -1591,12 +1820,16 @@ func handleIndex(w http.ResponseWriter, r *http.Request) {
 		HasContent   bool
 		TarFile      string
 		LoadedAt     string
+		Scheme       string
 		Port         int
+		Token        string
 		MarkdownSize string
 		ImageCount   int
 	}{
 		HasContent: content != nil,
+		Scheme:     urlScheme,
 		Port:       globalConfig.Port,
+		Token:      sessionToken,
 	}
 
 	if content != nil {
@@ -1838,13 +2071,13 @@ func handleContent(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Replace image references with base64 data URLs
-	md := content.Markdown
-	for filename, dataURL := range content.Images {
-		md = strings.ReplaceAll(md, "images/"+filename, dataURL)
-	}
-
-	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-	w.Write([]byte(md))
+	rep, _ := cachedRepresentation(content, previewKey("content", r), func(h http.Header) ([]byte, error) {
+		content := redactForPreview(h, r, content)
+		md := imageReplacer(content.Images, func(_, dataURL string) string { return dataURL }).Replace(content.Markdown)
+		h.Set("Content-Type", "text/plain; charset=utf-8")
+		return []byte(md), nil
+	})
+	serveRepresentation(w, r, rep)
 }
 
 func handleRaw(w http.ResponseWriter, r *http.Request) {
@@ -1858,13 +2091,13 @@ func handleRaw(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Replace image references with /images/ URLs for browser viewing
-	md := content.Markdown
-	for filename := range content.Images {
-		md = strings.ReplaceAll(md, "images/"+filename, "/images/"+filename)
-	}
-
-	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-	w.Write([]byte(md))
+	rep, _ := cachedRepresentation(content, previewKey("raw", r), func(h http.Header) ([]byte, error) {
+		content := redactForPreview(h, r, content)
+		md := imageReplacer(content.Images, func(name, _ string) string { return "/images/" + name }).Replace(content.Markdown)
+		h.Set("Content-Type", "text/plain; charset=utf-8")
+		return []byte(md), nil
+	})
+	serveRepresentation(w, r, rep)
 }
 
 func handleImages(w http.ResponseWriter, r *http.Request) {
@@ -1923,32 +2156,16 @@ li:last-child { border-bottom: none; }
 		return
 	}
 
-	// Parse data URL: data:image/png;base64,xxxx
-	parts := strings.SplitN(dataURL, ",", 2)
-	if len(parts) != 2 {
-		http.Error(w, "Invalid image data", 500)
-		return
-	}
-
-	// Extract MIME type from data:image/png;base64
-	mimeType := "image/png"
-	if strings.HasPrefix(parts[0], "data:") {
-		meta := strings.TrimPrefix(parts[0], "data:")
-		meta = strings.TrimSuffix(meta, ";base64")
-		if meta != "" {
-			mimeType = meta
-		}
-	}
-
-	// Decode base64
-	imgData, err := base64.StdEncoding.DecodeString(parts[1])
+	rep, err := cachedRepresentation(content, "images/"+name, func(h http.Header) ([]byte, error) {
+		mimeType, imgData, err := decodeDataURL(dataURL)
+		h.Set("Content-Type", mimeType)
+		return imgData, err
+	})
 	if err != nil {
 		http.Error(w, "Failed to decode image", 500)
 		return
 	}
-
-	w.Header().Set("Content-Type", mimeType)
-	w.Write(imgData)
+	serveRepresentation(w, r, rep)
 }
 
 func handleStatus(w http.ResponseWriter, r *http.Request) {
@@ -1963,10 +2180,11 @@ func handleStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	fmt.Fprintf(w, `{"loaded":true,"file":%q,"time":%q,"images":%d}`,
+	fmt.Fprintf(w, `{"loaded":true,"file":%q,"time":%q,"images":%d,"version":%q}`,
 		content.TarFile,
 		content.LoadedAt.Format(time.RFC3339),
-		len(content.Images))
+		len(content.Images),
+		content.Version)
 }
 
 func handleTarDownload(w http.ResponseWriter, r *http.Request) {
@@ -1979,16 +2197,27 @@ func handleTarDownload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The file on disk may have changed since it was loaded, so the ETag
+	// describes the file as it is opened rather than the loaded version
+	f, err := os.Open(content.TarPath)
+	if err != nil {
+		http.Error(w, "Could not open tar file", 500)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, "Could not read tar file", 500)
+		return
+	}
+
 	// Serve the tar file as application/x-tar
 	w.Header().Set("Content-Type", "application/x-tar")
 	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, content.TarFile))
-	// Prevent caching - always serve fresh content
-	w.Header().Set("Cache-Control", "no-store, no-cache, must-revalidate, max-age=0")
-	w.Header().Set("Pragma", "no-cache")
-	w.Header().Set("Expires", "0")
-
-	// Serve the file from disk
-	http.ServeFile(w, r, content.TarPath)
+	// Clients revalidate every time; an unchanged file is a 304
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, info.Size(), info.ModTime().UnixNano()))
+	http.ServeContent(w, r, content.TarFile, info.ModTime(), f)
 }
 
 func handlePlugins(w http.ResponseWriter, r *http.Request) {
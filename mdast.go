@@ -0,0 +1,902 @@
+package main
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ============================================================
+// Document Model (mdast)
+// ============================================================
+
+// Node is a markdown syntax tree node. The shape follows mdast, the tree
+// loopd.js builds before stringifying, so debug-mdast.json from an export
+// unmarshals into it directly.
+type Node struct {
+	Type     string   `json:"type"`
+	Value    string   `json:"value,omitempty"`
+	Depth    int      `json:"depth,omitempty"`
+	Ordered  bool     `json:"ordered,omitempty"`
+	Start    int      `json:"start,omitempty"`
+	Spread   bool     `json:"spread,omitempty"`
+	Checked  *bool    `json:"checked,omitempty"`
+	Lang     string   `json:"lang,omitempty"`
+	URL      string   `json:"url,omitempty"`
+	Title    string   `json:"title,omitempty"`
+	Alt      string   `json:"alt,omitempty"`
+	Align    []string `json:"align,omitempty"`
+	Callout  string   `json:"callout,omitempty"` // GitHub alert type on blockquotes: NOTE, TIP, ...
+	Fold     string   `json:"fold,omitempty"`    // "-" collapsed or "+" expanded callout
+	Children []*Node  `json:"children,omitempty"`
+}
+
+// walkNodes visits n and its descendants depth-first. Returning false from
+// fn skips the node's children.
+func walkNodes(n *Node, fn func(n *Node) bool) {
+	if n == nil || !fn(n) {
+		return
+	}
+	for _, c := range n.Children {
+		walkNodes(c, fn)
+	}
+}
+
+// nodeText returns the plain text content of a node
+func nodeText(n *Node) string {
+	var sb strings.Builder
+	walkNodes(n, func(c *Node) bool {
+		switch c.Type {
+		case "text", "inlineCode", "code":
+			sb.WriteString(c.Value)
+		case "image":
+			sb.WriteString(c.Alt)
+		case "break":
+			sb.WriteString("\n")
+		}
+		return true
+	})
+	return sb.String()
+}
+
+// Heading is an entry in a document outline
+type Heading struct {
+	Depth int    `json:"depth"`
+	Text  string `json:"text"`
+	Slug  string `json:"slug"`
+}
+
+// outline lists the document headings with GitHub-style anchor slugs
+func outline(root *Node) []Heading {
+	var headings []Heading
+	s := newSlugger()
+	walkNodes(root, func(n *Node) bool {
+		if n.Type == "heading" {
+			text := strings.TrimSpace(nodeText(n))
+			headings = append(headings, Heading{Depth: n.Depth, Text: text, Slug: s.slug(text)})
+			return false
+		}
+		return true
+	})
+	return headings
+}
+
+// slugger generates unique heading anchors the way GitHub does
+type slugger struct {
+	seen map[string]int
+}
+
+func newSlugger() *slugger {
+	return &slugger{seen: make(map[string]int)}
+}
+
+func (s *slugger) slug(text string) string {
+	base := slugify(text)
+	n, ok := s.seen[base]
+	s.seen[base] = n + 1
+	if !ok {
+		return base
+	}
+	return base + "-" + strconv.Itoa(n)
+}
+
+// slugify lowercases text, drops punctuation and joins words with dashes
+func slugify(text string) string {
+	var sb strings.Builder
+	for _, r := range strings.ToLower(strings.TrimSpace(text)) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsNumber(r) || r == '-' || r == '_':
+			sb.WriteRune(r)
+		case r == ' ':
+			sb.WriteRune('-')
+		}
+	}
+	return sb.String()
+}
+
+// ============================================================
+// Markdown Parser
+// ============================================================
+//
+// A block/inline parser for the GitHub-flavored markdown that loopd.js
+// emits via remark-stringify: headings, paragraphs, nested and task lists,
+// fenced code, pipe tables, blockquotes with alerts, images, links,
+// emphasis, strikethrough, autolinks and entities.
+
+var (
+	reATXHeading    = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	reThematicBreak = regexp.MustCompile(`^ {0,3}(?:(?:\*[ \t]*){3,}|(?:-[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	reFence         = regexp.MustCompile("^( {0,3})(`{3,}|~{3,})[ \t]*(.*)$")
+	reListItem      = regexp.MustCompile(`^( {0,3})([-*+]|\d{1,9}[.)])([ \t]+|$)`)
+	reTableDelim    = regexp.MustCompile(`^ {0,3}\|?[ \t]*:?-+:?[ \t]*(\|[ \t]*:?-+:?[ \t]*)*\|?[ \t]*$`)
+	reHTMLBlock     = regexp.MustCompile(`^ {0,3}(?:<!--|<(/?[a-zA-Z][a-zA-Z0-9-]*)(?:[ \t]|/?>|$))`)
+	reSetext        = regexp.MustCompile(`^ {0,3}(=+|-+)[ \t]*$`)
+	reAlertMarker   = regexp.MustCompile(`^\[!([A-Za-z]+)\]([+-]?)[ \t]*`)
+	reTaskMarker    = regexp.MustCompile(`^\[([ xX])\](?:[ \t]+|$)`)
+	reEntity        = regexp.MustCompile(`^&(?:#[0-9]{1,7}|#[xX][0-9a-fA-F]{1,6}|[a-zA-Z][a-zA-Z0-9]{1,31});`)
+	reAutolinkURI   = regexp.MustCompile(`^<([a-zA-Z][a-zA-Z0-9+.-]{1,31}:[^<>\s]*)>`)
+	reAutolinkEmail = regexp.MustCompile(`^<([a-zA-Z0-9.!#$%&'*+/=?^_` + "`" + `{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*)>`)
+	reInlineHTML    = regexp.MustCompile(`^<(?:/?[a-zA-Z][a-zA-Z0-9-]*(?:\s+[a-zA-Z_:][a-zA-Z0-9_.:-]*(?:\s*=\s*(?:"[^"]*"|'[^']*'|[^\s"'=<>` + "`" + `]+))?)*\s*/?>|!--[\s\S]*?-->)`)
+	reBareURL       = regexp.MustCompile(`^(?:https?://|www\.)[^\s<]*[^\s<?!.,:*_~'")\]]`)
+)
+
+// parseMarkdown parses markdown source into an mdast root node
+func parseMarkdown(src string) *Node {
+	src = strings.ReplaceAll(src, "\r\n", "\n")
+	src = strings.ReplaceAll(src, "\t", "    ")
+	return &Node{Type: "root", Children: parseBlocks(strings.Split(src, "\n"))}
+}
+
+func isBlank(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+// indentOf returns the number of leading spaces on a line
+func indentOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// stripIndent removes up to n leading spaces
+func stripIndent(line string, n int) string {
+	i := 0
+	for i < n && i < len(line) && line[i] == ' ' {
+		i++
+	}
+	return line[i:]
+}
+
+// interruptsParagraph reports whether a line starts a block that ends a paragraph
+func interruptsParagraph(line string) bool {
+	if reATXHeading.MatchString(line) || reThematicBreak.MatchString(line) ||
+		reFence.MatchString(line) || reHTMLBlock.MatchString(line) {
+		return true
+	}
+	trimmed := strings.TrimLeft(line, " ")
+	if indentOf(line) < 4 && strings.HasPrefix(trimmed, ">") {
+		return true
+	}
+	if m := reListItem.FindStringSubmatch(line); m != nil && m[3] != "" {
+		// Ordered lists only interrupt when starting at 1
+		if c := m[2][0]; c >= '0' && c <= '9' {
+			return strings.TrimRight(m[2], ".)") == "1"
+		}
+		return true
+	}
+	return false
+}
+
+func parseBlocks(lines []string) []*Node {
+	var nodes []*Node
+	i := 0
+	for i < len(lines) {
+		line := lines[i]
+
+		if isBlank(line) {
+			i++
+			continue
+		}
+
+		// Fenced code
+		if m := reFence.FindStringSubmatch(line); m != nil && !(m[2][0] == '`' && strings.Contains(m[3], "`")) {
+			indent, fence := len(m[1]), m[2]
+			lang := strings.Fields(m[3])
+			var body []string
+			i++
+			for i < len(lines) {
+				l := strings.TrimLeft(lines[i], " ")
+				if strings.HasPrefix(l, fence[:1]) && strings.TrimSpace(strings.TrimLeft(l, fence[:1])) == "" &&
+					len(l)-len(strings.TrimLeft(l, fence[:1])) >= len(fence) && indentOf(lines[i]) < 4 {
+					i++
+					break
+				}
+				body = append(body, stripIndent(lines[i], indent))
+				i++
+			}
+			n := &Node{Type: "code", Value: strings.Join(body, "\n")}
+			if len(lang) > 0 {
+				n.Lang = html.UnescapeString(lang[0])
+			}
+			nodes = append(nodes, n)
+			continue
+		}
+
+		// Indented code
+		if indentOf(line) >= 4 {
+			var body []string
+			for i < len(lines) && (indentOf(lines[i]) >= 4 || isBlank(lines[i])) {
+				body = append(body, stripIndent(lines[i], 4))
+				i++
+			}
+			for len(body) > 0 && isBlank(body[len(body)-1]) {
+				body = body[:len(body)-1]
+			}
+			nodes = append(nodes, &Node{Type: "code", Value: strings.Join(body, "\n")})
+			continue
+		}
+
+		// ATX heading
+		if m := reATXHeading.FindStringSubmatch(line); m != nil {
+			nodes = append(nodes, &Node{Type: "heading", Depth: len(m[1]), Children: parseInline(m[2])})
+			i++
+			continue
+		}
+
+		// Thematic break
+		if reThematicBreak.MatchString(line) {
+			nodes = append(nodes, &Node{Type: "thematicBreak"})
+			i++
+			continue
+		}
+
+		// Blockquote (and GitHub alerts)
+		if strings.HasPrefix(strings.TrimLeft(line, " "), ">") {
+			var inner []string
+			for i < len(lines) {
+				l := strings.TrimLeft(lines[i], " ")
+				if strings.HasPrefix(l, ">") {
+					l = strings.TrimPrefix(l, ">")
+					l = strings.TrimPrefix(l, " ")
+					inner = append(inner, l)
+					i++
+					continue
+				}
+				// Lazy paragraph continuation
+				if !isBlank(lines[i]) && len(inner) > 0 && !isBlank(inner[len(inner)-1]) && !interruptsParagraph(lines[i]) {
+					inner = append(inner, lines[i])
+					i++
+					continue
+				}
+				break
+			}
+			nodes = append(nodes, newBlockquote(parseBlocks(inner)))
+			continue
+		}
+
+		// HTML block
+		if reHTMLBlock.MatchString(line) {
+			var body []string
+			for i < len(lines) && !isBlank(lines[i]) {
+				body = append(body, lines[i])
+				i++
+			}
+			nodes = append(nodes, &Node{Type: "html", Value: strings.Join(body, "\n")})
+			continue
+		}
+
+		// List
+		if reListItem.MatchString(line) {
+			var list *Node
+			list, i = parseList(lines, i)
+			nodes = append(nodes, list)
+			continue
+		}
+
+		// Table
+		if strings.Contains(line, "|") && i+1 < len(lines) && reTableDelim.MatchString(lines[i+1]) {
+			header := splitTableRow(line)
+			delims := splitTableRow(lines[i+1])
+			if len(header) == len(delims) {
+				var table *Node
+				table, i = parseTable(lines, i, header, delims)
+				nodes = append(nodes, table)
+				continue
+			}
+		}
+
+		// Paragraph (or setext heading)
+		para := []string{line}
+		i++
+		depth := 0
+		for i < len(lines) && !isBlank(lines[i]) {
+			if m := reSetext.FindStringSubmatch(lines[i]); m != nil {
+				depth = 1
+				if m[1][0] == '-' {
+					depth = 2
+				}
+				i++
+				break
+			}
+			if interruptsParagraph(lines[i]) {
+				break
+			}
+			para = append(para, lines[i])
+			i++
+		}
+		text := strings.TrimSpace(strings.Join(trimLeftAll(para), "\n"))
+		if depth > 0 {
+			nodes = append(nodes, &Node{Type: "heading", Depth: depth, Children: parseInline(text)})
+		} else {
+			nodes = append(nodes, &Node{Type: "paragraph", Children: parseInline(text)})
+		}
+	}
+	return nodes
+}
+
+func trimLeftAll(lines []string) []string {
+	out := make([]string, len(lines))
+	for i, l := range lines {
+		out[i] = strings.TrimLeft(l, " ")
+	}
+	return out
+}
+
+// newBlockquote builds a blockquote node, lifting a leading [!TYPE] marker
+// into the Callout field
+func newBlockquote(children []*Node) *Node {
+	bq := &Node{Type: "blockquote", Children: children}
+	if len(children) == 0 || children[0].Type != "paragraph" || len(children[0].Children) == 0 {
+		return bq
+	}
+	first := children[0]
+	lead := first.Children[0]
+	if lead.Type != "text" {
+		return bq
+	}
+	m := reAlertMarker.FindStringSubmatch(lead.Value)
+	if m == nil {
+		return bq
+	}
+	bq.Callout = strings.ToUpper(m[1])
+	bq.Fold = m[2]
+	lead.Value = strings.TrimLeft(lead.Value[len(m[0]):], "\n")
+	if lead.Value == "" {
+		first.Children = first.Children[1:]
+	}
+	if len(first.Children) > 0 && first.Children[0].Type == "break" {
+		first.Children = first.Children[1:]
+	}
+	if len(first.Children) == 0 {
+		bq.Children = children[1:]
+	}
+	return bq
+}
+
+func parseList(lines []string, i int) (*Node, int) {
+	m := reListItem.FindStringSubmatch(lines[i])
+	marker := m[2]
+	ordered := marker[0] >= '0' && marker[0] <= '9'
+	list := &Node{Type: "list", Ordered: ordered}
+	if ordered {
+		list.Start, _ = strconv.Atoi(strings.TrimRight(marker, ".)"))
+	}
+	delim := marker[len(marker)-1:]
+
+	// continues reports whether a line starts another item of this list
+	continues := func(line string) bool {
+		m := reListItem.FindStringSubmatch(line)
+		if m == nil {
+			return false
+		}
+		mk := m[2]
+		return ordered == (mk[0] >= '0' && mk[0] <= '9') && mk[len(mk)-1:] == delim
+	}
+
+	sawBlankBetween := false
+	for i < len(lines) && continues(lines[i]) {
+		m := reListItem.FindStringSubmatch(lines[i])
+		mk := m[2]
+		contentIndent := len(m[1]) + len(mk) + len(m[3])
+		if m[3] == "" {
+			contentIndent = len(m[1]) + len(mk) + 1
+		} else if len(m[3]) > 4 {
+			// Indented code inside the item: content starts one space after marker
+			contentIndent = len(m[1]) + len(mk) + 1
+		}
+		first := lines[i][min(contentIndent, len(lines[i])):]
+		item := []string{first}
+		i++
+
+		blankInside := false
+		for i < len(lines) {
+			l := lines[i]
+			if isBlank(l) {
+				// Blank lines continue the item only if indented content follows
+				j := i
+				for j < len(lines) && isBlank(lines[j]) {
+					j++
+				}
+				if j < len(lines) && indentOf(lines[j]) >= contentIndent {
+					for ; i < j; i++ {
+						item = append(item, "")
+					}
+					blankInside = true
+					continue
+				}
+				break
+			}
+			if indentOf(l) >= contentIndent {
+				item = append(item, stripIndent(l, contentIndent))
+				i++
+				continue
+			}
+			// Lazy continuation of a paragraph
+			if !isBlank(item[len(item)-1]) && !interruptsParagraph(l) && !reListItem.MatchString(l) {
+				item = append(item, strings.TrimLeft(l, " "))
+				i++
+				continue
+			}
+			break
+		}
+
+		li := &Node{Type: "listItem"}
+		if tm := reTaskMarker.FindStringSubmatch(item[0]); tm != nil {
+			checked := tm[1] != " "
+			li.Checked = &checked
+			item[0] = item[0][len(tm[0]):]
+		}
+		li.Children = parseBlocks(item)
+		if blankInside && len(li.Children) > 1 {
+			li.Spread = true
+		}
+		list.Children = append(list.Children, li)
+
+		// Blank line between items makes the list loose
+		j := i
+		for j < len(lines) && isBlank(lines[j]) {
+			j++
+		}
+		if j > i && j < len(lines) && continues(lines[j]) {
+			sawBlankBetween = true
+			i = j
+		}
+	}
+	list.Spread = sawBlankBetween
+	for _, li := range list.Children {
+		if li.Spread {
+			list.Spread = true
+		}
+	}
+	return list, i
+}
+
+// splitTableRow splits a pipe table row into trimmed cell sources
+func splitTableRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, `\|`) {
+		line = line[:len(line)-1]
+	}
+	var cells []string
+	var sb strings.Builder
+	inCode := false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '\\' && i+1 < len(line) && line[i+1] == '|':
+			sb.WriteByte('|')
+			i++
+		case c == '`':
+			inCode = !inCode
+			sb.WriteByte(c)
+		case c == '|' && !inCode:
+			cells = append(cells, strings.TrimSpace(sb.String()))
+			sb.Reset()
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	cells = append(cells, strings.TrimSpace(sb.String()))
+	return cells
+}
+
+func parseTable(lines []string, i int, header, delims []string) (*Node, int) {
+	table := &Node{Type: "table"}
+	for _, d := range delims {
+		switch {
+		case strings.HasPrefix(d, ":") && strings.HasSuffix(d, ":"):
+			table.Align = append(table.Align, "center")
+		case strings.HasSuffix(d, ":"):
+			table.Align = append(table.Align, "right")
+		case strings.HasPrefix(d, ":"):
+			table.Align = append(table.Align, "left")
+		default:
+			table.Align = append(table.Align, "")
+		}
+	}
+	addRow := func(cells []string) {
+		row := &Node{Type: "tableRow"}
+		for c := 0; c < len(header); c++ {
+			cell := &Node{Type: "tableCell"}
+			if c < len(cells) {
+				cell.Children = parseInline(cells[c])
+			}
+			row.Children = append(row.Children, cell)
+		}
+		table.Children = append(table.Children, row)
+	}
+	addRow(header)
+	i += 2
+	for i < len(lines) && !isBlank(lines[i]) && !interruptsParagraph(lines[i]) {
+		addRow(splitTableRow(lines[i]))
+		i++
+	}
+	return table, i
+}
+
+// ============================================================
+// Inline Parser
+// ============================================================
+
+func parseInline(s string) []*Node {
+	p := &inlineParser{src: s}
+	return mergeText(p.parse(0, len(s)))
+}
+
+type inlineParser struct {
+	src string
+}
+
+func (p *inlineParser) parse(start, end int) []*Node {
+	var nodes []*Node
+	var text strings.Builder
+	flush := func() {
+		if text.Len() > 0 {
+			nodes = append(nodes, &Node{Type: "text", Value: text.String()})
+			text.Reset()
+		}
+	}
+	s := p.src
+	i := start
+	for i < end {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < end:
+			if s[i+1] == '\n' {
+				flush()
+				nodes = append(nodes, &Node{Type: "break"})
+				i += 2
+				continue
+			}
+			if isASCIIPunct(s[i+1]) {
+				text.WriteByte(s[i+1])
+				i += 2
+				continue
+			}
+
+		case c == '\n':
+			// Two trailing spaces make a hard break
+			t := text.String()
+			if strings.HasSuffix(t, "  ") {
+				text.Reset()
+				text.WriteString(strings.TrimRight(t, " "))
+				flush()
+				nodes = append(nodes, &Node{Type: "break"})
+				i++
+				continue
+			}
+			text.Reset()
+			text.WriteString(strings.TrimRight(t, " "))
+
+		case c == '`':
+			run := countRun(s, i, end, '`')
+			if close := findCodeClose(s, i+run, end, run); close >= 0 {
+				flush()
+				code := strings.ReplaceAll(s[i+run:close], "\n", " ")
+				if len(code) > 2 && code[0] == ' ' && code[len(code)-1] == ' ' && strings.Trim(code, " ") != "" {
+					code = code[1 : len(code)-1]
+				}
+				nodes = append(nodes, &Node{Type: "inlineCode", Value: code})
+				i = close + run
+				continue
+			}
+			text.WriteString(s[i : i+run])
+			i += run
+			continue
+
+		case c == '!' && i+1 < end && s[i+1] == '[':
+			if n, next := p.parseLink(i+1, end, true); n != nil {
+				flush()
+				nodes = append(nodes, n)
+				i = next
+				continue
+			}
+
+		case c == '[':
+			if n, next := p.parseLink(i, end, false); n != nil {
+				flush()
+				nodes = append(nodes, n)
+				i = next
+				continue
+			}
+
+		case c == '<':
+			rest := s[i:end]
+			if m := reAutolinkURI.FindStringSubmatch(rest); m != nil {
+				flush()
+				nodes = append(nodes, &Node{Type: "link", URL: m[1], Children: []*Node{{Type: "text", Value: m[1]}}})
+				i += len(m[0])
+				continue
+			}
+			if m := reAutolinkEmail.FindStringSubmatch(rest); m != nil {
+				flush()
+				nodes = append(nodes, &Node{Type: "link", URL: "mailto:" + m[1], Children: []*Node{{Type: "text", Value: m[1]}}})
+				i += len(m[0])
+				continue
+			}
+			if m := reInlineHTML.FindString(rest); m != "" {
+				flush()
+				nodes = append(nodes, &Node{Type: "html", Value: m})
+				i += len(m)
+				continue
+			}
+
+		case c == '&':
+			if m := reEntity.FindString(s[i:end]); m != "" {
+				text.WriteString(html.UnescapeString(m))
+				i += len(m)
+				continue
+			}
+
+		case c == '*' || c == '_' || c == '~':
+			if n, next := p.parseEmphasis(i, end); n != nil {
+				flush()
+				nodes = append(nodes, n)
+				i = next
+				continue
+			}
+			run := countRun(s, i, end, c)
+			text.WriteString(s[i : i+run])
+			i += run
+			continue
+
+		case c == 'h' || c == 'w':
+			if i == start || !isWordByte(s[i-1]) {
+				if m := reBareURL.FindString(s[i:end]); m != "" {
+					m = trimUnbalancedParen(m)
+					url := m
+					if strings.HasPrefix(m, "www.") {
+						url = "http://" + m
+					}
+					flush()
+					nodes = append(nodes, &Node{Type: "link", URL: url, Children: []*Node{{Type: "text", Value: m}}})
+					i += len(m)
+					continue
+				}
+			}
+		}
+		text.WriteByte(c)
+		i++
+	}
+	flush()
+	return nodes
+}
+
+// parseLink parses [text](url "title") starting at the opening bracket
+func (p *inlineParser) parseLink(open, end int, image bool) (*Node, int) {
+	s := p.src
+	closeBracket := matchBracket(s, open, end, '[', ']')
+	if closeBracket < 0 || closeBracket+1 >= end || s[closeBracket+1] != '(' {
+		return nil, 0
+	}
+	closeParen := matchBracket(s, closeBracket+1, end, '(', ')')
+	if closeParen < 0 {
+		return nil, 0
+	}
+	dest := strings.TrimSpace(s[closeBracket+2 : closeParen])
+	url, title := dest, ""
+	if strings.HasPrefix(dest, "<") {
+		if j := strings.Index(dest, ">"); j > 0 {
+			url, title = dest[1:j], strings.TrimSpace(dest[j+1:])
+		}
+	} else if j := strings.IndexAny(dest, " \n"); j > 0 {
+		url, title = dest[:j], strings.TrimSpace(dest[j+1:])
+	}
+	if len(title) >= 2 && (title[0] == '"' || title[0] == '\'' || title[0] == '(') {
+		title = title[1 : len(title)-1]
+	} else if title != "" {
+		return nil, 0
+	}
+	n := &Node{URL: unescapeMarkdown(url), Title: unescapeMarkdown(title)}
+	if image {
+		n.Type = "image"
+		n.Alt = nodeText(&Node{Children: p.parse(open+1, closeBracket)})
+		return n, closeParen + 1
+	}
+	n.Type = "link"
+	n.Children = mergeText(p.parse(open+1, closeBracket))
+	return n, closeParen + 1
+}
+
+// parseEmphasis parses **strong**, *emphasis* and ~~delete~~ spans
+func (p *inlineParser) parseEmphasis(i, end int) (*Node, int) {
+	s := p.src
+	c := s[i]
+	run := countRun(s, i, end, c)
+	var delim, typ string
+	switch {
+	case c == '~' && run == 2:
+		delim, typ = "~~", "delete"
+	case c == '~':
+		return nil, 0
+	case run == 3:
+		// ***text*** is emphasis around strong
+		delim, typ = s[i:i+3], "emphasis"
+	case run >= 2:
+		delim, typ = s[i:i+2], "strong"
+	default:
+		delim, typ = s[i:i+1], "emphasis"
+	}
+	open := i + len(delim)
+	if open >= end || s[open] == ' ' || s[open] == '\n' {
+		return nil, 0
+	}
+	// Underscores do not open emphasis inside words
+	if c == '_' && i > 0 && isWordByte(s[i-1]) {
+		return nil, 0
+	}
+	for j := open + 1; j+len(delim) <= end; j++ {
+		switch s[j] {
+		case '`':
+			r := countRun(s, j, end, '`')
+			if cl := findCodeClose(s, j+r, end, r); cl >= 0 {
+				j = cl + r - 1
+			}
+			continue
+		case '\\':
+			j++
+			continue
+		case '[':
+			if cl := matchBracket(s, j, end, '[', ']'); cl > 0 && cl+1 < end && s[cl+1] == '(' {
+				if cp := matchBracket(s, cl+1, end, '(', ')'); cp > 0 {
+					j = cp
+				}
+			}
+			continue
+		}
+		if !strings.HasPrefix(s[j:], delim) || s[j-1] == ' ' || s[j-1] == '\n' {
+			continue
+		}
+		r := countRun(s, j, end, c)
+		if len(delim) == 3 {
+			if r != 3 {
+				j += r - 1
+				continue
+			}
+			inner := &Node{Type: "strong", Children: mergeText(p.parse(open, j))}
+			return &Node{Type: "emphasis", Children: []*Node{inner}}, j + 3
+		}
+		if typ == "emphasis" && r == 2 {
+			// Skip over a nested strong run
+			j++
+			continue
+		}
+		if c == '_' && j+len(delim) < end && isWordByte(s[j+len(delim)]) {
+			continue
+		}
+		if typ == "strong" && r == 3 && run != 3 {
+			// ***a** b*: the closing strong is the trailing pair
+			j++
+		}
+		n := &Node{Type: typ, Children: mergeText(p.parse(open, j))}
+		return n, j + len(delim)
+	}
+	return nil, 0
+}
+
+func countRun(s string, i, end int, c byte) int {
+	n := 0
+	for i+n < end && s[i+n] == c {
+		n++
+	}
+	return n
+}
+
+func findCodeClose(s string, from, end, run int) int {
+	for j := from; j < end; {
+		if s[j] != '`' {
+			j++
+			continue
+		}
+		r := countRun(s, j, end, '`')
+		if r == run {
+			return j
+		}
+		j += r
+	}
+	return -1
+}
+
+// matchBracket finds the bracket closing the one at open, honoring escapes
+// and code spans
+func matchBracket(s string, open, end int, lb, rb byte) int {
+	depth := 0
+	for j := open; j < end; j++ {
+		switch s[j] {
+		case '\\':
+			j++
+		case '`':
+			r := countRun(s, j, end, '`')
+			if cl := findCodeClose(s, j+r, end, r); cl >= 0 {
+				j = cl + r - 1
+			} else {
+				j += r - 1
+			}
+		case lb:
+			depth++
+		case rb:
+			depth--
+			if depth == 0 {
+				return j
+			}
+		}
+	}
+	return -1
+}
+
+func trimUnbalancedParen(url string) string {
+	for strings.HasSuffix(url, ")") && strings.Count(url, "(") < strings.Count(url, ")") {
+		url = url[:len(url)-1]
+	}
+	return url
+}
+
+// unescapeMarkdown removes backslash escapes and decodes entities
+func unescapeMarkdown(s string) string {
+	if !strings.ContainsAny(s, `\&`) {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && isASCIIPunct(s[i+1]) {
+			sb.WriteByte(s[i+1])
+			i++
+			continue
+		}
+		if s[i] == '&' {
+			if m := reEntity.FindString(s[i:]); m != "" {
+				sb.WriteString(html.UnescapeString(m))
+				i += len(m) - 1
+				continue
+			}
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
+
+func isASCIIPunct(c byte) bool {
+	return strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", c) >= 0
+}
+
+func isWordByte(c byte) bool {
+	if c >= utf8.RuneSelf {
+		return true
+	}
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// mergeText joins adjacent text nodes
+func mergeText(nodes []*Node) []*Node {
+	var out []*Node
+	for _, n := range nodes {
+		if n.Type == "text" && len(out) > 0 && out[len(out)-1].Type == "text" {
+			out[len(out)-1].Value += n.Value
+			continue
+		}
+		out = append(out, n)
+	}
+	return out
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+)
+
+// TestMarkdownRoundTrip parses markdown, writes it back and checks the
+// output, then that parsing the output gives the same tree
+func TestMarkdownRoundTrip(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{
+			name: "inline formatting",
+			in:   "# Title\n\nSome *em*, **strong**, ~~gone~~ and `code`.\n",
+			want: "# Title\n\nSome *em*, **strong**, ~~gone~~ and `code`.\n",
+		},
+		{
+			name: "callout",
+			in:   "> [!NOTE]\n> Remember this\n",
+			want: "> [!NOTE]\n>\n> Remember this\n",
+		},
+		{
+			name: "escaped callout",
+			in:   "> \\[!NOTE]\n> Remember this\n",
+			want: "> [!NOTE]\n>\n> Remember this\n",
+		},
+		{
+			name: "folded callout",
+			in:   "> [!TIP]-\n> Folded\n",
+			want: "> [!TIP]-\n>\n> Folded\n",
+		},
+		{
+			name: "blockquote with list",
+			in:   "> quoted\n>\n> - list in quote\n",
+			want: "> quoted\n>\n> - list in quote\n",
+		},
+		{
+			name: "nested list",
+			in:   "- a\n  - b\n    - c\n- d\n",
+			want: "- a\n  - b\n    - c\n- d\n",
+		},
+		{
+			name: "ordered list with nested bullets",
+			in:   "3. three\n4. four\n   - nested\n",
+			want: "3. three\n4. four\n   - nested\n",
+		},
+		{
+			name: "loose list",
+			in:   "- item\n\n  second paragraph\n- next\n",
+			want: "- item\n\n  second paragraph\n\n- next\n",
+		},
+		{
+			name: "task list",
+			in:   "- [ ] todo\n- [x] done\n  - [ ] sub\n",
+			want: "- [ ] todo\n- [x] done\n  - [ ] sub\n",
+		},
+		{
+			name: "table with escaped pipes",
+			in:   "| a | b |\n| :- | -: |\n| x \\| y | `c\\|d` |\n",
+			want: "| a      | b      |\n| :----- | -----: |\n| x \\| y | `c\\|d` |\n",
+		},
+		{
+			name: "link destination escapes",
+			in:   "[link](https://example.com/a\\_b \"t\") and ![img](images/a\\(1\\).png)\n",
+			want: "[link](https://example.com/a_b \"t\") and ![img](images/a(1).png)\n",
+		},
+		{
+			name: "link text brackets and parens in URL",
+			in:   "[a [nested] b](https://x.test/p_(q)) tail\n",
+			want: "[a \\[nested\\] b](https://x.test/p_(q)) tail\n",
+		},
+		{
+			name: "backslash escapes in text",
+			in:   "a \\*not em\\* and \\\\ and \\[brackets\\]\n",
+			want: "a \\*not em\\* and \\\\ and \\[brackets\\]\n",
+		},
+		{
+			name: "raw html",
+			in:   "<div align=\"center\">\n<b>hi</b>\n</div>\n\ntext <kbd>Ctrl</kbd> more\n",
+			want: "<div align=\"center\">\n<b>hi</b>\n</div>\n\ntext <kbd>Ctrl</kbd> more\n",
+		},
+		{
+			name: "fenced code",
+			in:   "```go\nfunc main() {}\n```\n",
+			want: "```go\nfunc main() {}\n```\n",
+		},
+		{
+			name: "hard break",
+			in:   "line one  \nline two\n",
+			want: "line one\\\nline two\n",
+		},
+		{
+			name: "autolink and entities",
+			in:   "See <https://example.com> and &copy; &amp;\n",
+			want: "See <https://example.com> and © &\n",
+		},
+		{
+			name: "thematic break",
+			in:   "---\n\nafter rule\n",
+			want: "---\n\nafter rule\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := parseMarkdown(tt.in)
+			got := renderMarkdown(tree, markdownOptions{})
+			if got != tt.want {
+				t.Errorf("render(parse(%q))\n got %q\nwant %q", tt.in, got, tt.want)
+			}
+			before, _ := json.Marshal(tree)
+			after, _ := json.Marshal(parseMarkdown(got))
+			if string(before) != string(after) {
+				t.Errorf("tree changed on reparse\nbefore %s\n after %s", before, after)
+			}
+		})
+	}
+}
+
+// TestParseMarkdownNodes checks fields of the first node of a type
+func TestParseMarkdownNodes(t *testing.T) {
+	tests := []struct {
+		name, in, node, field, want string
+	}{
+		{"callout type", "> \\[!WARNING]\n> Careful\n", "blockquote", "callout", "WARNING"},
+		{"callout marker removed", "> [!NOTE]\n> Remember this\n", "paragraph", "text", "Remember this"},
+		{"plain blockquote", "> [not a callout]\n", "blockquote", "callout", ""},
+		{"escaped pipe in cell", "| x \\| y |\n| - |\n", "tableCell", "text", "x | y"},
+		{"escaped pipe in link in cell", "| h |\n| - |\n| [l](https://x.test/a\\|b) |\n", "link", "url", "https://x.test/a|b"},
+		{"escaped underscore in URL", "[x](https://example.com/a\\_b)", "link", "url", "https://example.com/a_b"},
+		{"escaped parens in image", "![alt](images/a\\(1\\).png)", "image", "url", "images/a(1).png"},
+		{"link title", "[x](https://example.com \"Title\")", "link", "title", "Title"},
+		{"inline html", "press <kbd>Ctrl</kbd>", "html", "value", "<kbd>"},
+		{"block html", "<details>\n<summary>More</summary>\n</details>\n", "html", "value", "<details>\n<summary>More</summary>\n</details>"},
+		{"code language", "```js\nx()\n```\n", "code", "lang", "js"},
+		{"task checked", "- [x] done\n", "listItem", "checked", "true"},
+		{"list start", "7. seven\n", "list", "start", "7"},
+		{"entity", "&lt;tag&gt;", "paragraph", "text", "<tag>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var found *Node
+			walkNodes(parseMarkdown(tt.in), func(n *Node) bool {
+				if found == nil && n.Type == tt.node {
+					found = n
+				}
+				return found == nil
+			})
+			if found == nil {
+				t.Fatalf("no %s node in %q", tt.node, tt.in)
+			}
+			var got string
+			switch tt.field {
+			case "callout":
+				got = found.Callout
+			case "text":
+				got = nodeText(found)
+			case "url":
+				got = found.URL
+			case "title":
+				got = found.Title
+			case "value":
+				got = found.Value
+			case "lang":
+				got = found.Lang
+			case "checked":
+				if found.Checked != nil {
+					got = strconv.FormatBool(*found.Checked)
+				}
+			case "start":
+				got = strconv.Itoa(found.Start)
+			}
+			if got != tt.want {
+				t.Errorf("%s %s = %q, want %q", tt.node, tt.field, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// ============================================================
+// Markdown Writer
+// ============================================================
+//
+// Serializes a document tree back to GitHub-flavored markdown using the
+// same remark-stringify settings as loopd.js: "-" bullets, "*" emphasis,
+// "**" strong, backtick fences, one-space list indent and "---" rules.
+
+// markdownOptions customizes markdown output for a target
+type markdownOptions struct {
+	// Image overrides how an image is written; return ok=false for the default
+	Image func(n *Node) (md string, ok bool)
+	// Link overrides how a link is written; return ok=false for the default
+	Link func(n *Node) (md string, ok bool)
+	// Callout formats a callout blockquote from its rendered body
+	Callout func(n *Node, body string) string
+}
+
+// renderMarkdown serializes a document tree to markdown
+func renderMarkdown(root *Node, opts markdownOptions) string {
+	w := &mdWriter{opts: opts}
+	out := w.blocks(root.Children, false)
+	if out == "" {
+		return ""
+	}
+	return out + "\n"
+}
+
+type mdWriter struct {
+	opts markdownOptions
+}
+
+func (w *mdWriter) blocks(nodes []*Node, tight bool) string {
+	sep := "\n\n"
+	if tight {
+		sep = "\n"
+	}
+	var parts []string
+	for i, n := range nodes {
+		s := w.block(n)
+		if s == "" {
+			continue
+		}
+		// Adjacent lists of the same kind would merge; separate them
+		if i > 0 && n.Type == "list" && nodes[i-1].Type == "list" && n.Ordered == nodes[i-1].Ordered {
+			parts = append(parts, "<!---->")
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, sep)
+}
+
+func (w *mdWriter) block(n *Node) string {
+	switch n.Type {
+	case "heading":
+		return strings.Repeat("#", n.Depth) + " " + strings.ReplaceAll(w.inlines(n.Children), "\n", " ")
+
+	case "paragraph":
+		return w.inlines(n.Children)
+
+	case "blockquote":
+		body := w.blocks(n.Children, false)
+		if n.Callout != "" {
+			if w.opts.Callout != nil {
+				return w.opts.Callout(n, body)
+			}
+			marker := "[!" + n.Callout + "]" + n.Fold
+			if body == "" {
+				body = marker
+			} else {
+				body = marker + "\n\n" + body
+			}
+		}
+		return prefixLines(body, "> ", ">")
+
+	case "list":
+		var items []string
+		num := n.Start
+		if num == 0 {
+			num = 1
+		}
+		for _, li := range n.Children {
+			marker := "-"
+			if n.Ordered {
+				marker = fmt.Sprintf("%d.", num)
+				num++
+			}
+			items = append(items, w.listItem(li, marker, !n.Spread))
+		}
+		if n.Spread {
+			return strings.Join(items, "\n\n")
+		}
+		return strings.Join(items, "\n")
+
+	case "code":
+		fence := "```"
+		for strings.Contains(n.Value, fence) {
+			fence += "`"
+		}
+		return fence + n.Lang + "\n" + n.Value + "\n" + fence
+
+	case "table":
+		return w.table(n)
+
+	case "thematicBreak":
+		return "---"
+
+	case "html":
+		return n.Value
+
+	default:
+		return w.inline(n)
+	}
+}
+
+func (w *mdWriter) listItem(li *Node, marker string, tight bool) string {
+	body := w.blocks(li.Children, tight)
+	if li.Checked != nil {
+		box := "[ ] "
+		if *li.Checked {
+			box = "[x] "
+		}
+		body = box + body
+	}
+	indent := strings.Repeat(" ", len(marker)+1)
+	if body == "" {
+		return marker
+	}
+	return marker + " " + prefixLines(body, indent, "")[len(indent):]
+}
+
+// prefixLines prefixes every line, using blankPrefix for empty lines
+func prefixLines(s, prefix, blankPrefix string) string {
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		if l == "" {
+			lines[i] = blankPrefix
+		} else {
+			lines[i] = prefix + l
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (w *mdWriter) table(n *Node) string {
+	var rows [][]string
+	cols := len(n.Align)
+	for _, row := range n.Children {
+		var cells []string
+		for _, cell := range row.Children {
+			text := strings.ReplaceAll(w.inlines(cell.Children), "\n", " ")
+			cells = append(cells, strings.ReplaceAll(text, "|", `\|`))
+		}
+		if len(cells) > cols {
+			cols = len(cells)
+		}
+		rows = append(rows, cells)
+	}
+	widths := make([]int, cols)
+	for c := range widths {
+		widths[c] = 1
+	}
+	for _, row := range rows {
+		for c, cell := range row {
+			if l := utf8.RuneCountInString(cell); l > widths[c] {
+				widths[c] = l
+			}
+		}
+	}
+
+	var lines []string
+	writeRow := func(cells []string) {
+		var sb strings.Builder
+		sb.WriteString("|")
+		for c := 0; c < cols; c++ {
+			cell := ""
+			if c < len(cells) {
+				cell = cells[c]
+			}
+			sb.WriteString(" " + cell + strings.Repeat(" ", widths[c]-utf8.RuneCountInString(cell)) + " |")
+		}
+		lines = append(lines, sb.String())
+	}
+	if len(rows) > 0 {
+		writeRow(rows[0])
+	}
+	var delim strings.Builder
+	delim.WriteString("|")
+	for c := 0; c < cols; c++ {
+		align := ""
+		if c < len(n.Align) {
+			align = n.Align[c]
+		}
+		dashes := strings.Repeat("-", widths[c])
+		switch align {
+		case "left":
+			dashes = ":" + dashes[1:]
+		case "right":
+			dashes = dashes[1:] + ":"
+		case "center":
+			if widths[c] < 3 {
+				dashes = "-"
+			} else {
+				dashes = dashes[2:]
+			}
+			dashes = ":" + dashes + ":"
+		}
+		delim.WriteString(" " + dashes + " |")
+	}
+	lines = append(lines, delim.String())
+	for _, row := range rows[min(1, len(rows)):] {
+		writeRow(row)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (w *mdWriter) inlines(nodes []*Node) string {
+	var sb strings.Builder
+	for i, n := range nodes {
+		s := w.inline(n)
+		if n.Type == "text" {
+			s = escapeMarkdownText(s, i == 0)
+		}
+		sb.WriteString(s)
+	}
+	return strings.TrimRight(sb.String(), " \t")
+}
+
+func (w *mdWriter) inline(n *Node) string {
+	switch n.Type {
+	case "text":
+		return n.Value
+	case "inlineCode":
+		fence := "`"
+		for strings.Contains(n.Value, fence) {
+			fence += "`"
+		}
+		if strings.HasPrefix(n.Value, "`") || strings.HasSuffix(n.Value, "`") {
+			return fence + " " + n.Value + " " + fence
+		}
+		return fence + n.Value + fence
+	case "strong":
+		return "**" + w.inlines(n.Children) + "**"
+	case "emphasis":
+		return "*" + w.inlines(n.Children) + "*"
+	case "delete":
+		return "~~" + w.inlines(n.Children) + "~~"
+	case "break":
+		return "\\\n"
+	case "html":
+		return n.Value
+	case "link":
+		if w.opts.Link != nil {
+			if s, ok := w.opts.Link(n); ok {
+				return s
+			}
+		}
+		text := nodeText(n)
+		if n.Title == "" && len(n.Children) == 1 && n.Children[0].Type == "text" {
+			if text == n.URL && strings.Contains(n.URL, "://") {
+				return "<" + n.URL + ">"
+			}
+			if "mailto:"+text == n.URL {
+				return "<" + text + ">"
+			}
+		}
+		return "[" + w.inlines(n.Children) + "](" + markdownDestination(n.URL, n.Title) + ")"
+	case "image":
+		if w.opts.Image != nil {
+			if s, ok := w.opts.Image(n); ok {
+				return s
+			}
+		}
+		return "![" + escapeMarkdownText(n.Alt, false) + "](" + markdownDestination(n.URL, n.Title) + ")"
+	default:
+		return w.inlines(n.Children)
+	}
+}
+
+// markdownDestination formats a link destination with optional title
+func markdownDestination(url, title string) string {
+	if strings.ContainsAny(url, " <>") || strings.Count(url, "(") != strings.Count(url, ")") {
+		url = "<" + strings.NewReplacer("<", `\<`, ">", `\>`).Replace(url) + ">"
+	}
+	if title != "" {
+		url += ` "` + strings.ReplaceAll(title, `"`, `\"`) + `"`
+	}
+	return url
+}
+
+var (
+	reLineStartSpecial = regexp.MustCompile(`^(#{1,6}(?:\s|$)|>|[-+*](?:\s|$)|(\d{1,9})([.)])(?:\s|$)|=+\s*$)`)
+	reEntityLike       = regexp.MustCompile(`&(#[0-9]+|#[xX][0-9a-fA-F]+|[a-zA-Z][a-zA-Z0-9]*);`)
+)
+
+// escapeMarkdownText backslash-escapes characters that would otherwise be
+// read as markdown syntax
+func escapeMarkdownText(s string, blockStart bool) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case '\\', '*', '`', '[', ']', '~':
+			sb.WriteByte('\\')
+		case '_':
+			// Intraword underscores never start emphasis
+			if !(i > 0 && isWordByte(s[i-1]) && i+1 < len(s) && isWordByte(s[i+1])) {
+				sb.WriteByte('\\')
+			}
+		case '<':
+			if i+1 < len(s) && (isWordByte(s[i+1]) || s[i+1] == '/' || s[i+1] == '!') {
+				sb.WriteByte('\\')
+			}
+		case '&':
+			if reEntityLike.MatchString(s[i:]) && reEntityLike.FindStringIndex(s[i:])[0] == 0 {
+				sb.WriteByte('\\')
+			}
+		}
+		sb.WriteByte(c)
+	}
+	out := sb.String()
+
+	// Escape block syntax at the start of each line
+	lines := strings.Split(out, "\n")
+	for i, l := range lines {
+		if i == 0 && !blockStart {
+			continue
+		}
+		if m := reLineStartSpecial.FindStringSubmatch(l); m != nil {
+			if m[2] != "" {
+				lines[i] = m[2] + `\` + l[len(m[2]):]
+			} else {
+				lines[i] = `\` + l
+			}
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ============================================================
+// Metrics and Health
+// ============================================================
+//
+// /metrics serves counters for loads, HTTP requests and watcher events in
+// the Prometheus text exposition format, written by hand to avoid a
+// client library dependency. /healthz answers while the process serves
+// requests; /readyz only while the directory watcher is running and the
+// server is not shutting down. The health checks need no token so
+// supervisors can probe them; /metrics does, as a bearer token in the
+// scrape config.
+
+// counterVec is a counter with labels
+type counterVec struct {
+	name, help string
+	labels     []string
+
+	mu     sync.Mutex
+	values map[string]float64 // label values joined by \xff
+}
+
+func newCounterVec(name, help string, labels ...string) *counterVec {
+	return &counterVec{name: name, help: help, labels: labels, values: make(map[string]float64)}
+}
+
+// add increases the counter for the given label values
+func (c *counterVec) add(n float64, values ...string) {
+	key := strings.Join(values, "\xff")
+	c.mu.Lock()
+	c.values[key] += n
+	c.mu.Unlock()
+}
+
+func (c *counterVec) inc(values ...string) {
+	c.add(1, values...)
+}
+
+func (c *counterVec) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	keys := make([]string, 0, len(c.values))
+	for k := range c.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, formatLabels(c.labels, strings.Split(k, "\xff")), formatValue(c.values[k]))
+	}
+}
+
+// histogram tracks a distribution in cumulative buckets
+type histogram struct {
+	name, help string
+	buckets    []float64 // upper bounds, ascending
+
+	mu     sync.Mutex
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(name, help string, buckets ...float64) *histogram {
+	return &histogram{name: name, help: help, buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+func (h *histogram) observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		h.counts[i]++
+	}
+	h.sum += v
+	h.count++
+}
+
+func (h *histogram) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var cumulative uint64
+	for i, le := range h.buckets {
+		cumulative += h.counts[i]
+		fmt.Fprintf(w, "%s_bucket{le=%q} %d\n", h.name, formatValue(le), cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", h.name, h.count)
+	fmt.Fprintf(w, "%s_sum %s\n%s_count %d\n", h.name, formatValue(h.sum), h.name, h.count)
+}
+
+// gaugeFunc reports a value read at scrape time
+type gaugeFunc struct {
+	name, help string
+	value      func() float64
+}
+
+func (g gaugeFunc) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n", g.name, g.help, g.name, g.name, formatValue(g.value()))
+}
+
+// formatLabels renders {a="x",b="y"}, escaping values
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	parts := make([]string, len(names))
+	for i, name := range names {
+		v := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(values[i])
+		parts[i] = name + `="` + v + `"`
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func formatValue(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// metrics are the server's instruments
+var metrics = struct {
+	loads         *counterVec
+	loadDuration  *histogram
+	loadedBytes   *counterVec
+	loadedImages  *counterVec
+	requests      *counterVec
+	rejected      *counterVec
+	watcherEvents *counterVec
+	subscribers   atomic.Int64
+	watchers      atomic.Int64 // running directory watchers; /cd briefly overlaps two
+	started       time.Time
+}{
+	loads:         newCounterVec("loopd_loads_total", "Export loads by result.", "result"),
+	loadDuration:  newHistogram("loopd_load_duration_seconds", "Time to read and prepare an export.", .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10),
+	loadedBytes:   newCounterVec("loopd_loaded_bytes_total", "Markdown bytes in successfully loaded exports."),
+	loadedImages:  newCounterVec("loopd_loaded_images_total", "Images in successfully loaded exports."),
+	requests:      newCounterVec("loopd_http_requests_total", "HTTP requests by route pattern and status code.", "route", "code"),
+	rejected:      newCounterVec("loopd_http_rejected_total", "Requests refused by the request limits, by reason.", "reason"),
+	watcherEvents: newCounterVec("loopd_watcher_events_total", "File system events seen in the watch directory.", "op"),
+	started:       time.Now(),
+}
+
+// recordLoad counts a load attempt
+func recordLoad(start time.Time, content *Content, err error) {
+	if err != nil {
+		metrics.loads.inc("failed")
+		return
+	}
+	metrics.loads.inc("ok")
+	metrics.loadDuration.observe(time.Since(start).Seconds())
+	metrics.loadedBytes.add(float64(len(content.Markdown)))
+	metrics.loadedImages.add(float64(len(content.Images)))
+}
+
+// handleMetrics writes every metric in the text exposition format
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	contentMu.RLock()
+	loaded := loadedExport(currentContent)
+	contentMu.RUnlock()
+	current := func(f func(*LoadedExport) int) func() float64 {
+		return func() float64 {
+			if loaded == nil {
+				return 0
+			}
+			return float64(f(loaded))
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	fmt.Fprintf(w, "# HELP loopd_build_info Always 1; the version label is the running build.\n# TYPE loopd_build_info gauge\nloopd_build_info%s 1\n",
+		formatLabels([]string{"version"}, []string{version}))
+	gaugeFunc{"loopd_start_time_seconds", "Unix time the server started.", func() float64 { return float64(metrics.started.Unix()) }}.write(w)
+	metrics.loads.write(w)
+	metrics.loadDuration.write(w)
+	metrics.loadedBytes.write(w)
+	metrics.loadedImages.write(w)
+	gaugeFunc{"loopd_content_bytes", "Markdown bytes of the export being served.", current(func(l *LoadedExport) int { return l.Bytes })}.write(w)
+	gaugeFunc{"loopd_content_images", "Images in the export being served.", current(func(l *LoadedExport) int { return l.Images })}.write(w)
+	metrics.requests.write(w)
+	metrics.rejected.write(w)
+	metrics.watcherEvents.write(w)
+	gaugeFunc{"loopd_watcher_running", "1 while the directory watcher is running.", func() float64 { return boolValue(metrics.watchers.Load() > 0) }}.write(w)
+	gaugeFunc{"loopd_event_subscribers", "Clients following the daemon's live event stream.", func() float64 { return float64(metrics.subscribers.Load()) }}.write(w)
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// handleHealthz reports that the process is serving requests
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, "ok")
+}
+
+// handleReadyz reports whether loopd is watching for exports and not
+// shutting down
+func handleReadyz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	switch {
+	case app.stopping():
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+	case metrics.watchers.Load() == 0:
+		http.Error(w, "watcher not running", http.StatusServiceUnavailable)
+	default:
+		fmt.Fprintln(w, "ready")
+	}
+}
+
+// instrument counts requests by the mux pattern that served them
+func instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusWriter{ResponseWriter: w, code: http.StatusOK}
+		next.ServeHTTP(sw, r)
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		metrics.requests.inc(route, strconv.Itoa(sw.code))
+	})
+}
+
+// statusWriter remembers the status code written
+type statusWriter struct {
+	http.ResponseWriter
+	code        int
+	wroteHeader bool
+}
+
+func (s *statusWriter) WriteHeader(code int) {
+	if !s.wroteHeader {
+		s.code, s.wroteHeader = code, true
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusWriter) Write(p []byte) (int, error) {
+	s.wroteHeader = true
+	return s.ResponseWriter.Write(p)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (s *statusWriter) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+func (s *statusWriter) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
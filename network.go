@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// ============================================================
+// Bind Address
+// ============================================================
+//
+// The preview server hands out the loaded page, the original archive and
+// a browser opener, so it listens on the loopback interface unless LAN
+// sharing is turned on explicitly.
+
+// defaultBind keeps the server on this machine
+const defaultBind = "127.0.0.1"
+
+// resolveBind picks the address to listen on. --lan on its own shares on
+// every interface; any other non-loopback address needs --lan too.
+func resolveBind(bind string, lan bool) (string, error) {
+	if bind == "" {
+		bind = defaultBind
+	}
+	if lan && isLoopbackHost(bind) {
+		return "0.0.0.0", nil
+	}
+	if !lan && !isLoopbackHost(bind) {
+		return "", fmt.Errorf("binding to %s would expose loopd to the network; pass --lan or set \"lan\": true to share on your LAN", bind)
+	}
+	return bind, nil
+}
+
+// isLoopbackHost reports whether host only accepts connections from this
+// machine
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// serverURL is the local address of this run's preview server, set once
+// its listener is open
+var serverURL string
+
+// localURL is the address to open in a browser on this machine
+func localURL(addr net.Addr, port int) string {
+	host := "localhost"
+	if tcp, ok := addr.(*net.TCPAddr); ok && !tcp.IP.IsUnspecified() && !tcp.IP.IsLoopback() {
+		host = tcp.IP.String()
+	}
+	return urlScheme + "://" + net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// networkURLs lists the addresses other machines can reach the server
+// on: every non-loopback interface address when listening on all of them,
+// or the one bound address
+func networkURLs(addr net.Addr, port int) []string {
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok || tcp.IP.IsLoopback() {
+		return nil
+	}
+	if !tcp.IP.IsUnspecified() {
+		return []string{localURL(addr, port)}
+	}
+	ifaces, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil
+	}
+	var urls []string
+	for _, a := range ifaces {
+		ipnet, ok := a.(*net.IPNet)
+		if !ok || ipnet.IP.IsLoopback() || ipnet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		// An IPv4 wildcard only accepts IPv4 connections
+		if tcp.IP.To4() != nil && ipnet.IP.To4() == nil {
+			continue
+		}
+		urls = append(urls, urlScheme+"://"+net.JoinHostPort(ipnet.IP.String(), strconv.Itoa(port)))
+	}
+	return urls
+}
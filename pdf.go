@@ -0,0 +1,1375 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"log/slog"
+	"math"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf16"
+)
+
+// ============================================================
+// PDF Writer
+// ============================================================
+//
+// A small PDF 1.4 writer that lays out the markdown tree itself. It uses
+// the standard Helvetica and Courier fonts, so nothing is embedded; text
+// is encoded as WinAnsi, which covers Western European languages, and
+// other characters print as "?".
+
+func init() {
+	exportFormats["pdf"] = exportFormat{
+		ext:  ".pdf",
+		mime: "application/pdf",
+		// Images are embedded in the document
+		render: func(doc *Document, opts exportOptions) ([]byte, error) {
+			return renderPDF(doc, opts.TOC)
+		},
+	}
+}
+
+// Page geometry in points, US Letter
+const (
+	pdfPageWidth  = 612.0
+	pdfPageHeight = 792.0
+	pdfMargin     = 56.0
+	pdfBottom     = pdfPageHeight - pdfMargin
+	pdfBodySize   = 10.5
+)
+
+// PDF colors as fill/stroke operands
+const (
+	pdfText      = "0.122 0.161 0.216"
+	pdfMuted     = "0.420 0.447 0.502"
+	pdfLinkColor = "0.145 0.388 0.922"
+	pdfRule      = "0.820 0.835 0.859"
+	pdfCodeFill  = "0.953 0.957 0.965"
+)
+
+// pdfCalloutColors are the bar and fill colors of each callout type
+var pdfCalloutColors = map[string][2]string{
+	"NOTE":      {"0.231 0.510 0.965", "0.937 0.965 1"},
+	"TIP":       {"0.063 0.725 0.506", "0.925 0.992 0.961"},
+	"IMPORTANT": {"0.486 0.227 0.929", "0.961 0.953 1"},
+	"WARNING":   {"0.961 0.620 0.043", "1 0.984 0.922"},
+	"CAUTION":   {"0.937 0.267 0.267", "0.996 0.949 0.949"},
+}
+
+// renderPDF lays out a document as a PDF, optionally led by a table of
+// contents built from the heading outline
+func renderPDF(doc *Document, toc bool) ([]byte, error) {
+	r := newPDFRenderer(doc)
+	if titleNode(doc) == nil {
+		// The title came from the file name, so the page has no heading
+		r.block(&Node{Type: "heading", Depth: 1, Children: []*Node{{Type: "text", Value: doc.Title}}})
+	}
+	r.blocks(doc.Root.Children)
+	r.finishPage()
+
+	var front []*pdfPage
+	if toc && len(r.headings) > 0 {
+		// Entries take one line each, so the page count does not depend on
+		// the numbers printed; lay out once to count, then for real
+		front = r.tableOfContents(0)
+		front = r.tableOfContents(len(front))
+	}
+	return r.write(doc, front)
+}
+
+// ============================================================
+// Text and Fonts
+// ============================================================
+
+type pdfFont int
+
+const (
+	fontRegular pdfFont = iota
+	fontBold
+	fontItalic
+	fontBoldItalic
+	fontMono
+)
+
+var pdfFontNames = [...]string{"Helvetica", "Helvetica-Bold", "Helvetica-Oblique", "Helvetica-BoldOblique", "Courier"}
+
+// Advance widths of the printable ASCII characters, in thousandths of the
+// font size, from the Adobe font metrics
+var (
+	helveticaWidths = [95]int{
+		278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+		1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+		333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+		556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+	}
+	helveticaBoldWidths = [95]int{
+		278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+		975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+		333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+		611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+	}
+	// winAnsiWidths covers the punctuation in the 0x80-0x9F range
+	winAnsiWidths = map[byte]int{
+		0x80: 556, 0x82: 222, 0x83: 556, 0x84: 333, 0x85: 1000, 0x86: 556, 0x87: 556,
+		0x88: 333, 0x89: 1000, 0x8A: 667, 0x8B: 333, 0x8C: 1000, 0x8E: 611, 0x91: 222,
+		0x92: 222, 0x93: 333, 0x94: 333, 0x95: 350, 0x96: 556, 0x97: 1000, 0x98: 333,
+		0x99: 1000, 0x9A: 500, 0x9B: 333, 0x9C: 944, 0x9E: 500, 0x9F: 667, 0xA0: 278,
+	}
+)
+
+// charWidth is the advance of an encoded character in thousandths
+func (f pdfFont) charWidth(c byte) int {
+	switch {
+	case f == fontMono:
+		return 600
+	case c >= 32 && c < 127:
+		if f == fontBold || f == fontBoldItalic {
+			return helveticaBoldWidths[c-32]
+		}
+		return helveticaWidths[c-32]
+	case winAnsiWidths[c] != 0:
+		return winAnsiWidths[c]
+	case c >= 0xC0 && c < 0xE0:
+		// Accented capitals
+		return 722
+	default:
+		return 556
+	}
+}
+
+// width measures encoded text at a size
+func (f pdfFont) width(s string, size float64) float64 {
+	total := 0
+	for i := 0; i < len(s); i++ {
+		total += f.charWidth(s[i])
+	}
+	return float64(total) * size / 1000
+}
+
+// bold and italic return the font with that style added
+func (f pdfFont) bold() pdfFont {
+	switch f {
+	case fontRegular:
+		return fontBold
+	case fontItalic:
+		return fontBoldItalic
+	}
+	return f
+}
+
+func (f pdfFont) italic() pdfFont {
+	switch f {
+	case fontRegular:
+		return fontItalic
+	case fontBold:
+		return fontBoldItalic
+	}
+	return f
+}
+
+// winAnsiSpecials are the non-Latin-1 characters WinAnsi places in 0x80-0x9F
+var winAnsiSpecials = map[rune]byte{
+	'€': 0x80, '‚': 0x82, 'ƒ': 0x83, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87,
+	'ˆ': 0x88, '‰': 0x89, 'Š': 0x8A, '‹': 0x8B, 'Œ': 0x8C, 'Ž': 0x8E, '‘': 0x91,
+	'’': 0x92, '“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97, '˜': 0x98,
+	'™': 0x99, 'š': 0x9A, '›': 0x9B, 'œ': 0x9C, 'ž': 0x9E, 'Ÿ': 0x9F,
+}
+
+// winAnsi encodes text for the standard fonts. Symbols such as emoji and
+// invisible formatting characters are dropped; anything else outside the
+// encoding becomes "?".
+func winAnsi(s string) string {
+	var b []byte
+	for _, r := range s {
+		switch {
+		case r == '\t':
+			b = append(b, ' ', ' ', ' ', ' ')
+		case r == '\n' || (r >= 0x20 && r < 0x7F) || (r >= 0xA0 && r <= 0xFF):
+			b = append(b, byte(r))
+		case winAnsiSpecials[r] != 0:
+			b = append(b, winAnsiSpecials[r])
+		case r == '→':
+			b = append(b, '-', '>')
+		case r == '←':
+			b = append(b, '<', '-')
+		case unicode.In(r, unicode.So, unicode.Sk, unicode.Mn, unicode.Cf, unicode.Cs, unicode.Co):
+		default:
+			b = append(b, '?')
+		}
+	}
+	return string(b)
+}
+
+// pdfString writes encoded text as a PDF literal string
+func pdfString(s string) string {
+	return "(" + strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`, "\r", `\r`).Replace(s) + ")"
+}
+
+// pdfTextString writes metadata text, using UTF-16 when it is not ASCII
+func pdfTextString(s string) string {
+	ascii := true
+	for _, r := range s {
+		if r < 0x20 || r > 0x7E {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return pdfString(s)
+	}
+	var sb strings.Builder
+	sb.WriteString("<FEFF")
+	for _, u := range utf16.Encode([]rune(s)) {
+		fmt.Fprintf(&sb, "%04X", u)
+	}
+	sb.WriteString(">")
+	return sb.String()
+}
+
+// ============================================================
+// Inline Layout
+// ============================================================
+
+// pdfStyle is the look of a run of text
+type pdfStyle struct {
+	font   pdfFont
+	size   float64
+	color  string
+	link   string
+	code   bool
+	strike bool
+}
+
+// pdfWord is an unbreakable piece of encoded text
+type pdfWord struct {
+	text  string
+	style pdfStyle
+	width float64
+	space bool // a space may break the line after this word
+	brk   bool // a hard line break follows
+}
+
+// pdfLine is a laid out line of words
+type pdfLine struct {
+	words  []pdfWord
+	width  float64
+	height float64
+	size   float64 // largest font size, which sets the baseline
+}
+
+// words turns inline nodes into words in a base style
+func (r *pdfRenderer) words(nodes []*Node, st pdfStyle) []pdfWord {
+	var out []pdfWord
+	r.collectWords(nodes, st, &out)
+	return out
+}
+
+func (r *pdfRenderer) collectWords(nodes []*Node, st pdfStyle, out *[]pdfWord) {
+	for _, n := range nodes {
+		switch n.Type {
+		case "text":
+			appendWords(out, n.Value, st)
+		case "inlineCode":
+			code := st
+			code.font, code.size, code.code = fontMono, st.size*0.9, true
+			appendWords(out, n.Value, code)
+		case "strong":
+			bold := st
+			bold.font = st.font.bold()
+			r.collectWords(n.Children, bold, out)
+		case "emphasis":
+			em := st
+			em.font = st.font.italic()
+			r.collectWords(n.Children, em, out)
+		case "delete":
+			del := st
+			del.strike = true
+			r.collectWords(n.Children, del, out)
+		case "link":
+			link := st
+			link.link, link.color = n.URL, pdfLinkColor
+			r.collectWords(n.Children, link, out)
+		case "break":
+			markBreak(out)
+		case "image":
+			// Images inside a line print their alt text
+			alt := n.Alt
+			if alt == "" {
+				alt = "image"
+			}
+			em := st
+			em.font, em.color = st.font.italic(), pdfMuted
+			appendWords(out, "["+alt+"]", em)
+		case "html":
+			if isBreakTag(n.Value) {
+				markBreak(out)
+			} else if !strings.HasPrefix(strings.TrimSpace(n.Value), "<!--") {
+				appendWords(out, n.Value, st)
+			}
+		default:
+			r.collectWords(n.Children, st, out)
+		}
+	}
+}
+
+// appendWords splits text at spaces. Text that does not start with a space
+// continues the previous word, so "**bold**," never breaks before the comma.
+func appendWords(out *[]pdfWord, text string, st pdfStyle) {
+	enc := winAnsi(text)
+	for i := 0; i < len(enc); {
+		if enc[i] == ' ' || enc[i] == '\n' {
+			if n := len(*out); n > 0 {
+				(*out)[n-1].space = true
+			}
+			i++
+			continue
+		}
+		j := i
+		for j < len(enc) && enc[j] != ' ' && enc[j] != '\n' {
+			j++
+		}
+		word := enc[i:j]
+		*out = append(*out, pdfWord{text: word, style: st, width: st.font.width(word, st.size)})
+		i = j
+	}
+}
+
+func markBreak(out *[]pdfWord) {
+	if n := len(*out); n > 0 {
+		(*out)[n-1].brk = true
+	}
+}
+
+// layoutLines breaks words into lines no wider than width, breaking only
+// at spaces unless a word is wider than a line on its own
+func layoutLines(words []pdfWord, width float64, minSize float64) []pdfLine {
+	var lines []pdfLine
+	var cur pdfLine
+	flush := func() {
+		if cur.size == 0 {
+			cur.size = minSize
+		}
+		cur.height = cur.size * 1.45
+		lines = append(lines, cur)
+		cur = pdfLine{}
+	}
+
+	for i := 0; i < len(words); {
+		// A unit is the run of words up to the next break opportunity
+		j := i
+		unitWidth := 0.0
+		for ; j < len(words); j++ {
+			unitWidth += words[j].width
+			if words[j].space || words[j].brk {
+				j++
+				break
+			}
+		}
+		unit := words[i:j]
+		i = j
+
+		gap := 0.0
+		if n := len(cur.words); n > 0 && cur.words[n-1].space {
+			last := cur.words[n-1].style
+			gap = last.font.width(" ", last.size)
+		}
+		if len(cur.words) > 0 && cur.width+gap+unitWidth > width {
+			flush()
+			gap = 0
+		}
+		if unitWidth > width {
+			// Break an overlong word at characters
+			for _, w := range unit {
+				for _, piece := range splitWord(w, width-cur.width) {
+					if len(cur.words) > 0 && cur.width+piece.width > width {
+						flush()
+					}
+					cur.words = append(cur.words, piece)
+					cur.width += piece.width
+					cur.size = max(cur.size, piece.style.size)
+				}
+			}
+		} else {
+			cur.width += gap
+			for _, w := range unit {
+				cur.words = append(cur.words, w)
+				cur.width += w.width
+				cur.size = max(cur.size, w.style.size)
+			}
+		}
+		if len(unit) > 0 && unit[len(unit)-1].brk {
+			flush()
+		}
+	}
+	if len(cur.words) > 0 || len(lines) == 0 {
+		flush()
+	}
+	return lines
+}
+
+// splitWord cuts a word into pieces that fit a line, the first one fitting
+// in the space left on the current line
+func splitWord(w pdfWord, first float64) []pdfWord {
+	if w.width <= first {
+		return []pdfWord{w}
+	}
+	var pieces []pdfWord
+	limit := first
+	start, acc := 0, 0.0
+	for i := 0; i < len(w.text); i++ {
+		cw := float64(w.style.font.charWidth(w.text[i])) * w.style.size / 1000
+		if acc+cw > limit && i > start {
+			pieces = append(pieces, pdfWord{text: w.text[start:i], style: w.style, width: acc})
+			start, acc = i, 0
+			limit = math.Inf(1)
+		}
+		acc += cw
+	}
+	last := pdfWord{text: w.text[start:], style: w.style, width: acc, space: w.space, brk: w.brk}
+	return append(pieces, last)
+}
+
+// ============================================================
+// Block Layout
+// ============================================================
+
+// pdfPage collects a page's drawing. Box backgrounds go to bg so they are
+// painted before the text drawn over them.
+type pdfPage struct {
+	bg, fg bytes.Buffer
+	links  []pdfLink
+}
+
+// pdfLink is a clickable area in top-down page coordinates
+type pdfLink struct {
+	x0, y0, x1, y1 float64
+	uri            string
+	anchor         string // heading slug for links within the document
+	page           int    // target page for table of contents entries
+	top            float64
+}
+
+// pdfBox is a background box such as a callout or code block. A box that
+// spans pages is drawn as one segment per page.
+type pdfBox struct {
+	x0, x1 float64
+	top    float64
+	fill   string
+	bar    string
+}
+
+// pdfHeading records where a heading landed
+type pdfHeading struct {
+	depth int
+	text  string
+	slug  string
+	page  int
+	top   float64
+}
+
+type pdfRenderer struct {
+	doc      *Document
+	pages    []*pdfPage
+	page     *pdfPage
+	y        float64 // top of the next block, from the top of the page
+	left     float64
+	right    float64
+	gap      float64 // space after paragraphs; smaller in tight lists
+	boxes    []*pdfBox
+	images   []*pdfImage
+	loaded   map[string]*pdfImage
+	headings []pdfHeading
+	slugs    *slugger
+}
+
+func newPDFRenderer(doc *Document) *pdfRenderer {
+	r := &pdfRenderer{
+		doc:    doc,
+		left:   pdfMargin,
+		right:  pdfPageWidth - pdfMargin,
+		gap:    8,
+		loaded: make(map[string]*pdfImage),
+		slugs:  newSlugger(),
+	}
+	r.newPage()
+	return r
+}
+
+func (r *pdfRenderer) newPage() {
+	if r.page != nil {
+		r.finishPage()
+	}
+	r.page = &pdfPage{}
+	r.pages = append(r.pages, r.page)
+	r.y = pdfMargin
+	for _, b := range r.boxes {
+		b.top = pdfMargin
+	}
+	if len(r.boxes) > 0 {
+		r.y += 6
+	}
+}
+
+// finishPage draws the segments of boxes still open on the current page
+func (r *pdfRenderer) finishPage() {
+	for _, b := range r.boxes {
+		r.drawBox(b, r.y+6)
+	}
+}
+
+// ensure starts a new page unless h points fit below the cursor. Nothing
+// moves at the top of a page, since it would not fit on the next one either.
+func (r *pdfRenderer) ensure(h float64) {
+	if r.y+h > pdfBottom && r.y > pdfMargin+12 {
+		r.newPage()
+	}
+}
+
+func (r *pdfRenderer) openBox(b *pdfBox, pad float64) {
+	b.top = r.y
+	r.boxes = append(r.boxes, b)
+	r.y += pad
+}
+
+func (r *pdfRenderer) closeBox(pad float64) {
+	b := r.boxes[len(r.boxes)-1]
+	r.boxes = r.boxes[:len(r.boxes)-1]
+	r.y += pad
+	r.drawBox(b, r.y)
+}
+
+func (r *pdfRenderer) drawBox(b *pdfBox, bottom float64) {
+	bottom = min(bottom, pdfBottom+6)
+	if bottom <= b.top {
+		return
+	}
+	bg := &r.page.bg
+	if b.fill != "" {
+		fmt.Fprintf(bg, "%s rg %.2f %.2f %.2f %.2f re f\n", b.fill, b.x0, pdfPageHeight-bottom, b.x1-b.x0, bottom-b.top)
+	}
+	if b.bar != "" {
+		fmt.Fprintf(bg, "%s rg %.2f %.2f 3 %.2f re f\n", b.bar, b.x0, pdfPageHeight-bottom, bottom-b.top)
+	}
+}
+
+func (r *pdfRenderer) blocks(nodes []*Node) {
+	for _, n := range nodes {
+		r.block(n)
+	}
+}
+
+// headingSizes are the font sizes of h1 to h6
+var headingSizes = [...]float64{22, 17, 14, 12, 11, 10.5}
+
+func (r *pdfRenderer) block(n *Node) {
+	switch n.Type {
+	case "heading":
+		depth := min(max(n.Depth, 1), 6)
+		size := headingSizes[depth-1]
+		if r.y > pdfMargin {
+			r.y += size * 0.7
+		}
+		// Keep the heading with the first lines that follow it
+		r.ensure(size*1.45 + 3*pdfBodySize*1.45)
+		text := strings.TrimSpace(nodeText(n))
+		r.headings = append(r.headings, pdfHeading{depth: n.Depth, text: text, slug: r.slugs.slug(text), page: len(r.pages) - 1, top: r.y})
+		st := pdfStyle{font: fontBold, size: size, color: pdfText}
+		r.paragraphLines(r.words(n.Children, st), size)
+		if depth <= 2 {
+			fmt.Fprintf(&r.page.fg, "%s RG 0.75 w %.2f %.2f m %.2f %.2f l S\n", pdfRule, r.left, pdfPageHeight-r.y-2, r.right, pdfPageHeight-r.y-2)
+			r.y += 4
+		}
+		r.y += 4
+
+	case "paragraph":
+		r.paragraph(n)
+
+	case "blockquote":
+		if n.Callout != "" {
+			r.callout(n)
+			return
+		}
+		r.ensure(pdfBodySize * 1.45)
+		r.openBox(&pdfBox{x0: r.left, x1: r.right, bar: pdfRule}, 2)
+		r.left += 14
+		r.blocks(n.Children)
+		r.left -= 14
+		r.closeBox(0)
+		r.y += 4
+
+	case "list":
+		r.list(n, 0)
+		r.y += r.gap - 2
+
+	case "code":
+		r.code(n)
+
+	case "table":
+		r.table(n)
+
+	case "thematicBreak":
+		r.ensure(16)
+		fmt.Fprintf(&r.page.fg, "%s RG 1 w %.2f %.2f m %.2f %.2f l S\n", pdfRule, r.left, pdfPageHeight-r.y-8, r.right, pdfPageHeight-r.y-8)
+		r.y += 16
+
+	case "html":
+		if strings.HasPrefix(strings.TrimSpace(n.Value), "<!--") {
+			return
+		}
+		r.paragraphLines(r.words([]*Node{n}, r.bodyStyle()), pdfBodySize)
+		r.y += r.gap
+
+	default:
+		r.paragraphLines(r.words([]*Node{n}, r.bodyStyle()), pdfBodySize)
+		r.y += r.gap
+	}
+}
+
+func (r *pdfRenderer) bodyStyle() pdfStyle {
+	return pdfStyle{font: fontRegular, size: pdfBodySize, color: pdfText}
+}
+
+// paragraph lays out text, placing images as blocks between the runs of
+// text around them
+func (r *pdfRenderer) paragraph(n *Node) {
+	var run []*Node
+	flush := func() {
+		if len(run) > 0 {
+			if words := r.words(run, r.bodyStyle()); len(words) > 0 {
+				r.paragraphLines(words, pdfBodySize)
+			}
+			run = nil
+		}
+	}
+	for _, c := range n.Children {
+		if c.Type == "image" {
+			flush()
+			r.image(c)
+			continue
+		}
+		run = append(run, c)
+	}
+	flush()
+	r.y += r.gap
+}
+
+// paragraphLines draws words as lines from the cursor, breaking pages
+// between lines
+func (r *pdfRenderer) paragraphLines(words []pdfWord, size float64) {
+	for _, line := range layoutLines(words, r.right-r.left, size) {
+		r.ensure(line.height)
+		r.drawLine(line, r.left, r.y)
+		r.y += line.height
+	}
+}
+
+// drawLine draws a line whose top is at top. Words in the same style are
+// shown together with their spaces, so copied text reads naturally.
+func (r *pdfRenderer) drawLine(line pdfLine, x, top float64) {
+	baseline := top + line.size*1.1
+	fg := &r.page.fg
+	for i := 0; i < len(line.words); {
+		st := line.words[i].style
+		var text strings.Builder
+		width := 0.0
+		for ; i < len(line.words) && line.words[i].style == st; i++ {
+			w := line.words[i]
+			text.WriteString(w.text)
+			width += w.width
+			if w.space && i < len(line.words)-1 {
+				text.WriteByte(' ')
+				width += st.font.width(" ", st.size)
+			}
+		}
+		if st.code {
+			fmt.Fprintf(&r.page.bg, "%s rg %.2f %.2f %.2f %.2f re f\n", pdfCodeFill,
+				x-1.5, pdfPageHeight-baseline-st.size*0.3, width+3, st.size*1.25)
+		}
+		fmt.Fprintf(fg, "BT %s rg /F%d %.2f Tf %.2f %.2f Td %s Tj ET\n", st.color, int(st.font)+1, st.size, x, pdfPageHeight-baseline, pdfString(text.String()))
+		if st.strike {
+			y := pdfPageHeight - baseline + st.size*0.3
+			fmt.Fprintf(fg, "%s RG 0.6 w %.2f %.2f m %.2f %.2f l S\n", st.color, x, y, x+width, y)
+		}
+		if st.link != "" {
+			link := pdfLink{x0: x, y0: top, x1: x + width, y1: top + line.height, uri: st.link}
+			if anchor, ok := strings.CutPrefix(st.link, "#"); ok {
+				link.uri, link.anchor = "", anchor
+			}
+			r.page.links = append(r.page.links, link)
+		}
+		x += width
+	}
+}
+
+func (r *pdfRenderer) callout(n *Node) {
+	colors, ok := pdfCalloutColors[n.Callout]
+	if !ok {
+		colors = pdfCalloutColors["NOTE"]
+	}
+	r.ensure(pdfBodySize * 1.45 * 3)
+	r.openBox(&pdfBox{x0: r.left, x1: r.right, fill: colors[1], bar: colors[0]}, 6)
+	r.left += 14
+	r.right -= 10
+	title := pdfStyle{font: fontBold, size: pdfBodySize, color: colors[0]}
+	var words []pdfWord
+	appendWords(&words, calloutTitle(n.Callout), title)
+	r.paragraphLines(words, pdfBodySize)
+	r.y += 2
+	r.blocks(n.Children)
+	r.y -= r.gap // the box padding replaces the last paragraph's gap
+	r.left -= 14
+	r.right += 10
+	r.closeBox(6)
+	r.y += r.gap
+}
+
+func (r *pdfRenderer) code(n *Node) {
+	size := pdfBodySize * 0.85
+	lineHeight := size * 1.4
+	r.ensure(lineHeight + 12)
+	r.openBox(&pdfBox{x0: r.left, x1: r.right, fill: pdfCodeFill}, 6)
+	perLine := max(int((r.right-r.left-16)/(size*0.6)), 10)
+	st := pdfStyle{font: fontMono, size: size, color: pdfText}
+	for _, src := range strings.Split(winAnsi(n.Value), "\n") {
+		for {
+			piece := src
+			if len(piece) > perLine {
+				piece = src[:perLine]
+			}
+			r.ensure(lineHeight)
+			if piece != "" {
+				fmt.Fprintf(&r.page.fg, "BT %s rg /F%d %.2f Tf %.2f %.2f Td %s Tj ET\n", st.color, int(fontMono)+1, size,
+					r.left+8, pdfPageHeight-r.y-size, pdfString(piece))
+			}
+			r.y += lineHeight
+			if len(src) <= perLine {
+				break
+			}
+			src = src[perLine:]
+		}
+	}
+	r.closeBox(6)
+	r.y += r.gap
+}
+
+// list draws items with bullets, numbers or checkboxes in the margin
+func (r *pdfRenderer) list(n *Node, depth int) {
+	num := n.Start
+	if num == 0 {
+		num = 1
+	}
+	saved := r.gap
+	if !n.Spread {
+		r.gap = 2
+	}
+	for _, li := range n.Children {
+		r.ensure(pdfBodySize * 1.45)
+		baseline := r.y + pdfBodySize*1.1
+		st := r.bodyStyle()
+		switch {
+		case li.Checked != nil:
+			r.checkbox(r.left+4, baseline, *li.Checked)
+		case n.Ordered:
+			marker := winAnsi(fmt.Sprintf("%d.", num))
+			x := r.left + 14 - st.font.width(marker, st.size)
+			fmt.Fprintf(&r.page.fg, "BT %s rg /F1 %.2f Tf %.2f %.2f Td %s Tj ET\n", st.color, st.size, x, pdfPageHeight-baseline, pdfString(marker))
+			num++
+		default:
+			marker := "\x95" // bullet
+			if depth%2 == 1 {
+				marker = "\x96" // en dash
+			}
+			fmt.Fprintf(&r.page.fg, "BT %s rg /F1 %.2f Tf %.2f %.2f Td %s Tj ET\n", st.color, st.size, r.left+5, pdfPageHeight-baseline, pdfString(marker))
+		}
+		r.left += 18
+		for _, c := range li.Children {
+			if c.Type == "list" {
+				r.list(c, depth+1)
+				continue
+			}
+			r.block(c)
+		}
+		r.left -= 18
+	}
+	r.gap = saved
+}
+
+// checkbox draws a task list box, ticked when done
+func (r *pdfRenderer) checkbox(x, baseline float64, checked bool) {
+	y := pdfPageHeight - baseline - 1
+	fg := &r.page.fg
+	fmt.Fprintf(fg, "%s RG 0.8 w %.2f %.2f 8 8 re S\n", pdfMuted, x, y)
+	if checked {
+		fmt.Fprintf(fg, "%s RG 1.4 w %.2f %.2f m %.2f %.2f l %.2f %.2f l S\n", pdfLinkColor, x+1.5, y+4, x+3.5, y+1.8, x+6.8, y+6.8)
+	}
+}
+
+// table sizes columns to their content, wraps cells, and repeats the
+// header row on each page the table spans
+func (r *pdfRenderer) table(n *Node) {
+	if len(n.Children) == 0 {
+		return
+	}
+	cols := len(n.Align)
+	for _, row := range n.Children {
+		cols = max(cols, len(row.Children))
+	}
+	if cols == 0 {
+		return
+	}
+	const pad, size = 4.0, pdfBodySize * 0.9
+
+	cells := make([][][]pdfWord, len(n.Children))
+	natural := make([]float64, cols)
+	longest := make([]float64, cols)
+	for i, row := range n.Children {
+		cells[i] = make([][]pdfWord, cols)
+		st := pdfStyle{font: fontRegular, size: size, color: pdfText}
+		if i == 0 {
+			st.font = fontBold
+		}
+		for c := 0; c < cols; c++ {
+			if c < len(row.Children) {
+				cells[i][c] = r.words(row.Children[c].Children, st)
+			}
+			total := 0.0
+			for _, w := range cells[i][c] {
+				total += w.width + w.style.font.width(" ", size)
+				longest[c] = max(longest[c], w.width)
+			}
+			natural[c] = max(natural[c], total+2*pad)
+		}
+	}
+
+	// Columns get their natural width when the table fits, otherwise a
+	// floor each and the remaining space in proportion to their content
+	avail := r.right - r.left
+	widths := make([]float64, cols)
+	sum := 0.0
+	for _, w := range natural {
+		sum += w
+	}
+	if sum <= avail {
+		copy(widths, natural)
+	} else {
+		floorSum, extra := 0.0, 0.0
+		floors := make([]float64, cols)
+		for c := range floors {
+			floors[c] = min(natural[c], max(avail/float64(cols)/2, min(longest[c]+2*pad, avail/float64(cols))))
+			floorSum += floors[c]
+			extra += natural[c] - floors[c]
+		}
+		for c := range widths {
+			widths[c] = floors[c]
+			if extra > 0 {
+				widths[c] += (avail - floorSum) * (natural[c] - floors[c]) / extra
+			}
+		}
+	}
+
+	layout := func(i int) ([][]pdfLine, float64) {
+		lines := make([][]pdfLine, cols)
+		height := 0.0
+		for c := 0; c < cols; c++ {
+			lines[c] = layoutLines(cells[i][c], widths[c]-2*pad, size)
+			h := 0.0
+			for _, l := range lines[c] {
+				h += l.height
+			}
+			height = max(height, h)
+		}
+		return lines, height + 2*pad
+	}
+	drawRow := func(i int, lines [][]pdfLine, height float64) {
+		x := r.left
+		if i == 0 {
+			fmt.Fprintf(&r.page.bg, "%s rg %.2f %.2f %.2f %.2f re f\n", pdfCodeFill, r.left, pdfPageHeight-r.y-height, sumOf(widths), height)
+		}
+		for c := 0; c < cols; c++ {
+			align := ""
+			if c < len(n.Align) {
+				align = n.Align[c]
+			}
+			top := r.y + pad
+			for _, l := range lines[c] {
+				lx := x + pad
+				switch align {
+				case "center":
+					lx += (widths[c] - 2*pad - l.width) / 2
+				case "right":
+					lx += widths[c] - 2*pad - l.width
+				}
+				r.drawLine(l, lx, top)
+				top += l.height
+			}
+			fmt.Fprintf(&r.page.fg, "%s RG 0.6 w %.2f %.2f %.2f %.2f re S\n", pdfRule, x, pdfPageHeight-r.y-height, widths[c], height)
+			x += widths[c]
+		}
+		r.y += height
+	}
+
+	header, headerHeight := layout(0)
+	r.ensure(headerHeight + pdfBodySize*2)
+	drawRow(0, header, headerHeight)
+	for i := 1; i < len(n.Children); i++ {
+		lines, height := layout(i)
+		if r.y+height > pdfBottom {
+			r.newPage()
+			drawRow(0, header, headerHeight)
+		}
+		drawRow(i, lines, height)
+	}
+	r.y += r.gap + 4
+}
+
+func sumOf(values []float64) float64 {
+	total := 0.0
+	for _, v := range values {
+		total += v
+	}
+	return total
+}
+
+// image places an image as a block, scaled to the text width and the page
+// height. Images that cannot be decoded print their alt text instead.
+func (r *pdfRenderer) image(n *Node) {
+	img := r.loadImage(n.URL)
+	if img == nil {
+		alt := n.Alt
+		if alt == "" {
+			alt = n.URL
+		}
+		st := r.bodyStyle()
+		st.font, st.color = fontItalic, pdfMuted
+		var words []pdfWord
+		appendWords(&words, "[Image: "+alt+"]", st)
+		r.paragraphLines(words, pdfBodySize)
+		return
+	}
+	// Screenshots are usually 2x, so 96 dpi keeps them from looking huge
+	w := float64(img.width) * 0.75
+	h := float64(img.height) * 0.75
+	if avail := r.right - r.left; w > avail {
+		h *= avail / w
+		w = avail
+	}
+	if maxH := pdfBottom - pdfMargin - 12; h > maxH {
+		w *= maxH / h
+		h = maxH
+	}
+	r.ensure(h + 4)
+	fmt.Fprintf(&r.page.fg, "q %.2f 0 0 %.2f %.2f %.2f cm /%s Do Q\n", w, h, r.left, pdfPageHeight-r.y-h, img.name)
+	r.y += h + 4
+}
+
+// ============================================================
+// Images
+// ============================================================
+
+// pdfImage is an image XObject
+type pdfImage struct {
+	name          string
+	width, height int
+	filter        string
+	colorSpace    string
+	data          []byte
+	alpha         []byte // Flate-compressed soft mask, nil when opaque
+}
+
+// loadImage decodes an export image once per document
+func (r *pdfRenderer) loadImage(ref string) *pdfImage {
+	name, ok := strings.CutPrefix(ref, "images/")
+	if !ok {
+		return nil
+	}
+	if img, seen := r.loaded[name]; seen {
+		return img
+	}
+	var img *pdfImage
+	if dataURL, found := r.doc.Images[name]; found {
+		if _, data, err := decodeDataURL(dataURL); err == nil {
+			img, err = newPDFImage(data)
+			if err != nil {
+				slog.Warn(fmt.Sprintf("PDF: skipped image %s: %v", name, err))
+			}
+		}
+	}
+	if img != nil {
+		img.name = fmt.Sprintf("Im%d", len(r.images)+1)
+		r.images = append(r.images, img)
+	}
+	r.loaded[name] = img
+	return img
+}
+
+// newPDFImage embeds JPEGs as they are and re-encodes anything else as
+// Flate-compressed RGB with a separate alpha mask
+func newPDFImage(data []byte) (*pdfImage, error) {
+	if cfg, err := jpeg.DecodeConfig(bytes.NewReader(data)); err == nil {
+		switch cfg.ColorModel {
+		case color.YCbCrModel, color.RGBAModel:
+			return &pdfImage{width: cfg.Width, height: cfg.Height, filter: "DCTDecode", colorSpace: "DeviceRGB", data: data}, nil
+		case color.GrayModel:
+			return &pdfImage{width: cfg.Width, height: cfg.Height, filter: "DCTDecode", colorSpace: "DeviceGray", data: data}, nil
+		}
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	b := src.Bounds()
+	rgb := make([]byte, 0, b.Dx()*b.Dy()*3)
+	alpha := make([]byte, 0, b.Dx()*b.Dy())
+	opaque := true
+	switch m := src.(type) {
+	case *image.NRGBA:
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			row := m.Pix[m.PixOffset(b.Min.X, y):m.PixOffset(b.Max.X, y)]
+			for i := 0; i < len(row); i += 4 {
+				rgb = append(rgb, row[i], row[i+1], row[i+2])
+				alpha = append(alpha, row[i+3])
+				opaque = opaque && row[i+3] == 0xff
+			}
+		}
+	case *image.RGBA:
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			row := m.Pix[m.PixOffset(b.Min.X, y):m.PixOffset(b.Max.X, y)]
+			for i := 0; i < len(row); i += 4 {
+				a := row[i+3]
+				if a == 0xff || a == 0 {
+					rgb = append(rgb, row[i], row[i+1], row[i+2])
+				} else {
+					// Undo premultiplication
+					rgb = append(rgb, byte(int(row[i])*255/int(a)), byte(int(row[i+1])*255/int(a)), byte(int(row[i+2])*255/int(a)))
+				}
+				alpha = append(alpha, a)
+				opaque = opaque && a == 0xff
+			}
+		}
+	default:
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				c := color.NRGBAModel.Convert(src.At(x, y)).(color.NRGBA)
+				rgb = append(rgb, c.R, c.G, c.B)
+				alpha = append(alpha, c.A)
+				opaque = opaque && c.A == 0xff
+			}
+		}
+	}
+
+	img := &pdfImage{width: b.Dx(), height: b.Dy(), filter: "FlateDecode", colorSpace: "DeviceRGB"}
+	if img.data, err = deflate(rgb); err != nil {
+		return nil, err
+	}
+	if !opaque {
+		if img.alpha, err = deflate(alpha); err != nil {
+			return nil, err
+		}
+	}
+	return img, nil
+}
+
+func deflate(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw, err := zlib.NewWriterLevel(&buf, zlib.BestSpeed)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ============================================================
+// Table of Contents
+// ============================================================
+
+// tableOfContents lays out contents pages listing every heading with its
+// page number, where body pages follow offset front pages
+func (r *pdfRenderer) tableOfContents(offset int) []*pdfPage {
+	t := &pdfRenderer{left: pdfMargin, right: pdfPageWidth - pdfMargin, gap: 8, slugs: newSlugger()}
+	t.newPage()
+	var words []pdfWord
+	appendWords(&words, "Contents", pdfStyle{font: fontBold, size: headingSizes[0], color: pdfText})
+	t.paragraphLines(words, headingSizes[0])
+	t.y += 8
+
+	minDepth := 6
+	for _, h := range r.headings {
+		minDepth = min(minDepth, h.depth)
+	}
+	const size = pdfBodySize
+	for _, h := range r.headings {
+		t.ensure(size * 1.6)
+		indent := float64(min(h.depth-minDepth, 4)) * 14
+		st := pdfStyle{font: fontRegular, size: size, color: pdfText}
+		if h.depth == minDepth {
+			st.font = fontBold
+		}
+		number := fmt.Sprint(offset + h.page + 1)
+		numberWidth := st.font.width(number, size)
+		x := t.left + indent
+		room := t.right - numberWidth - 12 - x
+		text := winAnsi(h.text)
+		if st.font.width(text, size) > room {
+			for len(text) > 0 && st.font.width(text+"\x85", size) > room {
+				text = text[:len(text)-1]
+			}
+			text += "\x85" // ellipsis
+		}
+		baseline := t.y + size*1.1
+		fg := &t.page.fg
+		fmt.Fprintf(fg, "BT %s rg /F%d %.2f Tf %.2f %.2f Td %s Tj ET\n", st.color, int(st.font)+1, size, x, pdfPageHeight-baseline, pdfString(text))
+		fmt.Fprintf(fg, "BT %s rg /F%d %.2f Tf %.2f %.2f Td %s Tj ET\n", pdfMuted, int(st.font)+1, size, t.right-numberWidth, pdfPageHeight-baseline, pdfString(number))
+		// Dotted leader between the entry and its page number
+		if from, to := x+st.font.width(text, size)+6, t.right-numberWidth-6; to > from {
+			fmt.Fprintf(fg, "%s RG 0.8 w [0.8 2.4] 0 d %.2f %.2f m %.2f %.2f l S [] 0 d\n", pdfRule, from, pdfPageHeight-baseline, to, pdfPageHeight-baseline)
+		}
+		t.page.links = append(t.page.links, pdfLink{x0: x, y0: t.y, x1: t.right, y1: t.y + size*1.6, page: offset + h.page, top: h.top})
+		t.y += size * 1.6
+	}
+	return t.pages
+}
+
+// ============================================================
+// File Structure
+// ============================================================
+
+// pdfFile writes numbered objects and the cross-reference table
+type pdfFile struct {
+	buf     bytes.Buffer
+	offsets []int
+}
+
+// reserve allocates an object number to write later
+func (f *pdfFile) reserve() int {
+	f.offsets = append(f.offsets, 0)
+	return len(f.offsets)
+}
+
+func (f *pdfFile) object(n int, body string) {
+	f.offsets[n-1] = f.buf.Len()
+	fmt.Fprintf(&f.buf, "%d 0 obj\n%s\nendobj\n", n, body)
+}
+
+func (f *pdfFile) stream(n int, dict string, data []byte) {
+	f.offsets[n-1] = f.buf.Len()
+	fmt.Fprintf(&f.buf, "%d 0 obj\n<<%s /Length %d>>\nstream\n", n, dict, len(data))
+	f.buf.Write(data)
+	f.buf.WriteString("\nendstream\nendobj\n")
+}
+
+// write assembles the front pages and body pages into a PDF file
+func (r *pdfRenderer) write(doc *Document, front []*pdfPage) ([]byte, error) {
+	pages := append(front, r.pages...)
+	f := &pdfFile{}
+	f.buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	catalog := f.reserve()
+	tree := f.reserve()
+	info := f.reserve()
+	fonts := make([]int, len(pdfFontNames))
+	for i := range fonts {
+		fonts[i] = f.reserve()
+	}
+	imageObjs := make([]int, len(r.images))
+	for i := range imageObjs {
+		imageObjs[i] = f.reserve()
+	}
+	pageObjs := make([]int, len(pages))
+	for i := range pageObjs {
+		pageObjs[i] = f.reserve()
+	}
+
+	// Heading destinations for #anchor links
+	anchors := make(map[string]pdfHeading)
+	for _, h := range r.headings {
+		h.page += len(front)
+		anchors[h.slug] = h
+	}
+	dest := func(page int, top float64) string {
+		return fmt.Sprintf("[%d 0 R /XYZ 0 %.2f 0]", pageObjs[page], pdfPageHeight-top+12)
+	}
+
+	for i, name := range pdfFontNames {
+		enc := " /Encoding /WinAnsiEncoding"
+		f.object(fonts[i], fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s%s >>", name, enc))
+	}
+	for i, img := range r.images {
+		dict := fmt.Sprintf(" /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /%s /BitsPerComponent 8 /Filter /%s",
+			img.width, img.height, img.colorSpace, img.filter)
+		if img.alpha != nil {
+			mask := f.reserve()
+			f.stream(mask, fmt.Sprintf(" /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceGray /BitsPerComponent 8 /Filter /FlateDecode",
+				img.width, img.height), img.alpha)
+			dict += fmt.Sprintf(" /SMask %d 0 R", mask)
+		}
+		f.stream(imageObjs[i], dict, img.data)
+	}
+
+	var resources strings.Builder
+	resources.WriteString("<< /Font <<")
+	for i, obj := range fonts {
+		fmt.Fprintf(&resources, " /F%d %d 0 R", i+1, obj)
+	}
+	resources.WriteString(" >>")
+	if len(r.images) > 0 {
+		resources.WriteString(" /XObject <<")
+		for i, img := range r.images {
+			fmt.Fprintf(&resources, " /%s %d 0 R", img.name, imageObjs[i])
+		}
+		resources.WriteString(" >>")
+	}
+	resources.WriteString(" >>")
+
+	for i, p := range pages {
+		// Page number footer
+		footer := winAnsi(fmt.Sprintf("%d / %d", i+1, len(pages)))
+		fmt.Fprintf(&p.fg, "BT %s rg /F1 9 Tf %.2f 30 Td %s Tj ET\n", pdfMuted, (pdfPageWidth-fontRegular.width(footer, 9))/2, pdfString(footer))
+
+		content, err := deflate(append(p.bg.Bytes(), p.fg.Bytes()...))
+		if err != nil {
+			return nil, err
+		}
+		contentObj := f.reserve()
+		f.stream(contentObj, " /Filter /FlateDecode", content)
+
+		var annots []string
+		for _, l := range p.links {
+			var action string
+			switch {
+			case l.uri != "":
+				action = "/A << /S /URI /URI " + pdfString(l.uri) + " >>"
+			case l.anchor != "":
+				h, ok := anchors[l.anchor]
+				if !ok {
+					continue
+				}
+				action = "/Dest " + dest(h.page, h.top)
+			default:
+				action = "/Dest " + dest(l.page, l.top)
+			}
+			obj := f.reserve()
+			f.object(obj, fmt.Sprintf("<< /Type /Annot /Subtype /Link /Rect [%.2f %.2f %.2f %.2f] /Border [0 0 0] %s >>",
+				l.x0, pdfPageHeight-l.y1, l.x1, pdfPageHeight-l.y0, action))
+			annots = append(annots, fmt.Sprintf("%d 0 R", obj))
+		}
+		page := fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %.0f %.0f] /Resources %s /Contents %d 0 R",
+			tree, pdfPageWidth, pdfPageHeight, resources.String(), contentObj)
+		if len(annots) > 0 {
+			page += " /Annots [" + strings.Join(annots, " ") + "]"
+		}
+		f.object(pageObjs[i], page+" >>")
+	}
+
+	kids := make([]string, len(pageObjs))
+	for i, obj := range pageObjs {
+		kids[i] = fmt.Sprintf("%d 0 R", obj)
+	}
+	f.object(tree, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+
+	cat := fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R", tree)
+	if outlines := r.writeOutlines(f, len(front), dest); outlines != 0 {
+		cat += fmt.Sprintf(" /Outlines %d 0 R /PageMode /UseOutlines", outlines)
+	}
+	f.object(catalog, cat+" >>")
+
+	meta := fmt.Sprintf("<< /Title %s /Producer %s /CreationDate (D:%s)", pdfTextString(doc.Title),
+		pdfTextString("loopd "+version), time.Now().UTC().Format("20060102150405Z"))
+	if author := detectAuthor(doc.Root); author != "" {
+		meta += " /Author " + pdfTextString(author)
+	}
+	f.object(info, meta+" >>")
+
+	xref := f.buf.Len()
+	fmt.Fprintf(&f.buf, "xref\n0 %d\n0000000000 65535 f \n", len(f.offsets)+1)
+	for _, off := range f.offsets {
+		fmt.Fprintf(&f.buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&f.buf, "trailer\n<< /Size %d /Root %d 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n",
+		len(f.offsets)+1, catalog, info, xref)
+	return f.buf.Bytes(), nil
+}
+
+// writeOutlines writes the heading outline as PDF bookmarks and returns
+// the outline root, or 0 when there are no headings
+func (r *pdfRenderer) writeOutlines(f *pdfFile, offset int, dest func(page int, top float64) string) int {
+	if len(r.headings) == 0 {
+		return 0
+	}
+	type item struct {
+		h        pdfHeading
+		obj      int
+		children []*item
+	}
+	root := &item{obj: f.reserve()}
+	stack := []*item{root}
+	depths := []int{0}
+	for _, h := range r.headings {
+		for len(stack) > 1 && depths[len(depths)-1] >= h.depth {
+			stack, depths = stack[:len(stack)-1], depths[:len(depths)-1]
+		}
+		it := &item{h: h, obj: f.reserve()}
+		parent := stack[len(stack)-1]
+		parent.children = append(parent.children, it)
+		stack, depths = append(stack, it), append(depths, h.depth)
+	}
+
+	// Items link to their parent and siblings; a positive count shows the
+	// item expanded
+	var write func(it *item, parent int, prev, next *item) int
+	write = func(it *item, parent int, prev, next *item) int {
+		count := 0
+		for i, c := range it.children {
+			var p, n *item
+			if i > 0 {
+				p = it.children[i-1]
+			}
+			if i < len(it.children)-1 {
+				n = it.children[i+1]
+			}
+			count += 1 + write(c, it.obj, p, n)
+		}
+		var sb strings.Builder
+		sb.WriteString("<<")
+		if it == root {
+			sb.WriteString(" /Type /Outlines")
+		} else {
+			title := it.h.text
+			if title == "" {
+				title = "Untitled"
+			}
+			fmt.Fprintf(&sb, " /Title %s /Parent %d 0 R /Dest %s", pdfTextString(title), parent, dest(it.h.page+offset, it.h.top))
+		}
+		if prev != nil {
+			fmt.Fprintf(&sb, " /Prev %d 0 R", prev.obj)
+		}
+		if next != nil {
+			fmt.Fprintf(&sb, " /Next %d 0 R", next.obj)
+		}
+		if n := len(it.children); n > 0 {
+			fmt.Fprintf(&sb, " /First %d 0 R /Last %d 0 R /Count %d", it.children[0].obj, it.children[n-1].obj, count)
+		}
+		f.object(it.obj, sb.String()+" >>")
+		return count
+	}
+	write(root, 0, nil, nil)
+	return root.obj
+}
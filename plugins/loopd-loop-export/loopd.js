@@ -1678,6 +1678,14 @@
       console.log('loopd2: Added debug-mdast.json (' + Math.round(mdastBytes.length / 1024) + 'KB)');
     }
     
+    // Add page metadata so converters can match links between exported pages
+    const metadata = {
+      url: location.href,
+      title: document.title,
+      exportedAt: new Date().toISOString()
+    };
+    appendFileEntry('metadata.json', stringToBytes(JSON.stringify(metadata, null, 2)));
+    
     // Add automation types JSON
     if (automationTypes && Object.keys(automationTypes).length > 0) {
       const typesJson = JSON.stringify(automationTypes, null, 2);
@@ -0,0 +1,439 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// ============================================================
+// Redaction
+// ============================================================
+//
+// Masks email addresses, GUIDs, URL tokens, IP addresses and anything
+// matching the user's own patterns before an export is shared. Each
+// distinct value gets a numbered stand-in in the original format, so the
+// page stays readable, links stay valid and the same person is still the
+// same person throughout. The preview templates' Redact toggle asks for
+// the masked page so it can be shown on screen or shared.
+
+func init() {
+	subcommands["redact"] = subcommand{
+		usage:   "<tar> [--out <file.tar>] [--report <file.json>]",
+		summary: "Write a copy of an export with sensitive values masked",
+		run:     runRedact,
+	}
+}
+
+// RedactConfig configures the redaction pass
+type RedactConfig struct {
+	Detectors []string     `json:"detectors,omitempty"` // built-in detectors to run (default: all)
+	Rules     []RedactRule `json:"rules,omitempty"`     // extra patterns, run before the detectors
+}
+
+// RedactRule masks matches of Pattern, a Go regexp. Replace may use $1
+// groups; without it matches become "[name-N]".
+type RedactRule struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+	Replace string `json:"replace,omitempty"`
+}
+
+// redactDetector finds one kind of sensitive value. Group selects the
+// submatch to mask, so a URL token keeps its parameter name and a value
+// inside an encoded URL keeps the %XX escape before it.
+type redactDetector struct {
+	name  string
+	re    *regexp.Regexp
+	group int
+	mask  func(value string, n int) string
+	skip  func(value string) bool // matches that are not sensitive, if any
+}
+
+// redactDetectorNames lists the built-in detectors in the order they run.
+// URL tokens go first so a signature is masked whole rather than in parts.
+var redactDetectorNames = []string{"token", "email", "guid", "ip"}
+
+var builtinRedactors = map[string]redactDetector{
+	"token": {
+		name:  "token",
+		re:    regexp.MustCompile(`(?i)((?:[?&#;]|\\&|&amp;)(?:access_token|id_token|refresh_token|token|code|key|api_key|apikey|secret|password|pwd|sig|signature|sdata|data|session|sessionid|sid|auth|state)=)([^&\s)\]"'<>\\]+)`),
+		group: 2,
+		mask:  func(string, int) string { return "REDACTED" },
+	},
+	"email": {
+		name:  "email",
+		re:    regexp.MustCompile(`(?:%(?:25)?[0-9A-Fa-f]{2})?([A-Za-z0-9._+-]+(?:@|%40|%2540)[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)+)`),
+		group: 1,
+		mask: func(v string, n int) string {
+			switch {
+			case strings.Contains(v, "%2540"):
+				return fmt.Sprintf("person%d%%2540redacted.invalid", n)
+			case strings.Contains(v, "%40"):
+				return fmt.Sprintf("person%d%%40redacted.invalid", n)
+			}
+			return fmt.Sprintf("person%d@redacted.invalid", n)
+		},
+		// The domain must end in a real TLD, not com2. Teams channel and
+		// chat IDs look like 19:<id>@thread.tacv2; the guid detector masks
+		// the ID.
+		skip: func(v string) bool {
+			_, domain, _ := strings.Cut(strings.NewReplacer("%2540", "@", "%40", "@").Replace(v), "@")
+			return !reTLD.MatchString(domain) || strings.HasPrefix(strings.ToLower(domain), "thread.")
+		},
+	},
+	"guid": {
+		name:  "guid",
+		re:    regexp.MustCompile(`(?:\b|%[0-9A-Fa-f]{2})([0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}|[0-9a-fA-F]{32})\b`),
+		group: 1,
+		mask: func(v string, n int) string {
+			if len(v) == 32 {
+				return fmt.Sprintf("%032d", n)
+			}
+			return fmt.Sprintf("00000000-0000-0000-0000-%012d", n)
+		},
+	},
+	"ip": {
+		name: "ip",
+		re:   regexp.MustCompile(`\b(?:(?:25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)\.){3}(?:25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)\b|\b(?:[0-9a-fA-F]{1,4}:){7}[0-9a-fA-F]{1,4}\b`),
+		mask: func(v string, n int) string {
+			if strings.Contains(v, ":") {
+				return fmt.Sprintf("2001:db8::%x", n)
+			}
+			// Documentation ranges from RFC 5737
+			nets := []string{"192.0.2.", "198.51.100.", "203.0.113."}
+			return nets[(n-1)/254%len(nets)] + strconv.Itoa((n-1)%254+1)
+		},
+	},
+}
+
+// reTLD matches a domain ending in an alphabetic top-level domain
+var reTLD = regexp.MustCompile(`\.[A-Za-z]{2,}$`)
+
+// redactor masks text consistently across the files of one export
+type redactor struct {
+	detectors []redactDetector
+	masks     map[string]string // detector + value -> stand-in
+	next      map[string]int
+	report    *RedactionReport
+	items     map[string]*RedactedValue
+}
+
+// RedactionReport lists what was masked in an export
+type RedactionReport struct {
+	File   string           `json:"file"`
+	Total  int              `json:"total"`
+	Counts map[string]int   `json:"counts"`
+	Items  []*RedactedValue `json:"items"`
+}
+
+// RedactedValue is one distinct masked value and where it was found. The
+// value itself is left out so the report can be shared and logged.
+type RedactedValue struct {
+	Detector    string `json:"detector"`
+	Replacement string `json:"replacement"`
+	Count       int    `json:"count"`
+	Lines       []int  `json:"lines,omitempty"` // lines in content.md
+}
+
+// newRedactor builds a redactor from the config. An empty detector list
+// runs every built-in detector.
+func newRedactor(cfg RedactConfig) (*redactor, error) {
+	rd := &redactor{
+		masks:  make(map[string]string),
+		next:   make(map[string]int),
+		items:  make(map[string]*RedactedValue),
+		report: &RedactionReport{Counts: make(map[string]int), Items: []*RedactedValue{}},
+	}
+	for i, rule := range cfg.Rules {
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("redact rule %q: %w", rule.Pattern, err)
+		}
+		if re.MatchString("") {
+			return nil, fmt.Errorf("redact rule %q matches empty text, which would mask every position", rule.Pattern)
+		}
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("rule%d", i+1)
+		}
+		replace := rule.Replace
+		rd.detectors = append(rd.detectors, redactDetector{
+			name: name,
+			re:   re,
+			mask: func(v string, n int) string {
+				if replace == "" {
+					return fmt.Sprintf("[%s-%d]", name, n)
+				}
+				return string(re.ExpandString(nil, replace, v, re.FindStringSubmatchIndex(v)))
+			},
+		})
+	}
+	names := cfg.Detectors
+	if len(names) == 0 {
+		names = redactDetectorNames
+	}
+	for _, name := range names {
+		d, ok := builtinRedactors[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown detector %q (choose from %s)", name, strings.Join(redactDetectorNames, ", "))
+		}
+		rd.detectors = append(rd.detectors, d)
+	}
+	return rd, nil
+}
+
+// reImageRef matches image paths, which are left alone so pictures still
+// resolve
+var reImageRef = regexp.MustCompile(`images/[^\s)"'\]]+`)
+
+// redact masks the text of one file. Lines are recorded for content.md.
+func (rd *redactor) redact(text string, lines bool) string {
+	for _, d := range rd.detectors {
+		protected := reImageRef.FindAllStringIndex(text, -1)
+		var sb strings.Builder
+		last := 0
+		for _, loc := range d.re.FindAllStringSubmatchIndex(text, -1) {
+			start, end := loc[2*d.group], loc[2*d.group+1]
+			if start < 0 || start < last || overlaps(protected, start, end) {
+				continue
+			}
+			value := text[start:end]
+			if d.skip != nil && d.skip(value) {
+				continue
+			}
+			mask := rd.maskFor(d, value)
+			if mask == value {
+				continue
+			}
+			item := rd.items[d.name+"\x00"+value]
+			item.Count++
+			rd.report.Total++
+			rd.report.Counts[d.name]++
+			if lines {
+				line := strings.Count(text[:start], "\n") + 1
+				if len(item.Lines) == 0 || item.Lines[len(item.Lines)-1] != line {
+					item.Lines = append(item.Lines, line)
+				}
+			}
+			sb.WriteString(text[last:start])
+			sb.WriteString(mask)
+			last = end
+		}
+		sb.WriteString(text[last:])
+		text = sb.String()
+	}
+	return text
+}
+
+// maskFor returns the stand-in for a value, numbering new values in the
+// order they are first seen
+func (rd *redactor) maskFor(d redactDetector, value string) string {
+	key := d.name + "\x00" + value
+	if m, ok := rd.masks[key]; ok {
+		return m
+	}
+	rd.next[d.name]++
+	m := d.mask(value, rd.next[d.name])
+	rd.masks[key] = m
+	item := &RedactedValue{Detector: d.name, Replacement: m}
+	rd.items[key] = item
+	rd.report.Items = append(rd.report.Items, item)
+	return m
+}
+
+func overlaps(ranges [][]int, start, end int) bool {
+	for _, r := range ranges {
+		if start < r[1] && r[0] < end {
+			return true
+		}
+	}
+	return false
+}
+
+// redactContent masks the markdown and source URL of a loaded export
+func (rd *redactor) redactContent(content *Content) *Content {
+	out := *content
+	out.Markdown = rd.redact(content.Markdown, true)
+	out.SourceURL = rd.redact(content.SourceURL, false)
+	rd.finish(content.TarFile)
+	return &out
+}
+
+// finish drops values no detector ended up masking and sorts the report
+func (rd *redactor) finish(file string) {
+	rd.report.File = file
+	kept := rd.report.Items[:0]
+	for _, item := range rd.report.Items {
+		if item.Count > 0 {
+			kept = append(kept, item)
+		}
+	}
+	rd.report.Items = kept
+	order := make(map[string]int)
+	for i, d := range rd.detectors {
+		order[d.name] = i
+	}
+	sort.SliceStable(rd.report.Items, func(i, j int) bool {
+		return order[rd.report.Items[i].Detector] < order[rd.report.Items[j].Detector]
+	})
+}
+
+// writeRedactedTar copies an export archive with every text file masked,
+// including the page text sampled in automation-types.json. Images are
+// copied unchanged.
+func (rd *redactor) writeRedactedTar(src string, w io.Writer) error {
+	err := rewriteTar(src, w, func(name string, data []byte) []byte {
+		return []byte(rd.redact(string(data), name == "content.md"))
+	})
+	if err != nil {
+		return err
+	}
+	rd.finish(filepath.Base(src))
+	return nil
+}
+
+// redactedName names the redacted copy of an export
+func redactedName(tarFile string) string {
+	return strings.TrimSuffix(tarFile, ".tar") + " (redacted).tar"
+}
+
+// handleRedact reports what redaction would mask in the loaded page, or
+// with ?download=1 serves the redacted archive
+func handleRedact(w http.ResponseWriter, r *http.Request) {
+	contentMu.RLock()
+	content := currentContent
+	contentMu.RUnlock()
+
+	if content == nil {
+		http.Error(w, "No content loaded", 404)
+		return
+	}
+	rd, err := newRedactor(globalConfig.Redact)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	if r.URL.Query().Get("download") != "" {
+		var buf bytes.Buffer
+		if err := rd.writeRedactedTar(content.TarPath, &buf); err != nil {
+			http.Error(w, fmt.Sprintf("Redaction failed: %v", err), 500)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-tar")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, redactedName(content.TarFile)))
+		w.Header().Set("X-Redactions", strconv.Itoa(rd.report.Total))
+		w.Write(buf.Bytes())
+		return
+	}
+
+	rd.redactContent(content)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rd.report)
+}
+
+// redactForPreview masks the page for /content and /raw when the preview
+// asks with ?redact=1, setting X-Redactions on h to the number masked
+func redactForPreview(h http.Header, r *http.Request, content *Content) *Content {
+	if r.URL.Query().Get("redact") == "" {
+		return content
+	}
+	rd, err := newRedactor(globalConfig.Redact)
+	if err != nil {
+		slog.Warn(err.Error())
+		return content
+	}
+	masked := rd.redactContent(content)
+	h.Set("X-Redactions", strconv.Itoa(rd.report.Total))
+	return masked
+}
+
+// previewKey names the cached /content or /raw body for a request, which
+// differs when ?redact=1 masks it
+func previewKey(route string, r *http.Request) string {
+	if r.URL.Query().Get("redact") != "" {
+		return route + "?redact"
+	}
+	return route
+}
+
+func runRedact(args []string) error {
+	cfg := loadConfig().Redact
+
+	fs := newFlagSet("redact")
+	out := fs.String("out", "", "Redacted archive (default: \"<name> (redacted).tar\" beside the original)")
+	reportFile := fs.String("report", "", "Write the report to this file instead of stdout")
+	detectors := fs.String("detectors", strings.Join(cfg.Detectors, ","), "Built-in detectors to run: "+strings.Join(redactDetectorNames, ", ")+" (default: all)")
+	var rules stringList
+	fs.Var(&rules, "rule", "Extra pattern as name=regexp (repeatable)")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected one tar file")
+	}
+	for _, r := range rules {
+		name, pattern, ok := strings.Cut(r, "=")
+		if !ok || pattern == "" {
+			return fmt.Errorf("--rule expects name=regexp, got %q", r)
+		}
+		cfg.Rules = append(cfg.Rules, RedactRule{Name: name, Pattern: pattern})
+	}
+	cfg.Detectors = splitList(*detectors)
+	rd, err := newRedactor(cfg)
+	if err != nil {
+		return err
+	}
+
+	src := expandHome(positional[0])
+	dst := expandHome(*out)
+	if dst == "" {
+		dst = filepath.Join(filepath.Dir(src), redactedName(filepath.Base(src)))
+	}
+	if abs, _ := filepath.Abs(dst); abs == mustAbs(src) {
+		return fmt.Errorf("refusing to overwrite the original export")
+	}
+	var buf bytes.Buffer
+	if err := rd.writeRedactedTar(src, &buf); err != nil {
+		return err
+	}
+	if err := os.WriteFile(dst, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("write %s: %w", dst, err)
+	}
+
+	report, err := json.MarshalIndent(rd.report, "", "  ")
+	if err != nil {
+		return err
+	}
+	successStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#10B981")).Bold(true)
+	pathStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#FBBF24"))
+	if *reportFile == "" {
+		fmt.Println(string(report))
+	} else if err := os.WriteFile(expandHome(*reportFile), append(report, '\n'), 0644); err != nil {
+		return fmt.Errorf("write %s: %w", *reportFile, err)
+	}
+	fmt.Fprintf(os.Stderr, "%s %s\n", successStyle.Render(fmt.Sprintf("✓ Masked %d %s into", rd.report.Total, plural(rd.report.Total, "value", "values"))), pathStyle.Render(dst))
+	return nil
+}
+
+func mustAbs(p string) string {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return p
+	}
+	return abs
+}
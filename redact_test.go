@@ -0,0 +1,215 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRedactDetectors(t *testing.T) {
+	tests := []struct {
+		name      string
+		detectors []string
+		in, want  string
+	}{
+		{
+			name:      "email",
+			detectors: []string{"email"},
+			in:        "Ask john.doe@contoso.com or jane@contoso.co.uk.",
+			want:      "Ask person1@redacted.invalid or person2@redacted.invalid.",
+		},
+		{
+			name:      "email repeated keeps its number",
+			detectors: []string{"email"},
+			in:        "a@contoso.com, b@contoso.com, a@contoso.com",
+			want:      "person1@redacted.invalid, person2@redacted.invalid, person1@redacted.invalid",
+		},
+		{
+			name:      "email percent-encoded",
+			detectors: []string{"email"},
+			in:        "[mail](mailto%3Ajohn%40contoso.com)",
+			want:      "[mail](mailto%3Aperson1%40redacted.invalid)",
+		},
+		{
+			name:      "email double-encoded",
+			detectors: []string{"email"},
+			in:        "?url=mailto%253Ajohn%2540contoso.com%26x%3D1",
+			want:      "?url=mailto%253Aperson1%2540redacted.invalid%26x%3D1",
+		},
+		{
+			name:      "email needs a whole TLD",
+			detectors: []string{"email"},
+			in:        "build@ci.example.com2",
+			want:      "build@ci.example.com2",
+		},
+		{
+			name:      "teams channel ID is not an email",
+			detectors: []string{"email"},
+			in:        "https://teams.microsoft.com/l/channel/19%3A3a10724f969043c3aab0d68a939500d1%40thread.tacv2/Copilot%20CLI",
+			want:      "https://teams.microsoft.com/l/channel/19%3A3a10724f969043c3aab0d68a939500d1%40thread.tacv2/Copilot%20CLI",
+		},
+		{
+			name:      "teams channel ID masked by guid",
+			detectors: nil,
+			in:        "https://teams.microsoft.com/l/channel/19%3A3a10724f969043c3aab0d68a939500d1%40thread.tacv2/Copilot%20CLI",
+			want:      "https://teams.microsoft.com/l/channel/19%3A00000000000000000000000000000001%40thread.tacv2/Copilot%20CLI",
+		},
+		{
+			name:      "teams chat ID double-encoded",
+			detectors: []string{"email"},
+			in:        "url=https%3A%2F%2Fteams.microsoft.com%2Fl%2Fchannel%2F19%253AKohb9AeZ-osLhXk8Xf3Ce41%2540thread.tacv2%2FPilot",
+			want:      "url=https%3A%2F%2Fteams.microsoft.com%2Fl%2Fchannel%2F19%253AKohb9AeZ-osLhXk8Xf3Ce41%2540thread.tacv2%2FPilot",
+		},
+		{
+			name:      "guid",
+			detectors: []string{"guid"},
+			in:        "tenant 72f988bf-86f1-41af-91ab-2d7cd011db47 and {294164CF-41AC-43CD-B4B7-8A1FE0B441F7}",
+			want:      "tenant 00000000-0000-0000-0000-000000000001 and {00000000-0000-0000-0000-000000000002}",
+		},
+		{
+			name:      "guid percent-encoded",
+			detectors: []string{"guid"},
+			in:        "groupId%3D294164cf-41ac-43cd-b4b7-8a1fe0b441f7%26tenantId%3D72f988bf86f141af91ab2d7cd011db47",
+			want:      "groupId%3D00000000-0000-0000-0000-000000000001%26tenantId%3D00000000000000000000000000000002",
+		},
+		{
+			name:      "url token",
+			detectors: []string{"token"},
+			in:        "https://example.com/cb?code=abc123&state=xyz&page=2",
+			want:      "https://example.com/cb?code=REDACTED&state=REDACTED&page=2",
+		},
+		{
+			name:      "url token in escaped markdown",
+			detectors: []string{"token"},
+			in:        `[x](https://example.com/?a=1\&sig=s3cr3t%2Bx)`,
+			want:      `[x](https://example.com/?a=1\&sig=REDACTED)`,
+		},
+		{
+			name:      "safelinks data",
+			detectors: nil,
+			in:        `https://nam06.safelinks.protection.outlook.com/?url=https%3A%2F%2Fexample.com%2Fnews\&data=05%7C02%7Cjohn%40contoso.com%7C023abed7%7C0&reserved=0`,
+			want:      `https://nam06.safelinks.protection.outlook.com/?url=https%3A%2F%2Fexample.com%2Fnews\&data=REDACTED&reserved=0`,
+		},
+		{
+			name:      "safelinks wrapped address",
+			detectors: nil,
+			in:        `https://nam06.safelinks.protection.outlook.com/?url=mailto%3Ajohn%40contoso.com\&data=05%7C02`,
+			want:      `https://nam06.safelinks.protection.outlook.com/?url=mailto%3Aperson1%40redacted.invalid\&data=REDACTED`,
+		},
+		{
+			name:      "ipv4",
+			detectors: []string{"ip"},
+			in:        "hosts 10.0.0.12 and 172.16.4.1, not 999.1.1.1 or version 1.2.3",
+			want:      "hosts 192.0.2.1 and 192.0.2.2, not 999.1.1.1 or version 1.2.3",
+		},
+		{
+			name:      "ipv6",
+			detectors: []string{"ip"},
+			in:        "via fe80:0:0:0:0202:b3ff:fe1e:8329",
+			want:      "via 2001:db8::1",
+		},
+		{
+			name:      "image paths are left alone",
+			detectors: nil,
+			in:        "![diagram](images/3a10724f969043c3aab0d68a939500d1.png)",
+			want:      "![diagram](images/3a10724f969043c3aab0d68a939500d1.png)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rd, err := newRedactor(RedactConfig{Detectors: tt.detectors})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := rd.redact(tt.in, false); got != tt.want {
+				t.Errorf("redact(%q)\n got %q\nwant %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactRules(t *testing.T) {
+	rd, err := newRedactor(RedactConfig{
+		Detectors: []string{"email"},
+		Rules: []RedactRule{
+			{Name: "ticket", Pattern: `INC\d+`},
+			{Pattern: `(project) (\w+)`, Replace: "$1 X"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := rd.redact("INC123 and INC456 in project Falcon, INC123 again", false)
+	want := "[ticket-1] and [ticket-2] in project X, [ticket-1] again"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if _, err := newRedactor(RedactConfig{Detectors: []string{"phone"}}); err == nil {
+		t.Error("unknown detector accepted")
+	}
+	for _, pattern := range []string{`a*`, `(x)?`, `^`} {
+		if _, err := newRedactor(RedactConfig{Rules: []RedactRule{{Pattern: pattern}}}); err == nil {
+			t.Errorf("rule %q matching empty text accepted", pattern)
+		}
+	}
+}
+
+func TestWriteRedactedTar(t *testing.T) {
+	files := []struct{ name, body string }{
+		{"content.md", "Contact jane.doe@contoso.com\n"},
+		{"metadata.json", `{"url":"https://contoso.sharepoint.com/?owner=jane.doe@contoso.com"}`},
+		{"automation-types.json", `{"samples":[{"text":"jane.doe@contoso.com 10.1.2.3"}]}`},
+		{"images/a.png", "jane.doe@contoso.com"},
+	}
+	var src bytes.Buffer
+	tw := tar.NewWriter(&src)
+	for _, f := range files {
+		tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.body)), Typeflag: tar.TypeReg})
+		tw.Write([]byte(f.body))
+	}
+	tw.Close()
+	path := filepath.Join(t.TempDir(), "page.tar")
+	if err := os.WriteFile(path, src.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rd, err := newRedactor(RedactConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := rd.writeRedactedTar(path, &out); err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(&out)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(tr)
+		leaked := strings.Contains(string(data), "jane.doe") || strings.Contains(string(data), "10.1.2.3")
+		if hdr.Name == "images/a.png" {
+			if string(data) != files[3].body {
+				t.Errorf("image changed: %q", data)
+			}
+		} else if leaked {
+			t.Errorf("%s not redacted: %s", hdr.Name, data)
+		}
+	}
+	report, err := json.Marshal(rd.report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(report), "jane.doe") || strings.Contains(string(report), "10.1.2.3") {
+		t.Errorf("report repeats a masked value: %s", report)
+	}
+}
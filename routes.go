@@ -0,0 +1,376 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// ============================================================
+// Route Registry
+// ============================================================
+//
+// Every preview server route is declared once in serverRoutes. The same
+// list registers the handlers on the mux, backs /api/routes, and is
+// turned into the OpenAPI 3 document at /api/openapi.json that the
+// explorer page at /api/explorer reads, so the three cannot drift apart.
+
+// route is one endpoint of the preview server
+type route struct {
+	Pattern string // ServeMux pattern; a trailing slash matches the subtree
+	Path    string // OpenAPI path for subtree patterns, e.g. /images/{name}
+	Handler http.HandlerFunc
+	Summary string
+	Tag     string       // groups routes in the document and explorer
+	Methods []string     // GET when empty
+	Params  []routeParam // query and path parameters
+	Body    string       // JSON request body accepted by POST, if any
+	Type    string       // content type of a successful response
+	Public  bool         // served without the session token, CORS checks or limits
+	Heavy   bool         // expensive enough to cap how many run at once
+}
+
+// routeParam is a query or path parameter of a route
+type routeParam struct {
+	Name        string
+	In          string // query or path
+	Description string
+	Enum        []string
+	Repeated    bool // a query parameter that may be given more than once
+}
+
+func queryParam(name, description string, enum ...string) routeParam {
+	return routeParam{Name: name, In: "query", Description: description, Enum: enum}
+}
+
+func pathParam(name, description string, enum ...string) routeParam {
+	return routeParam{Name: name, In: "path", Description: description, Enum: enum}
+}
+
+// repeatedParam is a query parameter that may be given more than once
+func repeatedParam(name, description string) routeParam {
+	return routeParam{Name: name, In: "query", Description: description, Repeated: true}
+}
+
+const (
+	typeHTML     = "text/html"
+	typeJSON     = "application/json"
+	typeText     = "text/plain"
+	typeTar      = "application/x-tar"
+	typeAny      = "*/*"
+	typeJS       = "application/javascript"
+	typeMarkdown = "text/markdown"
+)
+
+// serverRoutes lists the preview server's routes in the order they are
+// documented
+func serverRoutes() []route {
+	redact := queryParam("redact", "Mask sensitive text with the redaction rules (1)")
+	download := queryParam("download", "Serve as a file download (1)")
+	files := repeatedParam("file", "Export in the watch directory to read instead of the loaded page")
+
+	formats := make([]string, 0, len(exportFormats))
+	for name := range exportFormats {
+		formats = append(formats, name)
+	}
+	sort.Strings(formats)
+
+	return []route{
+		// Pages
+		{Pattern: "/", Handler: handleIndex, Tag: "pages", Type: typeHTML, Summary: "Landing page with instructions"},
+		{Pattern: "/minimal", Handler: handleMinimal, Tag: "pages", Type: typeHTML, Summary: "Dark mode preview"},
+		{Pattern: "/github", Handler: handleGithub, Tag: "pages", Type: typeHTML, Summary: "GitHub file browser style"},
+		{Pattern: "/vignelli", Handler: handleVignelli, Tag: "pages", Type: typeHTML, Summary: "Typography focused"},
+		{Pattern: "/t/", Path: "/t/{name}", Handler: handleCustomTemplate, Tag: "pages", Type: typeHTML,
+			Summary: "Custom template from the config directory (/t/ lists them)",
+			Params:  []routeParam{pathParam("name", "Template name")}},
+		{Pattern: "/a11y", Handler: handleA11yPage, Tag: "pages", Type: typeHTML, Summary: "Alt text editor for the loaded page's images"},
+		{Pattern: "/api/explorer", Handler: handleAPIExplorer, Tag: "pages", Type: typeHTML, Summary: "Browse and try this API"},
+
+		// Content
+		{Pattern: "/content", Handler: handleContent, Tag: "content", Type: typeMarkdown,
+			Summary: "Markdown with images inlined as data URLs", Params: []routeParam{redact}},
+		{Pattern: "/raw", Handler: handleRaw, Tag: "content", Type: typeMarkdown,
+			Summary: "Raw markdown with images linked under /images/", Params: []routeParam{redact}},
+		{Pattern: "/images/", Path: "/images/{name}", Handler: handleImages, Tag: "content", Type: "image/*",
+			Summary: "Image from the loaded page (/images/ lists them)",
+			Params:  []routeParam{pathParam("name", "Image file name")}},
+		{Pattern: "/api/tar", Handler: handleTarDownload, Tag: "content", Type: typeTar, Summary: "Download loaded tar file"},
+		{Pattern: "/loopd.js", Handler: handleLoopdJS, Tag: "content", Type: typeJS, Summary: "Export script for clipboard"},
+		{Pattern: "/plugins/", Path: "/plugins/{file}", Handler: handlePlugins, Tag: "content", Type: typeAny,
+			Summary: "Plugin file installed beside the loopd binary",
+			Params:  []routeParam{pathParam("file", "Path inside the plugins directory")}},
+
+		// Export
+		{Pattern: "/api/export/", Path: "/api/export/{format}", Handler: handleExport, Heavy: true, Tag: "export", Type: typeAny,
+			Summary: "Loaded page, or exports from the library bound as a book, in another format",
+			Params: []routeParam{
+				pathParam("format", "Export format", formats...),
+				download,
+				queryParam("toc", "Include a table of contents where the format has one (1)"),
+				files,
+				queryParam("title", "Book title when binding several exports"),
+			}},
+		{Pattern: "/api/tables", Handler: handleTables, Heavy: true, Tag: "export", Type: typeJSON, Summary: "Tables in the loaded page"},
+		{Pattern: "/api/tables/", Path: "/api/tables/{table}", Handler: handleTables, Heavy: true, Tag: "export", Type: typeAny,
+			Summary: "One table as CSV or JSON",
+			Params:  []routeParam{pathParam("table", "Table number and format, e.g. 1.csv or 1.json")}},
+		{Pattern: "/api/tasks", Handler: handleTasks, Heavy: true, Tag: "export", Type: typeAny,
+			Summary: "Checklist items in the loaded page",
+			Params: []routeParam{
+				queryParam("format", "Output format", "json", "todo", "ics"),
+				queryParam("status", "Which tasks", "open", "done", "all"),
+				download,
+				files,
+			}},
+
+		// Inspect
+		{Pattern: "/api/links", Handler: handleLinks, Tag: "inspect", Type: typeJSON,
+			Summary: "Links in the loaded page with their location, SafeLinks unwrapped"},
+		{Pattern: "/api/links/check", Handler: handleLinkCheck, Heavy: true, Tag: "inspect", Type: typeJSON,
+			Summary: "Broken anchors, images and links in the loaded page",
+			Params:  []routeParam{queryParam("all", "Report every link, not only broken ones (1)")}},
+		{Pattern: "/api/redact", Handler: handleRedact, Heavy: true, Tag: "inspect", Type: typeJSON,
+			Summary: "What redaction masks in the loaded page",
+			Params:  []routeParam{queryParam("download", "Serve the redacted tar instead (1)")}},
+		{Pattern: "/api/lint", Handler: handleLint, Tag: "inspect", Type: typeJSON, Summary: "Lint issues left in the loaded page after cleanup"},
+		{Pattern: "/api/a11y", Handler: handleA11y, Heavy: true, Tag: "inspect", Type: typeJSON, Methods: []string{"GET", "POST"},
+			Summary: "Images with alt text and context, heading order (POST alt text to save a copy)",
+			Params:  []routeParam{queryParam("to", "Where POST saves the copy", "tar", "folder", "download")},
+			Body:    `{"alt": {"<image url>": "<alt text>"}}`},
+		{Pattern: "/api/diagnostics", Handler: handleDiagnostics, Heavy: true, Tag: "inspect", Type: typeJSON,
+			Summary: "Loop components across exports the converter drops",
+			Params:  []routeParam{queryParam("loaded", "Only the loaded page (1)")}},
+
+		// Server
+		{Pattern: "/api/status", Handler: handleStatus, Tag: "server", Type: typeJSON, Summary: "Server status JSON"},
+		{Pattern: "/api/library", Handler: handleLibrary, Tag: "server", Type: typeJSON, Summary: "Exports in the watch directory"},
+		{Pattern: "/api/routes", Handler: handleAPIRoutes, Tag: "server", Type: typeJSON, Summary: "Routes and their descriptions"},
+		{Pattern: "/api/openapi.json", Handler: handleOpenAPI, Tag: "server", Type: typeJSON, Summary: "OpenAPI 3 description of this API"},
+		{Pattern: "/api/open", Handler: handleAPIOpen, Tag: "server", Type: typeJSON, Summary: "Open the preview in the browser"},
+		{Pattern: "/api/figma-detect", Handler: handleFigmaDetect, Tag: "server", Type: typeJSON, Summary: "Figma desktop and MCP server detection"},
+		{Pattern: "/metrics", Handler: handleMetrics, Tag: "server", Type: typeText, Summary: "Prometheus metrics: loads, requests, watcher events"},
+		{Pattern: "/healthz", Handler: handleHealthz, Tag: "server", Type: typeText, Public: true, Summary: "Liveness check"},
+		{Pattern: "/readyz", Handler: handleReadyz, Tag: "server", Type: typeText, Public: true,
+			Summary: "Readiness check: watcher running, not shutting down"},
+	}
+}
+
+// registerRoutes adds every route to mux, behind the CORS check, the
+// request limits and the token check unless the route is public. The
+// limits sit inside the CORS handler so cross-origin callers can read a
+// 429, and before the token check so failed and guessed tokens count.
+func registerRoutes(mux *http.ServeMux, limits *limiter) {
+	for _, rt := range serverRoutes() {
+		if rt.Public {
+			mux.HandleFunc(rt.Pattern, rt.Handler)
+			continue
+		}
+		handler := rt.Handler
+		if rt.Heavy {
+			handler = limits.limitHeavy(handler)
+		}
+		mux.HandleFunc(rt.Pattern, corsHandler(limits.limitRequests(requireToken(handler))))
+	}
+}
+
+// requestBase is the scheme and host a request reached the server on
+func requestBase(r *http.Request) string {
+	host := r.Host
+	if host == "" {
+		host = "localhost:8080"
+	}
+	return fmt.Sprintf("%s://%s", urlScheme, host)
+}
+
+// handleAPIRoutes returns available routes
+func handleAPIRoutes(w http.ResponseWriter, r *http.Request) {
+	routes := map[string]string{}
+	for _, rt := range serverRoutes() {
+		summary := rt.Summary
+		var params []string
+		for _, p := range rt.Params {
+			if p.In == "query" {
+				params = append(params, "?"+p.Name+"=")
+			}
+		}
+		if len(params) > 0 {
+			summary += " (" + strings.Join(params, ", ") + ")"
+		}
+		if rt.Public {
+			summary += " (no token needed)"
+		}
+		routes[rt.Pattern] = summary
+		// list each value of an enumerated path parameter, e.g. every
+		// export format
+		for _, p := range rt.Params {
+			for _, v := range p.Enum {
+				if p.In == "path" {
+					routes[strings.Replace(rt.Path, "{"+p.Name+"}", v, 1)] = summary
+				}
+			}
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"base":   requestBase(r),
+		"routes": routes,
+	})
+}
+
+// ------------------------------------------------------------
+// OpenAPI
+// ------------------------------------------------------------
+
+// openAPIDocument describes the routes as an OpenAPI 3.0 document served
+// from base
+func openAPIDocument(routes []route, base string) map[string]any {
+	paths := map[string]any{}
+	for _, rt := range routes {
+		path := rt.Path
+		if path == "" {
+			path = rt.Pattern
+		}
+		methods := rt.Methods
+		if len(methods) == 0 {
+			methods = []string{"GET"}
+		}
+		item := map[string]any{}
+		for _, method := range methods {
+			item[strings.ToLower(method)] = openAPIOperation(rt, path, method)
+		}
+		paths[path] = item
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       appName,
+			"version":     version,
+			"description": "Preview server for Microsoft Loop exports. Every route except the health checks needs the session token printed with the preview URL.",
+		},
+		"servers": []map[string]any{{"url": base}},
+		"tags": []map[string]any{
+			{"name": "pages", "description": "HTML pages"},
+			{"name": "content", "description": "The loaded export as served to templates and plugins"},
+			{"name": "export", "description": "The loaded export in other formats"},
+			{"name": "inspect", "description": "Reports on the loaded export"},
+			{"name": "server", "description": "Server state and operations"},
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"securitySchemes": map[string]any{
+				"bearer": map[string]any{"type": "http", "scheme": "bearer"},
+				"header": map[string]any{"type": "apiKey", "in": "header", "name": tokenHeader},
+				"query":  map[string]any{"type": "apiKey", "in": "query", "name": "token"},
+				"cookie": map[string]any{"type": "apiKey", "in": "cookie", "name": tokenCookie},
+			},
+		},
+		"security": []map[string]any{
+			{"bearer": []string{}}, {"header": []string{}}, {"query": []string{}}, {"cookie": []string{}},
+		},
+	}
+}
+
+// openAPIOperation describes one method of a route
+func openAPIOperation(rt route, path, method string) map[string]any {
+	op := map[string]any{
+		"summary":     rt.Summary,
+		"operationId": operationID(method, path),
+		"tags":        []string{rt.Tag},
+	}
+
+	var params []map[string]any
+	for _, p := range rt.Params {
+		schema := map[string]any{"type": "string"}
+		if len(p.Enum) > 0 {
+			schema["enum"] = p.Enum
+		}
+		if p.Repeated {
+			schema = map[string]any{"type": "array", "items": schema}
+		}
+		params = append(params, map[string]any{
+			"name":        p.Name,
+			"in":          p.In,
+			"required":    p.In == "path",
+			"description": p.Description,
+			"schema":      schema,
+		})
+	}
+	if len(params) > 0 {
+		op["parameters"] = params
+	}
+
+	if method == "POST" && rt.Body != "" {
+		op["requestBody"] = map[string]any{
+			"required":    true,
+			"description": rt.Body,
+			"content":     map[string]any{typeJSON: map[string]any{"schema": map[string]any{"type": "object"}}},
+		}
+	}
+
+	responses := map[string]any{
+		"200": map[string]any{
+			"description": "OK",
+			"content":     map[string]any{rt.Type: map[string]any{}},
+		},
+	}
+	if rt.Public {
+		op["security"] = []map[string]any{}
+	} else {
+		responses["401"] = map[string]any{"description": "Missing or wrong session token"}
+		responses["403"] = map[string]any{"description": "Origin not allowed"}
+		responses["429"] = map[string]any{"description": "Over the request rate, or too many heavy operations running; see Retry-After"}
+		if method == "POST" {
+			responses["413"] = map[string]any{"description": "Request body too large"}
+		}
+	}
+	op["responses"] = responses
+	return op
+}
+
+// operationID names an operation after its method and path, e.g.
+// getApiLinksCheck
+func operationID(method, path string) string {
+	id := strings.ToLower(method)
+	for _, word := range strings.FieldsFunc(path, func(r rune) bool {
+		return strings.ContainsRune("/-.{}", r)
+	}) {
+		id += strings.ToUpper(word[:1]) + word[1:]
+	}
+	if path == "/" {
+		id += "Index"
+	}
+	return id
+}
+
+// handleOpenAPI serves the OpenAPI document for the host the request
+// reached
+func handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(openAPIDocument(serverRoutes(), requestBase(r)))
+}
+
+// handleAPIExplorer serves a page that lists the OpenAPI operations and
+// sends requests to them
+func handleAPIExplorer(w http.ResponseWriter, r *http.Request) {
+	tmplData, err := templates.ReadFile("templates/explorer.html")
+	if err != nil {
+		http.Error(w, "Template not found", 500)
+		return
+	}
+
+	tmpl, err := template.New("explorer").Parse(string(tmplData))
+	if err != nil {
+		http.Error(w, "Template parse error", 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	tmpl.Execute(w, struct{ Version string }{version})
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ============================================================
+// reStructuredText Writer
+// ============================================================
+
+func init() {
+	exportFormats["rst"] = exportFormat{
+		ext:      ".rst",
+		mime:     "text/x-rst; charset=utf-8",
+		imageDir: "images",
+		render: func(doc *Document, _ exportOptions) ([]byte, error) {
+			return []byte(renderRST(doc)), nil
+		},
+	}
+}
+
+// rstAdornments are the section underline characters by level. The page
+// title uses "=" with an overline, which counts as a different style.
+var rstAdornments = []string{"=", "-", "~", "^", `"`, "'"}
+
+// renderRST renders a document as reStructuredText for Sphinx. The page
+// title becomes the document title and its heading is left out.
+func renderRST(doc *Document) string {
+	w := &rstWriter{title: titleNode(doc), subs: make(map[string]int)}
+	title := strings.ReplaceAll(doc.Title, "\n", " ")
+	rule := strings.Repeat("=", len(title))
+	out := rule + "\n" + title + "\n" + rule + "\n"
+	if body := w.blocks(doc.Root.Children); body != "" {
+		out += "\n" + body + "\n"
+	}
+	return out
+}
+
+type rstWriter struct {
+	title *Node
+	level int            // level of the last section, so depth jumps are closed up
+	subs  map[string]int // substitution names used for inline images
+	defs  []string       // substitution definitions pending for the current block
+}
+
+func (w *rstWriter) blocks(nodes []*Node) string {
+	var parts []string
+	for _, n := range nodes {
+		if s := w.block(n); s != "" {
+			parts = append(parts, s)
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+func (w *rstWriter) block(n *Node) string {
+	switch n.Type {
+	case "heading":
+		if n == w.title {
+			return ""
+		}
+		// reST assigns levels in order of appearance and rejects skipped
+		// levels, so h2 → h4 becomes two adjacent levels
+		level := min(max(n.Depth-1, 1), w.level+1, len(rstAdornments))
+		w.level = level
+		text := strings.ReplaceAll(w.inlines(n.Children, false), "\n", " ")
+		return text + "\n" + strings.Repeat(rstAdornments[level-1], len(text))
+
+	case "paragraph":
+		if len(n.Children) == 1 && n.Children[0].Type == "image" {
+			return rstImageDirective("image", n.Children[0])
+		}
+		text := w.inlines(n.Children, true)
+		if strings.HasSuffix(text, "::") {
+			// A trailing :: would turn the next block into a literal block
+			text = text[:len(text)-2] + `\::`
+		}
+		return w.flushDefs(text)
+
+	case "blockquote":
+		body := w.blocks(n.Children)
+		if n.Callout != "" {
+			return ".. " + strings.ToLower(n.Callout) + "::\n\n" + indentRST(body, "   ")
+		}
+		// The empty comment ends any preceding list so the indent reads as a quote
+		return "..\n\n" + indentRST(body, "   ")
+
+	case "list":
+		return w.list(n)
+
+	case "code":
+		if n.Value == "" {
+			return ""
+		}
+		lang := n.Lang
+		if lang == "" {
+			lang = "text"
+		}
+		return ".. code-block:: " + lang + "\n\n" + indentRST(n.Value, "   ")
+
+	case "table":
+		return w.table(n)
+
+	case "thematicBreak":
+		return "----"
+
+	case "html":
+		if strings.HasPrefix(strings.TrimSpace(n.Value), "<!--") {
+			return ""
+		}
+		return ".. raw:: html\n\n" + indentRST(n.Value, "   ")
+
+	default:
+		return w.flushDefs(w.inline(n).s)
+	}
+}
+
+// flushDefs appends substitution definitions collected while writing inline
+// images in a paragraph
+func (w *rstWriter) flushDefs(text string) string {
+	if len(w.defs) == 0 {
+		return text
+	}
+	text += "\n\n" + strings.Join(w.defs, "\n")
+	w.defs = nil
+	return text
+}
+
+func (w *rstWriter) list(n *Node) string {
+	num := n.Start
+	if num == 0 {
+		num = 1
+	}
+	loose := n.Spread
+	var items []string
+	for _, li := range n.Children {
+		marker := "-"
+		if n.Ordered {
+			marker = fmt.Sprintf("%d.", num)
+			num++
+		}
+		var parts []string
+		for _, c := range li.Children {
+			if s := w.block(c); s != "" {
+				parts = append(parts, s)
+			}
+		}
+		if len(parts) > 1 {
+			loose = true
+		}
+		body := strings.Join(parts, "\n\n")
+		if li.Checked != nil {
+			if *li.Checked {
+				body = "[x] " + body
+			} else {
+				body = "[ ] " + body
+			}
+		}
+		indent := strings.Repeat(" ", len(marker)+1)
+		items = append(items, marker+" "+strings.TrimPrefix(indentRST(body, indent), indent))
+	}
+	if loose {
+		return strings.Join(items, "\n\n")
+	}
+	return strings.Join(items, "\n")
+}
+
+// table writes a list-table, which unlike grid tables needs no column
+// alignment and takes any inline markup in its cells
+func (w *rstWriter) table(n *Node) string {
+	cols := len(n.Align)
+	for _, row := range n.Children {
+		cols = max(cols, len(row.Children))
+	}
+	var sb strings.Builder
+	sb.WriteString(".. list-table::\n   :header-rows: 1\n")
+	for _, row := range n.Children {
+		sb.WriteString("\n")
+		for c := 0; c < cols; c++ {
+			text := ""
+			if c < len(row.Children) {
+				text = strings.ReplaceAll(w.inlines(row.Children[c].Children, false), "\n", " ")
+			}
+			prefix := "     -"
+			if c == 0 {
+				prefix = "   * -"
+			}
+			if text != "" {
+				prefix += " " + text
+			}
+			sb.WriteString(prefix + "\n")
+		}
+	}
+	out := strings.TrimRight(sb.String(), "\n")
+	if len(w.defs) > 0 {
+		return w.flushDefs(out)
+	}
+	return out
+}
+
+// rstInline is a piece of inline output; markup pieces need whitespace or
+// punctuation around them to be recognized
+type rstInline struct {
+	s      string
+	markup bool
+}
+
+func (w *rstWriter) inlines(nodes []*Node, blockStart bool) string {
+	var parts []rstInline
+	for i, n := range nodes {
+		part := w.inline(n)
+		if n.Type == "text" {
+			part.s = escapeRSTText(part.s, blockStart && i == 0)
+		}
+		parts = append(parts, part)
+	}
+
+	var sb strings.Builder
+	for i, p := range parts {
+		if p.s == "" {
+			continue
+		}
+		if p.markup {
+			out := sb.String()
+			if last, _ := utf8.DecodeLastRuneInString(out); out != "" && !rstOpensMarkup(last) {
+				sb.WriteString(`\ `)
+			}
+		} else if i > 0 && parts[i-1].markup {
+			if first, _ := utf8.DecodeRuneInString(p.s); !rstClosesMarkup(first) {
+				sb.WriteString(`\ `)
+			}
+		}
+		sb.WriteString(p.s)
+	}
+	return strings.TrimRight(sb.String(), " \t")
+}
+
+func (w *rstWriter) inline(n *Node) rstInline {
+	switch n.Type {
+	case "text":
+		return rstInline{s: n.Value}
+	case "inlineCode":
+		if n.Value == "" {
+			return rstInline{}
+		}
+		return rstInline{s: "``" + n.Value + "``", markup: true}
+	case "strong":
+		return rstMarkup("**", nodeText(n))
+	case "emphasis":
+		return rstMarkup("*", nodeText(n))
+	case "break":
+		return rstInline{s: "\n"}
+	case "link":
+		text := strings.TrimSpace(nodeText(n))
+		if text == n.URL || "mailto:"+text == n.URL {
+			// Standalone URLs and addresses are linked automatically
+			return rstInline{s: text, markup: true}
+		}
+		if text == "" {
+			text = n.URL
+		}
+		text = strings.NewReplacer(`\`, `\\`, "`", "\\`", "<", `\<`).Replace(text)
+		return rstInline{s: "`" + text + " <" + n.URL + ">`__", markup: true}
+	case "image":
+		return rstInline{s: w.inlineImage(n), markup: true}
+	case "html":
+		if isBreakTag(n.Value) {
+			return rstInline{s: "\n"}
+		}
+		return rstInline{s: escapeRSTText(n.Value, false)}
+	default:
+		// reST inline markup cannot nest, so other nodes become text
+		var sb strings.Builder
+		for _, c := range n.Children {
+			if c.Type == "text" {
+				sb.WriteString(escapeRSTText(c.Value, false))
+			} else {
+				sb.WriteString(w.inline(c).s)
+			}
+		}
+		return rstInline{s: sb.String()}
+	}
+}
+
+// inlineImage writes a substitution reference and queues its definition
+func (w *rstWriter) inlineImage(n *Node) string {
+	name := strings.TrimSuffix(path.Base(n.URL), path.Ext(n.URL))
+	if name == "" || name == "." || name == "/" {
+		name = "image"
+	}
+	w.subs[name]++
+	if count := w.subs[name]; count > 1 {
+		name = fmt.Sprintf("%s-%d", name, count)
+	}
+	w.defs = append(w.defs, rstImageDirective("|"+name+"| image", n))
+	return "|" + name + "|"
+}
+
+// rstImageDirective writes an image directive with its alt text
+func rstImageDirective(directive string, n *Node) string {
+	out := ".. " + directive + ":: " + n.URL
+	if alt := strings.TrimSpace(strings.ReplaceAll(n.Alt, "\n", " ")); alt != "" {
+		out += "\n   :alt: " + alt
+	}
+	return out
+}
+
+// rstMarkup wraps text in an inline markup delimiter, keeping surrounding
+// spaces outside since the delimiters must hug the text
+func rstMarkup(delim, text string) rstInline {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		return rstInline{s: text}
+	}
+	escaped := strings.NewReplacer(`\`, `\\`, "*", `\*`, "`", "\\`").Replace(trimmed)
+	lead := text[:strings.Index(text, trimmed)]
+	trail := text[len(lead)+len(trimmed):]
+	if lead != "" || trail != "" {
+		return rstInline{s: lead + delim + escaped + delim + trail}
+	}
+	return rstInline{s: delim + escaped + delim, markup: true}
+}
+
+// rstOpensMarkup reports whether r may precede an inline markup start-string
+func rstOpensMarkup(r rune) bool {
+	return unicode.IsSpace(r) || strings.ContainsRune(`'"([{<-/:`, r)
+}
+
+// rstClosesMarkup reports whether r may follow an inline markup end-string
+func rstClosesMarkup(r rune) bool {
+	return unicode.IsSpace(r) || strings.ContainsRune(`'")]}>-/:.,;!?\`, r)
+}
+
+// reRSTLineStart matches line starts reST reads as lists, directives or
+// section adornments
+var reRSTLineStart = regexp.MustCompile(`^([-+*•] |\d+[.)] |#[.)] |\.\.|>|[=\-~^"'#*+:._]{4,}\s*$)`)
+
+// escapeRSTText backslash-escapes text. reST drops a backslash before any
+// character, so escaping is always safe.
+func escapeRSTText(s string, blockStart bool) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case '\\', '*', '`', '|':
+			sb.WriteByte('\\')
+		case '_':
+			// word_ and _word are references and targets
+			if !(i > 0 && isWordByte(s[i-1]) && i+1 < len(s) && isWordByte(s[i+1])) {
+				sb.WriteByte('\\')
+			}
+		}
+		sb.WriteByte(c)
+	}
+	lines := strings.Split(sb.String(), "\n")
+	for i, l := range lines {
+		if i == 0 && !blockStart {
+			continue
+		}
+		if reRSTLineStart.MatchString(l) {
+			lines[i] = `\` + l
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// indentRST indents every non-empty line
+func indentRST(s, indent string) string {
+	return prefixLines(s, indent, "")
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// ============================================================
+// Static Site Generation
+// ============================================================
+
+func init() {
+	subcommands["site"] = subcommand{
+		usage:   "<dir> --out <site>",
+		summary: "Render a folder of exports as a static HTML site",
+		run:     runSite,
+	}
+}
+
+// siteThemes are the built-in looks, named after the preview templates
+var siteThemes = []string{"github", "minimal", "vignelli"}
+
+// sitePage is one rendered export in a generated site
+type sitePage struct {
+	Title      string
+	Slug       string
+	URL        string // relative to the site root
+	Source     string // tar filename
+	Headings   []Heading
+	ImageCount int
+	Body       template.HTML
+	Prev, Next *sitePage
+	text       string
+	images     map[string]string
+}
+
+// siteData is passed to the site templates
+type siteData struct {
+	SiteTitle string
+	Theme     string
+	Version   string
+	Generated string
+	Root      string // path prefix from the current page to the site root
+	Pages     []*sitePage
+	Page      *sitePage // nil on the index page
+}
+
+// siteSearchEntry is one record in search-index.json
+type siteSearchEntry struct {
+	Title    string   `json:"title"`
+	URL      string   `json:"url"`
+	Headings []string `json:"headings"`
+	Text     string   `json:"text"`
+}
+
+func runSite(args []string) error {
+	fs := newFlagSet("site")
+	out := fs.String("out", "site", "Output directory")
+	title := fs.String("title", "Loop Pages", "Site title shown in the header and index")
+	theme := fs.String("theme", "github", "Built-in theme: "+strings.Join(siteThemes, ", "))
+	tmplPath := fs.String("template", "", "Custom template file defining \"index\" and \"page\"")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected one directory of exports")
+	}
+
+	tmpl, err := loadSiteTemplate(*tmplPath)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(siteThemes, *theme) {
+		return fmt.Errorf("unknown theme %q (choose from %s)", *theme, strings.Join(siteThemes, ", "))
+	}
+
+	outDir := expandHome(*out)
+	pages, err := buildSite(expandHome(positional[0]), outDir, tmpl, siteData{
+		SiteTitle: *title,
+		Theme:     *theme,
+		Version:   version,
+		Generated: time.Now().Format("2006-01-02 15:04"),
+	})
+	if err != nil {
+		return err
+	}
+
+	successStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#10B981")).Bold(true)
+	pathStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#FBBF24"))
+	fmt.Printf("%s %s\n", successStyle.Render(fmt.Sprintf("✓ Rendered %d %s to", pages, plural(pages, "page", "pages"))),
+		pathStyle.Render(filepath.Join(outDir, "index.html")))
+	return nil
+}
+
+// loadSiteTemplate parses the embedded site template or a custom file
+func loadSiteTemplate(path string) (*template.Template, error) {
+	var data []byte
+	var err error
+	if path == "" {
+		data, err = templates.ReadFile("templates/site.html")
+	} else {
+		data, err = os.ReadFile(expandHome(path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read template: %w", err)
+	}
+	tmpl, err := template.New("site").Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("parse template: %w", err)
+	}
+	for _, name := range []string{"index", "page"} {
+		if tmpl.Lookup(name) == nil {
+			return nil, fmt.Errorf("template must define %q", name)
+		}
+	}
+	return tmpl, nil
+}
+
+// buildSite renders every export in dir into outDir and returns the page count
+func buildSite(dir, outDir string, tmpl *template.Template, base siteData) (int, error) {
+	paths, err := listExports(dir)
+	if err != nil {
+		return 0, fmt.Errorf("list exports: %w", err)
+	}
+	if len(paths) == 0 {
+		return 0, fmt.Errorf("no .tar exports found in %s", dir)
+	}
+
+	var pages []*sitePage
+	slugs := newSlugger()
+	for _, path := range paths {
+		content, err := readTar(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Skipping %s: %v\n", filepath.Base(path), err)
+			continue
+		}
+		doc := newDocument(content)
+		slug := slugs.slug(doc.Title)
+		if slug == "" {
+			slug = slugs.slug("page")
+		}
+		pages = append(pages, &sitePage{
+			Title:      doc.Title,
+			Slug:       slug,
+			URL:        slug + "/index.html",
+			Source:     content.TarFile,
+			Headings:   doc.Headings,
+			ImageCount: len(content.Images),
+			Body:       template.HTML(renderHTML(doc.Root, htmlOptions{})),
+			text:       searchText(doc.Root),
+			images:     content.Images,
+		})
+	}
+	if len(pages) == 0 {
+		return 0, fmt.Errorf("no readable exports in %s", dir)
+	}
+
+	sort.SliceStable(pages, func(a, b int) bool {
+		return strings.ToLower(pages[a].Title) < strings.ToLower(pages[b].Title)
+	})
+	for i, p := range pages {
+		if i > 0 {
+			p.Prev = pages[i-1]
+		}
+		if i < len(pages)-1 {
+			p.Next = pages[i+1]
+		}
+	}
+
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return 0, fmt.Errorf("create output dir: %w", err)
+	}
+
+	base.Pages = pages
+	index := base
+	index.Root = ""
+	if err := writeTemplate(filepath.Join(outDir, "index.html"), tmpl, "index", index); err != nil {
+		return 0, err
+	}
+
+	var search []siteSearchEntry
+	for _, p := range pages {
+		pageDir := filepath.Join(outDir, p.Slug)
+		if err := writeImages(filepath.Join(pageDir, "images"), p.images); err != nil {
+			return 0, err
+		}
+		data := base
+		data.Root = "../"
+		data.Page = p
+		if err := writeTemplate(filepath.Join(pageDir, "index.html"), tmpl, "page", data); err != nil {
+			return 0, err
+		}
+
+		entry := siteSearchEntry{Title: p.Title, URL: p.URL, Text: p.text}
+		for _, h := range p.Headings {
+			entry.Headings = append(entry.Headings, h.Text)
+		}
+		search = append(search, entry)
+	}
+
+	// The index is written both as JSON for tools and as a script so
+	// search works when the site is opened from file://
+	indexJSON, err := json.Marshal(search)
+	if err != nil {
+		return 0, fmt.Errorf("marshal search index: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(outDir, "search-index.json"), indexJSON, 0644); err != nil {
+		return 0, fmt.Errorf("write search index: %w", err)
+	}
+	script := "window.LOOPD_SEARCH_INDEX = " + string(indexJSON) + ";\n"
+	if err := os.WriteFile(filepath.Join(outDir, "search-index.js"), []byte(script), 0644); err != nil {
+		return 0, fmt.Errorf("write search index: %w", err)
+	}
+
+	return len(pages), nil
+}
+
+// searchText is a page's text for the search index, block by block so
+// words at the end of one block and the start of the next stay apart
+func searchText(root *Node) string {
+	var blocks []string
+	walkNodes(root, func(n *Node) bool {
+		switch n.Type {
+		case "paragraph", "heading", "code", "tableCell":
+			if text := strings.Join(strings.Fields(nodeText(n)), " "); text != "" {
+				blocks = append(blocks, text)
+			}
+			return false
+		}
+		return true
+	})
+	return strings.Join(blocks, " ")
+}
+
+// writeTemplate executes a named template into a file
+func writeTemplate(path string, tmpl *template.Template, name string, data interface{}) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("create %s: %w", filepath.Dir(path), err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("create %s: %w", path, err)
+	}
+	defer f.Close()
+	if err := tmpl.ExecuteTemplate(f, name, data); err != nil {
+		return fmt.Errorf("render %s: %w", path, err)
+	}
+	return nil
+}
+
+// writeImages decodes an export's images into dir
+func writeImages(dir string, images map[string]string) error {
+	if len(images) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("create %s: %w", dir, err)
+	}
+	for name, dataURL := range images {
+		_, data, err := decodeDataURL(dataURL)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, filepath.Base(name)), data, 0644); err != nil {
+			return fmt.Errorf("write %s: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,387 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// ============================================================
+// Table Extraction
+// ============================================================
+//
+// Loop pages are often used as lightweight trackers, so their tables are
+// worth pulling out as data for spreadsheets and scripts.
+
+func init() {
+	subcommands["tables"] = subcommand{
+		usage:   "<tar> [--format csv|json]",
+		summary: "Extract a page's tables as CSV or JSON",
+		run:     runTables,
+	}
+}
+
+// ExtractedTable is a table pulled out of a page as plain text cells
+type ExtractedTable struct {
+	Index   int        `json:"index"`             // 1-based position in the page
+	Heading string     `json:"heading,omitempty"` // nearest heading above the table
+	Columns []string   `json:"columns,omitempty"` // nil when the table has no header row
+	Rows    [][]string `json:"rows"`
+}
+
+// extractTables finds every table in a document, including those nested
+// in lists and callouts
+func extractTables(root *Node) []ExtractedTable {
+	var tables []ExtractedTable
+	heading := ""
+	walkNodes(root, func(n *Node) bool {
+		switch n.Type {
+		case "heading":
+			heading = strings.TrimSpace(nodeText(n))
+			return false
+		case "table":
+			tables = append(tables, newExtractedTable(n, len(tables)+1, heading))
+			return false
+		}
+		return true
+	})
+	return tables
+}
+
+func newExtractedTable(n *Node, index int, heading string) ExtractedTable {
+	cols := len(n.Align)
+	for _, row := range n.Children {
+		cols = max(cols, len(row.Children))
+	}
+	var rows [][]string
+	for _, row := range n.Children {
+		cells := make([]string, cols)
+		for c := range cells {
+			if c < len(row.Children) {
+				cells[c] = cellText(row.Children[c])
+			}
+		}
+		rows = append(rows, cells)
+	}
+
+	t := ExtractedTable{Index: index, Heading: heading, Rows: [][]string{}}
+	if len(rows) == 0 {
+		return t
+	}
+	switch {
+	case isEmptyRow(rows[0]):
+		// Loop tables without a header export an empty one
+		rows = rows[1:]
+	case isHeaderRow(rows[0]):
+		t.Columns = columnNames(rows[0])
+		rows = rows[1:]
+	}
+	if rows != nil {
+		t.Rows = rows
+	}
+	return t
+}
+
+// cellText flattens a cell to plain text. Line breaks, including <br>
+// tags, separate lines; other whitespace collapses to single spaces.
+func cellText(cell *Node) string {
+	var sb strings.Builder
+	walkNodes(cell, func(c *Node) bool {
+		switch c.Type {
+		case "text", "inlineCode":
+			sb.WriteString(c.Value)
+		case "image":
+			if c.Alt != placeholderAlt {
+				sb.WriteString(c.Alt)
+			}
+		case "break":
+			sb.WriteString("\n")
+		case "html":
+			if isBreakTag(c.Value) {
+				sb.WriteString("\n")
+			}
+		}
+		return true
+	})
+	var lines []string
+	for _, line := range strings.Split(sb.String(), "\n") {
+		line = strings.Map(func(r rune) rune {
+			switch r {
+			case '\u00a0':
+				return ' '
+			case '\u200b', '\u200c', '\u200d', '\ufeff':
+				return -1
+			}
+			return r
+		}, line)
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func isEmptyRow(cells []string) bool {
+	for _, c := range cells {
+		if c != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// reDataCell matches cells that look like values rather than column names:
+// numbers, amounts, percentages and dates
+var reDataCell = regexp.MustCompile(`^[-+]?[$€£]?\d[\d,.]*%?$|^\d{1,4}[-/.]\d{1,2}[-/.]\d{1,4}$`)
+
+// isHeaderRow reports whether a table's first row names its columns.
+// Markdown tables always have a header row, but Loop tables without one
+// export their first data row there. Names are short, distinct and not
+// values, and most columns have one.
+func isHeaderRow(cells []string) bool {
+	seen := make(map[string]bool)
+	named := 0
+	for _, c := range cells {
+		if c == "" {
+			continue
+		}
+		key := strings.ToLower(c)
+		if seen[key] || len(c) > 80 || strings.Contains(c, "\n") || reDataCell.MatchString(c) {
+			return false
+		}
+		seen[key] = true
+		named++
+	}
+	return named*2 > len(cells)
+}
+
+// columnNames fills in missing header cells and makes names unique so
+// they can key JSON records
+func columnNames(header []string) []string {
+	names := make([]string, len(header))
+	used := make(map[string]int)
+	for i, h := range header {
+		if h == "" {
+			h = fmt.Sprintf("Column %d", i+1)
+		}
+		name := h
+		for n := used[strings.ToLower(h)]; n > 0; n++ {
+			name = fmt.Sprintf("%s (%d)", h, n+1)
+			if used[strings.ToLower(name)] == 0 {
+				break
+			}
+		}
+		used[strings.ToLower(h)]++
+		used[strings.ToLower(name)]++
+		names[i] = name
+	}
+	return names
+}
+
+// writeCSV writes the table with its column names as the first record
+func (t ExtractedTable) writeCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if t.Columns != nil {
+		if err := cw.Write(t.Columns); err != nil {
+			return err
+		}
+	}
+	if err := cw.WriteAll(t.Rows); err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+// tableJSON is the JSON download of one table. Records repeat the rows as
+// objects keyed by column name when the table has a header.
+type tableJSON struct {
+	ExtractedTable
+	Records []map[string]string `json:"records,omitempty"`
+}
+
+func (t ExtractedTable) toJSON() tableJSON {
+	out := tableJSON{ExtractedTable: t}
+	if t.Columns == nil {
+		return out
+	}
+	out.Records = []map[string]string{}
+	for _, row := range t.Rows {
+		rec := make(map[string]string, len(row))
+		for i, v := range row {
+			rec[t.Columns[i]] = v
+		}
+		out.Records = append(out.Records, rec)
+	}
+	return out
+}
+
+// handleTables lists the loaded page's tables at /api/tables and serves
+// each one at /api/tables/<n>.csv or /api/tables/<n>.json
+func handleTables(w http.ResponseWriter, r *http.Request) {
+	contentMu.RLock()
+	content := currentContent
+	contentMu.RUnlock()
+
+	if content == nil {
+		http.Error(w, "No content loaded", 404)
+		return
+	}
+	doc := newDocument(content)
+	tables := extractTables(doc.Root)
+
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/tables"), "/")
+	if name == "" {
+		type entry struct {
+			Index   int      `json:"index"`
+			Heading string   `json:"heading,omitempty"`
+			Columns []string `json:"columns,omitempty"`
+			Rows    int      `json:"rows"`
+			CSV     string   `json:"csv"`
+			JSON    string   `json:"json"`
+		}
+		entries := []entry{}
+		for _, t := range tables {
+			entries = append(entries, entry{
+				Index:   t.Index,
+				Heading: t.Heading,
+				Columns: t.Columns,
+				Rows:    len(t.Rows),
+				CSV:     fmt.Sprintf("/api/tables/%d.csv", t.Index),
+				JSON:    fmt.Sprintf("/api/tables/%d.json", t.Index),
+			})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"file":   content.TarFile,
+			"tables": entries,
+		})
+		return
+	}
+
+	base, ext := strings.TrimSuffix(name, filepath.Ext(name)), filepath.Ext(name)
+	n, err := strconv.Atoi(base)
+	if err != nil || n < 1 || n > len(tables) || (ext != ".csv" && ext != ".json") {
+		http.Error(w, "Table not found", 404)
+		return
+	}
+	t := tables[n-1]
+	filename := fmt.Sprintf("%s - table %d%s", safeFileName(doc.Title), n, ext)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	if ext == ".csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		t.writeCSV(w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(t.toJSON())
+}
+
+func runTables(args []string) error {
+	fs := newFlagSet("tables")
+	format := fs.String("format", "csv", "Output format: csv or json")
+	index := fs.Int("table", 0, "Only the table at this position (1-based)")
+	out := fs.String("out", "", "Write one file per table to this directory instead of stdout")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected one tar file")
+	}
+	if *format != "csv" && *format != "json" {
+		return fmt.Errorf("unknown format %q (choose from csv, json)", *format)
+	}
+
+	content, err := readTar(expandHome(positional[0]))
+	if err != nil {
+		return err
+	}
+	doc := newDocument(content)
+	tables := extractTables(doc.Root)
+	if *index != 0 {
+		if *index < 1 || *index > len(tables) {
+			return fmt.Errorf("no table %d (the page has %d)", *index, len(tables))
+		}
+		tables = tables[*index-1 : *index]
+	}
+	if len(tables) == 0 {
+		return fmt.Errorf("no tables found in %s", content.TarFile)
+	}
+
+	if *out == "" {
+		return writeTables(os.Stdout, tables, *format)
+	}
+
+	dir := expandHome(*out)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("create %s: %w", dir, err)
+	}
+	slug := slugify(doc.Title)
+	if slug == "" {
+		slug = "page"
+	}
+	var written []string
+	for _, t := range tables {
+		file := filepath.Join(dir, fmt.Sprintf("%s-table-%d.%s", slug, t.Index, *format))
+		f, err := os.Create(file)
+		if err != nil {
+			return err
+		}
+		if err := writeTables(f, []ExtractedTable{t}, *format); err != nil {
+			f.Close()
+			return fmt.Errorf("write %s: %w", file, err)
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		written = append(written, file)
+	}
+
+	successStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#10B981")).Bold(true)
+	pathStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#FBBF24"))
+	fmt.Println(successStyle.Render(fmt.Sprintf("✓ Extracted %d table(s)", len(written))))
+	for _, file := range written {
+		fmt.Printf("  %s\n", pathStyle.Render(file))
+	}
+	return nil
+}
+
+// writeTables writes tables as CSV, separated by blank lines, or as JSON:
+// one object for a single table, otherwise an array
+func writeTables(w io.Writer, tables []ExtractedTable, format string) error {
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if len(tables) == 1 {
+			return enc.Encode(tables[0].toJSON())
+		}
+		all := make([]tableJSON, len(tables))
+		for i, t := range tables {
+			all[i] = t.toJSON()
+		}
+		return enc.Encode(all)
+	}
+	for i, t := range tables {
+		if i > 0 {
+			if _, err := io.WriteString(w, "\n"); err != nil {
+				return err
+			}
+		}
+		if err := t.writeCSV(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,527 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// ============================================================
+// Task Extraction
+// ============================================================
+//
+// Loop checklists export as "- [ ]" and "- [x]" items. Tasks collects them
+// with the headings they sit under, the people they mention and the dates
+// they name, for todo.txt files, calendars and task tools.
+
+func init() {
+	subcommands["tasks"] = subcommand{
+		usage:   "<tar|dir>... [--format json|todo|ics]",
+		summary: "Collect checklist items as JSON, todo.txt or iCalendar",
+		run:     runTasks,
+	}
+}
+
+// Task is one checklist item
+type Task struct {
+	ID       string   `json:"id"`
+	Text     string   `json:"text"`
+	Done     bool     `json:"done"`
+	Page     string   `json:"page"`
+	File     string   `json:"file"`
+	Path     []string `json:"path,omitempty"`     // headings above the item, outermost first
+	Mentions []string `json:"mentions,omitempty"` // @mentions and mailto links
+	Dates    []string `json:"dates,omitempty"`    // dates named in the text, as YYYY-MM-DD
+	Due      string   `json:"due,omitempty"`      // the first of Dates
+
+	exported time.Time
+}
+
+// taskFormat writes tasks in one output format
+type taskFormat struct {
+	ext   string
+	mime  string
+	write func(w io.Writer, tasks []Task) error
+}
+
+var taskFormats = map[string]taskFormat{
+	"json": {ext: ".json", mime: "application/json", write: writeTasksJSON},
+	"todo": {ext: ".txt", mime: "text/plain; charset=utf-8", write: writeTodoTxt},
+	"ics":  {ext: ".ics", mime: "text/calendar; charset=utf-8", write: writeTasksICS},
+}
+
+// collectTasks gathers the checklist items in a document in page order.
+// Nested items are tasks of their own; their text leaves out sub-items.
+func collectTasks(doc *Document) []Task {
+	exported := exportDate(doc.TarPath)
+	title := titleNode(doc)
+	type level struct {
+		depth int
+		text  string
+	}
+	var headings []level
+	var tasks []Task
+	seen := make(map[string]int)
+
+	walkNodes(doc.Root, func(n *Node) bool {
+		switch {
+		case n == title:
+			return false // already the task's Page
+		case n.Type == "heading":
+			for len(headings) > 0 && headings[len(headings)-1].depth >= n.Depth {
+				headings = headings[:len(headings)-1]
+			}
+			headings = append(headings, level{n.Depth, strings.TrimSpace(nodeText(n))})
+			return false
+		case n.Type == "listItem" && n.Checked != nil:
+			text := taskText(n)
+			if text == "" {
+				return true
+			}
+			t := Task{
+				Text:     text,
+				Done:     *n.Checked,
+				Page:     doc.Title,
+				File:     doc.TarFile,
+				Mentions: taskMentions(n, text),
+				exported: exported,
+			}
+			for _, h := range headings {
+				t.Path = append(t.Path, h.text)
+			}
+			for _, d := range findDates(text, exported) {
+				t.Dates = append(t.Dates, d.Format("2006-01-02"))
+			}
+			if len(t.Dates) > 0 {
+				t.Due = t.Dates[0]
+			}
+			// IDs stay stable across re-exports as long as the item and its
+			// place in the outline do
+			key := strings.Join(append([]string{doc.Title}, append(t.Path, text)...), "\x00")
+			seen[key]++
+			sum := sha1.Sum([]byte(key + "\x00" + strconv.Itoa(seen[key])))
+			t.ID = hex.EncodeToString(sum[:6])
+			tasks = append(tasks, t)
+		}
+		return true
+	})
+	return tasks
+}
+
+// taskText is the item's own text on one line, without nested lists
+func taskText(li *Node) string {
+	var parts []string
+	for _, c := range li.Children {
+		if c.Type == "list" {
+			continue
+		}
+		parts = append(parts, nodeText(c))
+	}
+	return strings.Join(strings.Fields(strings.Join(parts, " ")), " ")
+}
+
+// reMention matches "@name" but not the middle of an email address. A
+// following capitalized word is not taken as a surname, since it is as
+// likely the start of the task ("@Alice Review the draft"); full names
+// come from mailto link text.
+var reMention = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_.@])@(\p{L}[\p{L}\p{N}_.'-]*)`)
+
+// taskMentions finds people linked with mailto: and @mentions in the
+// text. An @mention of a linked person's first name, as in a link
+// reading "@Jane Doe", is the same person.
+func taskMentions(li *Node, text string) []string {
+	var mentions []string
+	add := func(m string) {
+		m = strings.TrimRight(m, ".'-")
+		for _, have := range mentions {
+			if strings.EqualFold(have, m) || strings.HasPrefix(strings.ToLower(have), strings.ToLower(m)+" ") {
+				return
+			}
+		}
+		if m != "" {
+			mentions = append(mentions, m)
+		}
+	}
+	for _, c := range li.Children {
+		if c.Type == "list" {
+			continue
+		}
+		walkNodes(c, func(n *Node) bool {
+			if n.Type == "link" && strings.HasPrefix(strings.ToLower(n.URL), "mailto:") {
+				add(strings.TrimPrefix(strings.TrimSpace(nodeText(n)), "@"))
+				return false
+			}
+			return true
+		})
+	}
+	for _, m := range reMention.FindAllStringSubmatch(text, -1) {
+		add(m[1])
+	}
+	return mentions
+}
+
+// ============================================================
+// Date Detection
+// ============================================================
+
+// monthPattern matches capitalized month names only, so the verb "may"
+// and words like "mar" are not read as dates
+const monthPattern = `(Jan(?:uary)?|Feb(?:ruary)?|Mar(?:ch)?|Apr(?:il)?|May|June?|July?|Aug(?:ust)?|Sep(?:t(?:ember)?)?|Oct(?:ober)?|Nov(?:ember)?|Dec(?:ember)?)`
+
+var (
+	// reISODate matches 2026-02-01
+	reISODate = regexp.MustCompile(`\b(\d{4})-(\d{1,2})-(\d{1,2})\b`)
+	// reSlashDate matches US-style 2/1/2026 and 2/1/26
+	reSlashDate = regexp.MustCompile(`\b(\d{1,2})/(\d{1,2})/(\d{4}|\d{2})\b`)
+	// reMonthDay matches "Feb 1", "February 1st" and "Feb 1, 2026"
+	reMonthDay = regexp.MustCompile(`\b` + monthPattern + `\.? (\d{1,2})(?:st|nd|rd|th)?\b(?:,? (\d{4})\b)?`)
+	// reDayMonth matches "1 Feb" and "1st February 2026"
+	reDayMonth = regexp.MustCompile(`\b(\d{1,2})(?:st|nd|rd|th)? ` + monthPattern + `\b\.?(?:,? (\d{4})\b)?`)
+)
+
+// findDates returns the valid dates named in text, in order of appearance.
+// Dates without a year take the year of the export.
+func findDates(text string, ref time.Time) []time.Time {
+	type found struct {
+		start, end int
+		date       time.Time
+	}
+	var all []found
+	add := func(loc []int, year, month, day string) {
+		y := ref.Year()
+		if year != "" {
+			y, _ = strconv.Atoi(year)
+			if len(year) == 2 {
+				y += 2000
+			}
+		}
+		m, err := strconv.Atoi(month)
+		if err != nil {
+			m = monthNumber(month)
+		}
+		d, _ := strconv.Atoi(day)
+		if m < 1 || m > 12 || d < 1 || d > 31 {
+			return
+		}
+		date := time.Date(y, time.Month(m), d, 0, 0, 0, 0, time.Local)
+		if date.Day() != d {
+			return // e.g. February 30
+		}
+		all = append(all, found{loc[0], loc[1], date})
+	}
+	for _, loc := range reISODate.FindAllStringSubmatchIndex(text, -1) {
+		s := submatches(text, loc)
+		add(loc, s[1], s[2], s[3])
+	}
+	for _, loc := range reSlashDate.FindAllStringSubmatchIndex(text, -1) {
+		s := submatches(text, loc)
+		add(loc, s[3], s[1], s[2])
+	}
+	for _, loc := range reMonthDay.FindAllStringSubmatchIndex(text, -1) {
+		s := submatches(text, loc)
+		add(loc, s[3], s[1], s[2])
+	}
+	for _, loc := range reDayMonth.FindAllStringSubmatchIndex(text, -1) {
+		s := submatches(text, loc)
+		add(loc, s[3], s[2], s[1])
+	}
+
+	// Patterns can overlap, as in "1 Feb 2" - keep the earliest, longest match
+	sort.SliceStable(all, func(i, j int) bool {
+		if all[i].start != all[j].start {
+			return all[i].start < all[j].start
+		}
+		return all[i].end > all[j].end
+	})
+	var dates []time.Time
+	end := -1
+	for _, f := range all {
+		if f.start < end {
+			continue
+		}
+		dates = append(dates, f.date)
+		end = f.end
+	}
+	return dates
+}
+
+// submatches expands FindStringSubmatchIndex output to strings, with ""
+// for groups that did not take part
+func submatches(s string, loc []int) []string {
+	out := make([]string, len(loc)/2)
+	for i := range out {
+		if loc[2*i] >= 0 {
+			out[i] = s[loc[2*i]:loc[2*i+1]]
+		}
+	}
+	return out
+}
+
+func monthNumber(name string) int {
+	prefix := strings.ToLower(name)[:3]
+	for m := time.January; m <= time.December; m++ {
+		if strings.ToLower(m.String())[:3] == prefix {
+			return int(m)
+		}
+	}
+	return 0
+}
+
+// ============================================================
+// Task Formats
+// ============================================================
+
+func writeTasksJSON(w io.Writer, tasks []Task) error {
+	open := 0
+	for _, t := range tasks {
+		if !t.Done {
+			open++
+		}
+	}
+	if tasks == nil {
+		tasks = []Task{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(map[string]interface{}{
+		"open":  open,
+		"done":  len(tasks) - open,
+		"tasks": tasks,
+	})
+}
+
+// writeTodoTxt writes one todo.txt line per task, with the page as a
+// +project and the first date as due:
+func writeTodoTxt(w io.Writer, tasks []Task) error {
+	for _, t := range tasks {
+		var sb strings.Builder
+		if t.Done {
+			sb.WriteString("x ")
+		}
+		sb.WriteString(t.Text)
+		if project := slugify(t.Page); project != "" {
+			sb.WriteString(" +" + project)
+		}
+		if t.Due != "" {
+			sb.WriteString(" due:" + t.Due)
+		}
+		sb.WriteString("\n")
+		if _, err := io.WriteString(w, sb.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeTasksICS writes an iCalendar file with one VTODO per task. The
+// export time stands in for DTSTAMP so the same export gives the same file.
+func writeTasksICS(w io.Writer, tasks []Task) error {
+	var sb strings.Builder
+	line := func(name, value string) {
+		sb.WriteString(foldICSLine(name + ":" + value))
+		sb.WriteString("\r\n")
+	}
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//loopd//Loop Tasks//EN")
+	for _, t := range tasks {
+		stamp := t.exported
+		if stamp.IsZero() {
+			stamp = time.Now()
+		}
+		line("BEGIN", "VTODO")
+		line("UID", t.ID+"@loopd")
+		line("DTSTAMP", stamp.UTC().Format("20060102T150405Z"))
+		line("SUMMARY", escapeICS(t.Text))
+		if t.Done {
+			line("STATUS", "COMPLETED")
+			line("PERCENT-COMPLETE", "100")
+		} else {
+			line("STATUS", "NEEDS-ACTION")
+		}
+		if t.Due != "" {
+			line("DUE;VALUE=DATE", strings.ReplaceAll(t.Due, "-", ""))
+		}
+		categories := []string{escapeICS(t.Page)}
+		for _, h := range t.Path {
+			categories = append(categories, escapeICS(h))
+		}
+		line("CATEGORIES", strings.Join(categories, ","))
+		desc := strings.Join(append([]string{t.Page}, t.Path...), " › ")
+		if len(t.Mentions) > 0 {
+			desc += "\nMentions: " + strings.Join(t.Mentions, ", ")
+		}
+		line("DESCRIPTION", escapeICS(desc))
+		line("END", "VTODO")
+	}
+	line("END", "VCALENDAR")
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// escapeICS escapes an iCalendar TEXT value
+func escapeICS(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`).Replace(s)
+}
+
+// foldICSLine splits content lines longer than 75 octets, as RFC 5545
+// requires, without breaking UTF-8 sequences
+func foldICSLine(s string) string {
+	var sb strings.Builder
+	limit := 75
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		sb.WriteString(s[:cut])
+		sb.WriteString("\r\n ")
+		s = s[cut:]
+		limit = 74 // continuation lines start with a space
+	}
+	sb.WriteString(s)
+	return sb.String()
+}
+
+// filterTasks keeps open or done tasks; any other status keeps all
+func filterTasks(tasks []Task, status string) []Task {
+	if status != "open" && status != "done" {
+		return tasks
+	}
+	var out []Task
+	for _, t := range tasks {
+		if t.Done == (status == "done") {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// handleTasks serves the loaded page's checklist items. ?format= picks
+// json (default), todo or ics, ?status= open or done, ?download=1 saves a
+// file, and ?file= (repeatable) reads exports from the library instead.
+func handleTasks(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	name := q.Get("format")
+	if name == "" {
+		name = "json"
+	}
+	format, ok := taskFormats[name]
+	if !ok {
+		http.Error(w, "Unknown task format", 400)
+		return
+	}
+
+	var contents []*Content
+	if files := q["file"]; len(files) > 0 {
+		for _, f := range files {
+			if _, err := libraryPath(f); err != nil {
+				http.Error(w, err.Error(), 400)
+				return
+			}
+		}
+		var err error
+		if contents, err = readLibraryExports(files); err != nil {
+			http.Error(w, err.Error(), 404)
+			return
+		}
+	} else {
+		contentMu.RLock()
+		content := currentContent
+		contentMu.RUnlock()
+		if content == nil {
+			http.Error(w, "No content loaded", 404)
+			return
+		}
+		contents = []*Content{content}
+	}
+
+	var tasks []Task
+	for _, c := range contents {
+		tasks = append(tasks, collectTasks(newDocument(c))...)
+	}
+	tasks = filterTasks(tasks, q.Get("status"))
+
+	w.Header().Set("Content-Type", format.mime)
+	if q.Get("download") != "" {
+		title := "Loop Tasks"
+		if len(contents) == 1 {
+			title = exportTitle(contents[0].TarFile) + " tasks"
+		}
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, safeFileName(title)+format.ext))
+	}
+	format.write(w, tasks)
+}
+
+func runTasks(args []string) error {
+	fs := newFlagSet("tasks")
+	formatName := fs.String("format", "json", "Output format: json, todo or ics")
+	status := fs.String("status", "all", "Which tasks: open, done or all")
+	out := fs.String("out", "", "Output file (default: stdout)")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) == 0 {
+		fs.Usage()
+		return fmt.Errorf("expected at least one tar file or directory")
+	}
+	format, ok := taskFormats[*formatName]
+	if !ok {
+		return fmt.Errorf("unknown format %q (choose from json, todo, ics)", *formatName)
+	}
+	if *status != "all" && *status != "open" && *status != "done" {
+		return fmt.Errorf("unknown status %q (choose from open, done, all)", *status)
+	}
+
+	paths, err := expandExportArgs(positional)
+	if err != nil {
+		return err
+	}
+	var tasks []Task
+	for _, p := range paths {
+		content, err := readTar(p)
+		if err != nil {
+			return fmt.Errorf("%s: %w", p, err)
+		}
+		tasks = append(tasks, collectTasks(newDocument(content))...)
+	}
+	tasks = filterTasks(tasks, *status)
+
+	if *out == "" {
+		return format.write(os.Stdout, tasks)
+	}
+	file := expandHome(*out)
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if err := format.write(f, tasks); err != nil {
+		f.Close()
+		return fmt.Errorf("write %s: %w", file, err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	successStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#10B981")).Bold(true)
+	pathStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#FBBF24"))
+	noun := "task"
+	if len(tasks) != 1 {
+		noun = "tasks"
+	}
+	fmt.Printf("%s %s\n", successStyle.Render(fmt.Sprintf("✓ Wrote %d %s to", len(tasks), noun)), pathStyle.Render(file))
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestFindDates(t *testing.T) {
+	ref := time.Date(2026, 3, 10, 0, 0, 0, 0, time.Local)
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"Ship by 2026-02-01", []string{"2026-02-01"}},
+		{"Due 2/1/2026 or 2/3/26", []string{"2026-02-01", "2026-02-03"}},
+		{"Review Feb 1st", []string{"2026-02-01"}},
+		{"Launch Sept. 30, 2027", []string{"2027-09-30"}},
+		{"Starts 1st March 2026", []string{"2026-03-01"}},
+		{"Due May 2", []string{"2026-05-02"}},
+		{"We may 2 teams need this", nil},
+		{"feb 1 is lowercase", nil},
+		{"February 30 does not exist", nil},
+		{"Between 1 Feb 2 and 2026-13-01", []string{"2026-02-01"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, d := range findDates(tt.text, ref) {
+			got = append(got, d.Format("2006-01-02"))
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("findDates(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestTaskMentions(t *testing.T) {
+	tests := []struct {
+		item string
+		want []string
+	}{
+		{"- [ ] Ask @alice", []string{"alice"}},
+		{"- [ ] @Alice Review the draft", []string{"Alice"}},
+		{"- [ ] @bob and @Bob, then @carol.", []string{"bob", "carol"}},
+		{"- [ ] Mail jane@contoso.com", nil},
+		{"- [ ] Sync with [Jane Doe](mailto:jane@contoso.com)", []string{"Jane Doe"}},
+		{"- [ ] Sync with [@Jane Doe](mailto:jane@contoso.com), cc @jane and @bob", []string{"Jane Doe", "bob"}},
+		{"- [ ] @bob to loop in [Carol](mailto:carol@contoso.com)", []string{"Carol", "bob"}},
+		{"- [ ] Parent\n  - [ ] Child for @dave", nil},
+	}
+	for _, tt := range tests {
+		var li *Node
+		walkNodes(parseMarkdown(tt.item), func(n *Node) bool {
+			if li == nil && n.Type == "listItem" {
+				li = n
+			}
+			return li == nil
+		})
+		if li == nil {
+			t.Fatalf("no list item in %q", tt.item)
+		}
+		if got := taskMentions(li, taskText(li)); !slices.Equal(got, tt.want) {
+			t.Errorf("taskMentions(%q) = %q, want %q", tt.item, got, tt.want)
+		}
+	}
+}
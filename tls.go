@@ -0,0 +1,303 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ============================================================
+// HTTPS
+// ============================================================
+//
+// Loop pages are served over HTTPS, and browsers (Safari in particular)
+// refuse scripts and requests from plain http://localhost on them. With
+// --tls, loopd serves HTTPS using a certificate for localhost signed by
+// its own CA. Both are generated once and kept in the config directory,
+// so the CA only needs to be trusted once.
+
+// urlScheme is the scheme the preview server is reached on
+var urlScheme = "http"
+
+const (
+	caCertFile   = "ca.pem"
+	caKeyFile    = "ca-key.pem"
+	leafCertFile = "localhost.pem"
+	leafKeyFile  = "localhost-key.pem"
+
+	// leafValidity stays under the 825 days Apple platforms accept
+	leafValidity = 800 * 24 * time.Hour
+	caValidity   = 10 * 365 * 24 * time.Hour
+)
+
+// tlsDir holds the generated CA and certificate
+func tlsDir() string {
+	return filepath.Join(getConfigDir(), "tls")
+}
+
+// certHosts lists the names the certificate must cover: localhost plus
+// any non-loopback address the server listens on
+func certHosts(addr net.Addr, network []string) []string {
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+	if tcp, ok := addr.(*net.TCPAddr); ok && !tcp.IP.IsUnspecified() && !tcp.IP.IsLoopback() {
+		hosts = append(hosts, tcp.IP.String())
+	}
+	for _, u := range network {
+		if parsed, err := url.Parse(u); err == nil && !slices.Contains(hosts, parsed.Hostname()) {
+			hosts = append(hosts, parsed.Hostname())
+		}
+	}
+	return hosts
+}
+
+// loadOrCreateCert returns the server certificate for hosts, creating the
+// CA on first use and reissuing the certificate when it is about to
+// expire or does not cover every host. created reports whether a new CA
+// was made, which means the user still has to trust it.
+func loadOrCreateCert(dir string, hosts []string) (cert tls.Certificate, created bool, err error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return cert, false, err
+	}
+	// Only a missing CA is replaced; one that fails to load may already
+	// be trusted, so the user decides what to do with it
+	caPath := filepath.Join(dir, caCertFile)
+	var caCert *x509.Certificate
+	var caKey *ecdsa.PrivateKey
+	if _, err := os.Stat(caPath); errors.Is(err, fs.ErrNotExist) {
+		if caCert, caKey, err = createCA(dir); err != nil {
+			return cert, false, fmt.Errorf("create CA: %w", err)
+		}
+		created = true
+	} else if caCert, caKey, err = loadKeyPair(caPath, filepath.Join(dir, caKeyFile)); err != nil {
+		return cert, false, fmt.Errorf("load CA from %s: %w (delete %s and %s to create a new one)", dir, err, caCertFile, caKeyFile)
+	}
+
+	var skipped []string
+	hosts, skipped = permittedHosts(caCert, hosts)
+	if len(skipped) > 0 {
+		slog.Warn("The loopd CA only signs for local and private addresses; not covering " + strings.Join(skipped, ", "))
+	}
+
+	leafPath, leafKeyPath := filepath.Join(dir, leafCertFile), filepath.Join(dir, leafKeyFile)
+	if leaf, _, err := loadKeyPair(leafPath, leafKeyPath); err == nil && !created && leafCovers(leaf, caCert, hosts) {
+		cert, err = tls.LoadX509KeyPair(leafPath, leafKeyPath)
+		return cert, false, err
+	}
+	if err := createLeaf(dir, caCert, caKey, hosts); err != nil {
+		return cert, created, fmt.Errorf("create certificate: %w", err)
+	}
+	cert, err = tls.LoadX509KeyPair(leafPath, leafKeyPath)
+	return cert, created, err
+}
+
+// caPermittedRanges are the addresses the CA may sign for: loopback,
+// private and link-local networks
+var caPermittedRanges = func() []*net.IPNet {
+	var ranges []*net.IPNet
+	for _, cidr := range []string{
+		"127.0.0.0/8", "10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "169.254.0.0/16", "100.64.0.0/10",
+		"::1/128", "fc00::/7", "fe80::/10",
+	} {
+		_, ipnet, _ := net.ParseCIDR(cidr)
+		ranges = append(ranges, ipnet)
+	}
+	return ranges
+}()
+
+// permittedHosts splits hosts into those the CA's name constraints allow
+// and those they do not. A CA without constraints allows every host.
+func permittedHosts(ca *x509.Certificate, hosts []string) (allowed, skipped []string) {
+	for _, h := range hosts {
+		if hostPermitted(ca, h) {
+			allowed = append(allowed, h)
+		} else {
+			skipped = append(skipped, h)
+		}
+	}
+	return allowed, skipped
+}
+
+func hostPermitted(ca *x509.Certificate, host string) bool {
+	if ip := net.ParseIP(host); ip != nil {
+		if len(ca.PermittedIPRanges) == 0 {
+			return !ca.PermittedDNSDomainsCritical
+		}
+		return slices.ContainsFunc(ca.PermittedIPRanges, func(r *net.IPNet) bool { return r.Contains(ip) })
+	}
+	if len(ca.PermittedDNSDomains) == 0 {
+		return !ca.PermittedDNSDomainsCritical
+	}
+	return slices.ContainsFunc(ca.PermittedDNSDomains, func(d string) bool {
+		return host == d || strings.HasSuffix(host, "."+d)
+	})
+}
+
+// leafCovers reports whether a certificate was signed by the CA, names
+// every host and has at least a month left
+func leafCovers(leaf, ca *x509.Certificate, hosts []string) bool {
+	if leaf.CheckSignatureFrom(ca) != nil || time.Until(leaf.NotAfter) < 30*24*time.Hour {
+		return false
+	}
+	for _, h := range hosts {
+		if leaf.VerifyHostname(h) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// loadKeyPair reads a PEM certificate and EC private key
+func loadKeyPair(certPath, keyPath string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	certBlock, _ := pem.Decode(certPEM)
+	keyBlock, _ := pem.Decode(keyPEM)
+	if certBlock == nil || keyBlock == nil {
+		return nil, nil, fmt.Errorf("invalid PEM in %s", filepath.Dir(certPath))
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := x509.ParseECPrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, key, nil
+}
+
+// createCA makes the self-signed CA that issues the server certificate
+func createCA(dir string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	host, _ := os.Hostname()
+	tmpl := &x509.Certificate{
+		SerialNumber:          randomSerial(),
+		Subject:               pkix.Name{Organization: []string{appName}, CommonName: fmt.Sprintf("%s local CA (%s)", appName, host)},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+
+		// A trusted root whose key sits in the config directory must not
+		// be able to vouch for anyone else's site
+		PermittedDNSDomainsCritical: true,
+		PermittedDNSDomains:         []string{"localhost"},
+		PermittedIPRanges:           caPermittedRanges,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := writePEMFiles(dir, caCertFile, caKeyFile, der, key); err != nil {
+		return nil, nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	return cert, key, err
+}
+
+// createLeaf issues the server certificate for hosts
+func createLeaf(dir string, ca *x509.Certificate, caKey *ecdsa.PrivateKey, hosts []string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: randomSerial(),
+		Subject:      pkix.Name{Organization: []string{appName}, CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(leafValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+	if err != nil {
+		return err
+	}
+	return writePEMFiles(dir, leafCertFile, leafKeyFile, der, key)
+}
+
+// writePEMFiles saves a certificate and its private key, the key
+// readable only by the user
+func writePEMFiles(dir, certFile, keyFile string, der []byte, key *ecdsa.PrivateKey) error {
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := os.WriteFile(filepath.Join(dir, keyFile), keyPEM, 0600); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, certFile), certPEM, 0644)
+}
+
+// randomSerial returns a random 128-bit certificate serial number
+func randomSerial() *big.Int {
+	n, _ := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	return n
+}
+
+// newTLSListener wraps the server's listener in TLS
+func newTLSListener(l net.Listener, cert tls.Certificate) net.Listener {
+	return tls.NewListener(l, &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	})
+}
+
+// trustInstructions explains how to trust the CA on this platform
+func trustInstructions(caPath string) []string {
+	switch runtime.GOOS {
+	case "darwin":
+		return []string{
+			"Trust the loopd CA once so Safari and Chrome accept it:",
+			"  security add-trusted-cert -r trustRoot -k ~/Library/Keychains/login.keychain-db " + caPath,
+		}
+	case "windows":
+		return []string{
+			"Trust the loopd CA once so Edge and Chrome accept it:",
+			"  certutil -user -addstore Root " + caPath,
+		}
+	default:
+		return []string{
+			"Trust the loopd CA once so browsers accept it:",
+			"  sudo cp " + caPath + " /usr/local/share/ca-certificates/loopd.crt && sudo update-ca-certificates",
+			"  Firefox keeps its own store: Settings → Certificates → Import " + caPath,
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ============================================================
+// Note Vault Targets (Obsidian, Logseq)
+// ============================================================
+//
+// Vault targets name pages after their titles so exported pages can link
+// to each other with [[Page Title]] wiki links.
+
+func init() {
+	convertTargets["obsidian"] = convertTarget{
+		page: func(p *convertPage) (string, string) {
+			return p.Name + ".md", filepath.Join("attachments", p.Slug)
+		},
+		imageURL: func(p *convertPage, name string) string {
+			return "attachments/" + p.Slug + "/" + name
+		},
+		frontMatter: standardFrontMatter,
+		embed: func(ref, alt string) string {
+			if alt = wikiText(alt); alt != "" {
+				return "![[" + ref + "|" + alt + "]]"
+			}
+			return "![[" + ref + "]]"
+		},
+		pageLink: func(target *convertPage, text string) string {
+			text = wikiText(text)
+			if text == "" || text == target.Name {
+				return "[[" + target.Name + "]]"
+			}
+			return "[[" + target.Name + "|" + text + "]]"
+		},
+		callout: obsidianCallout,
+	}
+
+	convertTargets["logseq"] = convertTarget{
+		page: func(p *convertPage) (string, string) {
+			return filepath.Join("pages", p.Name+".md"), filepath.Join("assets", p.Slug)
+		},
+		imageURL: func(p *convertPage, name string) string {
+			return "../assets/" + p.Slug + "/" + name
+		},
+		// The title property names the page, so links can use the real title
+		frontMatter: func(p *convertPage, fields []string) []yamlField {
+			fm := standardFrontMatter(p, fields)
+			for _, f := range fm {
+				if f.Key == "title" {
+					return fm
+				}
+			}
+			return append([]yamlField{{Key: "title", Value: p.Title}}, fm...)
+		},
+		pageLink: func(target *convertPage, text string) string {
+			if text == "" || text == target.Title {
+				return "[[" + target.Title + "]]"
+			}
+			return "[" + escapeMarkdownText(text, false) + "]([[" + target.Title + "]])"
+		},
+		callout: func(n *Node, body string) string {
+			return "#+BEGIN_" + n.Callout + "\n" + body + "\n#+END_" + n.Callout
+		},
+		writeFrontMatter: writeLogseqProperties,
+	}
+}
+
+// obsidianCallout writes a callout in Obsidian syntax. The marker is the
+// same as GitHub's, but Obsidian types are lowercase by convention and a
+// trailing - or + makes the callout collapsible.
+func obsidianCallout(n *Node, body string) string {
+	marker := "[!" + strings.ToLower(n.Callout) + "]" + n.Fold
+	if body != "" {
+		marker += "\n" + body
+	}
+	return prefixLines(marker, "> ", ">")
+}
+
+// wikiText strips characters that would end a wiki link early
+func wikiText(s string) string {
+	s = strings.NewReplacer("|", "-", "[", "", "]", "", "\n", " ").Replace(s)
+	return strings.TrimSpace(s)
+}
+
+// writeLogseqProperties writes fields as Logseq page properties, which
+// must form the first block of the page
+func writeLogseqProperties(sb *strings.Builder, fields []yamlField) {
+	for _, f := range fields {
+		switch v := f.Value.(type) {
+		case time.Time:
+			fmt.Fprintf(sb, "%s:: %s\n", f.Key, v.Format("2006-01-02"))
+		case []string:
+			fmt.Fprintf(sb, "%s:: %s\n", f.Key, strings.Join(v, ", "))
+		case []yamlField:
+			// Logseq properties are flat
+			for _, sub := range v {
+				writeLogseqProperties(sb, []yamlField{sub})
+			}
+		default:
+			fmt.Fprintf(sb, "%s:: %v\n", f.Key, v)
+		}
+	}
+	if len(fields) > 0 {
+		sb.WriteString("\n")
+	}
+}